@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/config"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configCmd groups the commands for working with the configuration file
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Validate, show or create the configuration file",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Report unknown keys and invalid values in the configuration file",
+	Long: `Checks the repository's configuration file, or the given file, for unknown
+keys like [section], section names that aren't lowercase, invalid values, and
+files named by extends that can't be read. Each problem of a TOML file is
+printed with its line and column. Exits with status 1 if there are any
+problems.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name, format, contents := readConfigFile(args)
+		// Checks like the grouping's depend on the provider set in the file,
+		// or in the files it extends
+		ctx, cancel := newContext()
+		defer cancel()
+		file := &changelog.ConfigFile{Reader: bytes.NewReader(contents), Path: name}
+		if err := newExtender(readConfig()).Read(ctx, viper.GetViper(), file); err != nil {
+			exitOnError(errors.Wrapf(err, "Could not read %s", name))
+		}
+		problems, err := config.Validate(bytes.NewReader(contents), format, configChecks())
+		if err != nil {
+			exitOnError(err)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s is valid\n", name)
+			return
+		}
+		for _, problem := range problems {
+			fmt.Println(problemString(name, problem))
+		}
+		os.Exit(1)
+	},
+}
+
+var configDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Print the effective configuration, and where each setting comes from",
+	Long: `Prints the configuration merged from flags, CHANGELOG_ environment variables,
+the repository's configuration file ("file" for local providers, "remote" for the
+others), the origin remote and defaults, as TOML. Each setting is followed by its source. Tokens
+and secrets are masked.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := newContext()
+		defer cancel()
+		c := setup(ctx)
+
+		if err := dumpConfig(os.Stdout, c); err != nil {
+			exitOnError(err)
+		}
+	},
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init [file]",
+	Short: "Write a commented starter configuration file",
+	Long: `Writes a .clog.toml, or the given TOML file, documenting the most common
+settings. Existing files are not overwritten unless --force is set.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := ".clog.toml"
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if file := (changelog.ConfigFile{Path: path}); file.Type() != "toml" {
+			exitOnError(fmt.Errorf("The starter file is TOML, but %s is read as %s", path, file.Type()))
+		}
+		if force, _ := cmd.Flags().GetBool("force"); !force {
+			if _, err := os.Stat(path); err == nil {
+				exitOnError(fmt.Errorf("%s already exists! Pass --force to overwrite it", path))
+			}
+		}
+		if err := ioutil.WriteFile(path, []byte(config.Starter), 0644); err != nil {
+			exitOnError(errors.WithStack(err))
+		}
+		fmt.Printf("Wrote %s\n", path)
+	},
+}
+
+// readConfigFile returns the name, format and contents of the file named by
+// args, or of the repository's configuration file
+func readConfigFile(args []string) (string, string, []byte) {
+	if len(args) > 0 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			exitOnError(errors.WithStack(err))
+		}
+		defer f.Close()
+		file, err := changelog.NewConfigFile(args[0], f)
+		if err != nil {
+			exitOnError(err)
+		}
+		contents, err := ioutil.ReadAll(file)
+		if err != nil {
+			exitOnError(errors.WithStack(err))
+		}
+		return args[0], file.Type(), contents
+	}
+
+	c := readConfig()
+	if err := validateProvider(c.Provider); err != nil {
+		exitOnError(err)
+	}
+	ctx, cancel := newContext()
+	defer cancel()
+	querier := newQuerier(c, changelog.QueryFilter{})
+	defer closeQuerier(querier)
+	file, err := querier.GetConfig(ctx)
+	if err != nil {
+		exitOnError(err)
+	}
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		exitOnError(errors.WithStack(err))
+	}
+	return changelog.ConfigPath(file), changelog.ConfigType(file), contents
+}
+
+// configChecks are the checks of settings whose valid values are defined by
+// the commands
+func configChecks() config.Checks {
+	str := func(value interface{}) string {
+		s, _ := value.(string)
+		return s
+	}
+	return config.Checks{
+		"provider": func(key string, value interface{}) error {
+			return validateProvider(str(value))
+		},
+		"group-by": func(key string, value interface{}) error {
+			return validateGroupBy(str(value), readConfig().Provider)
+		},
+		"publish-to": func(key string, value interface{}) error {
+			for _, publisher := range publishers {
+				if value == publisher {
+					return nil
+				}
+			}
+			return fmt.Errorf("Publisher %s not found! Must be one of %s", value, strings.Join(publishers, ", "))
+		},
+	}
+}
+
+// warnIgnoredSettings prints the settings of the configuration file that have
+// no effect, like misspelled keys, to stderr. Invalid values are reported
+// where they are used.
+func warnIgnoredSettings(name, format string, contents []byte) {
+	problems, err := config.Validate(bytes.NewReader(contents), format, nil)
+	if err != nil {
+		return
+	}
+	for _, problem := range problems {
+		if problem.Ignored {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", problemString(name, problem))
+		}
+	}
+}
+
+// problemString prefixes a problem with the name of the file, like
+// `.clog.toml:3:1: section: unknown key`
+func problemString(name string, problem config.Problem) string {
+	if problem.Line == 0 {
+		return fmt.Sprintf("%s: %s", name, problem)
+	}
+	return fmt.Sprintf("%s:%s", name, problem)
+}
+
+// settingSource returns where the effective value of a setting comes from,
+// in viper's order of precedence
+func settingSource(settings *config.Config, key string) string {
+	for _, flags := range []*flag.FlagSet{flag.CommandLine, releaseCmd.Flags(), serveCmd.Flags()} {
+		if f := flags.Lookup(key); f != nil && f.Changed {
+			return "flag"
+		}
+	}
+	if _, ok := os.LookupEnv("CHANGELOG_" + strings.ToUpper(key)); ok {
+		return "env"
+	}
+	if viper.InConfig(key) {
+		if isLocalProvider(settings.Provider) {
+			return "file"
+		}
+		return "remote"
+	}
+	if key == "repo" && settings.Repo != "" && isLocalProvider(settings.Provider) {
+		// Local providers default to the URL of the origin remote
+		return "origin"
+	}
+	return "default"
+}
+
+// dumpConfig writes each setting of the effective configuration as TOML,
+// followed by a comment naming its source. Tables follow the other settings.
+func dumpConfig(w io.Writer, settings *config.Config) error {
+	fmt.Fprintln(w, "# The effective configuration. Each setting is followed by its source: flag,")
+	fmt.Fprintln(w, "# env, file, remote, origin or default.")
+	var tables bytes.Buffer
+	value := reflect.ValueOf(*settings)
+	for i := 0; i < value.NumField(); i++ {
+		key := value.Type().Field(i).Tag.Get("mapstructure")
+		source := settingSource(settings, key)
+
+		switch field := value.Field(i).Interface().(type) {
+		case string:
+			if (key == "token" || key == "secret") && field != "" {
+				field = "********"
+			}
+			fmt.Fprintf(w, "%s = %s # %s\n", key, tomlValue(field), source)
+		case time.Duration:
+			fmt.Fprintf(w, "%s = %s # %s\n", key, tomlValue(field.String()), source)
+		case bool, int, []string:
+			fmt.Fprintf(w, "%s = %s # %s\n", key, tomlValue(field), source)
+		default:
+			var table interface{}
+			switch key {
+			case "sections", "labels":
+				// Sections are merged into the defaults, and written as the
+				// file spells them
+				defaults := changelog.NewSectionAliasMap()
+				if key == "labels" {
+					defaults = changelog.NewLabelAliasMap()
+				}
+				sections := map[string]interface{}{}
+				configured, _ := field.(map[string][]string)
+				for title, aliases := range changelog.MergeSectionAliasMaps(defaults, configured) {
+					sections[strings.ToLower(title)] = aliases
+				}
+				table = sections
+				if source != "default" {
+					source = "default, " + source
+				}
+			default:
+				if !viper.IsSet(key) {
+					continue
+				}
+				table = viper.Get(key)
+			}
+			fmt.Fprintf(&tables, "\n# %s\n", source)
+			writeTOMLTable(&tables, key, table)
+		}
+	}
+	_, err := tables.WriteTo(w)
+	return errors.WithStack(err)
+}
+
+// bareKeyRegex matches the keys TOML doesn't need quoted
+var bareKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(key string) string {
+	if bareKeyRegex.MatchString(key) {
+		return key
+	}
+	return fmt.Sprintf("%q", key)
+}
+
+// tomlValue formats a string, number, boolean or array as TOML
+func tomlValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", value)
+	case []string:
+		values := []interface{}{}
+		for _, v := range value {
+			values = append(values, v)
+		}
+		return tomlValue(values)
+	case []interface{}:
+		values := []string{}
+		for _, v := range value {
+			values = append(values, tomlValue(v))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// writeTOMLTable writes a table, or an array of tables, named by its dotted
+// path. Keys are sorted, and nested tables follow the other keys.
+func writeTOMLTable(w io.Writer, path string, value interface{}) {
+	switch value := value.(type) {
+	case []map[string]interface{}:
+		for _, table := range value {
+			writeTOMLKeys(w, fmt.Sprintf("[[%s]]", path), path, table)
+		}
+	case []interface{}:
+		for _, table := range value {
+			writeTOMLKeys(w, fmt.Sprintf("[[%s]]", path), path, cast.ToStringMap(table))
+		}
+	default:
+		writeTOMLKeys(w, fmt.Sprintf("[%s]", path), path, cast.ToStringMap(value))
+	}
+}
+
+// writeTOMLKeys writes the keys of a table under its header. The header of a
+// table holding only other tables is left out.
+func writeTOMLKeys(w io.Writer, header, path string, table map[string]interface{}) {
+	keys := []string{}
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var values bytes.Buffer
+	nested := []string{}
+	for _, key := range keys {
+		switch table[key].(type) {
+		case map[string]interface{}, map[interface{}]interface{}, []map[string]interface{}:
+			nested = append(nested, key)
+		default:
+			fmt.Fprintf(&values, "%s = %s\n", tomlKey(key), tomlValue(table[key]))
+		}
+	}
+	if values.Len() > 0 || len(nested) == 0 || strings.HasPrefix(header, "[[") {
+		fmt.Fprintln(w, header)
+		values.WriteTo(w)
+	}
+	for _, key := range nested {
+		writeTOMLTable(w, path+"."+tomlKey(key), table[key])
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd, configDumpCmd, configInitCmd)
+	configInitCmd.Flags().Bool("force", false, "Set to true to overwrite an existing file")
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/config"
+	"github.com/skuid/changelog/src/linkStyle"
+	"github.com/skuid/changelog/src/release"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// releaseCmd represents the release command
+var releaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Create or update a release with the generated changelog",
+	Long: `Generates the changelog and publishes it as the body of the Github or Gitlab
+release for --version, or as the message of an annotated tag for providers
+without releases. The release is created if it doesn't exist yet, and updated
+if it does. Versions with a pre-release identifier (1.2.0-rc.1) are marked as
+prereleases, and identifiers starting with "draft" (1.2.0-draft) as drafts
+instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if readConfig().Version == "" {
+			exitOnError(errors.New("A --version is required to publish a release"))
+		}
+
+		ctx, cancel := newContext()
+		defer cancel()
+
+		c := setup(ctx)
+		var body bytes.Buffer
+		generate(ctx, c, &body)
+
+		r := release.NewRelease(c.Version, c.Tag, body.String())
+		r.Draft = r.Draft || c.Draft
+		r.Prerelease = r.Prerelease || c.Prerelease
+		r.Assets = c.Asset
+
+		publisher, err := newPublisher(c, c.PublishTo, c.Repo)
+		if err != nil {
+			exitOnError(err)
+		}
+		if err := publisher.Publish(ctx, r); err != nil {
+			exitOnError(err)
+		}
+	},
+}
+
+var publishers = []string{
+	"github",
+	"gitlab",
+	"tag",
+}
+
+// newPublisher returns the publisher by name, inferring it from the host of
+// the repository URL if name is empty. Self-hosted instances are found in the
+// `hosts` table, and other hosts get an annotated tag.
+func newPublisher(c *config.Config, name, repo string) (release.Publisher, error) {
+	if name == "" {
+		_, hosts, err := getLinkStyles(c)
+		if err != nil {
+			return nil, err
+		}
+		name = "tag"
+		style, _ := hosts.Style(repo)
+		switch style {
+		case linkStyle.Github:
+			name = "github"
+		case linkStyle.Gitlab:
+			name = "gitlab"
+		}
+	}
+
+	switch name {
+	case "github":
+		return release.NewGithubPublisher(repo, c.Token), nil
+	case "gitlab":
+		return release.NewGitlabPublisher(repo, c.Token, c.To), nil
+	case "tag":
+		querier := newQuerier(c, changelog.QueryFilter{})
+		if isLocalProvider(c.Provider) {
+			// The pure-Go reader can't write, so tags are made with git
+			querier = changelog.NewLocalQuerier(c.GitDir, c.WorkTree, changelog.QueryFilter{})
+		}
+		tagger, ok := querier.(changelog.Tagger)
+		if !ok {
+			return nil, fmt.Errorf("Publisher tag is not supported by the %s provider, it can't create tags", c.Provider)
+		}
+		return release.NewTagPublisher(tagger, c.To, c.Push), nil
+	}
+	return nil, fmt.Errorf("Publisher %s not found! Must be one of %s", name, strings.Join(publishers, ", "))
+}
+
+func init() {
+	RootCmd.AddCommand(releaseCmd)
+
+	releaseCmd.Flags().String("tag", "", "The tag to release. Defaults to --version")
+	releaseCmd.Flags().Bool("draft", false, "Set to true to publish the release as a draft")
+	releaseCmd.Flags().Bool("prerelease", false, "Set to true to mark the release as a prerelease")
+	releaseCmd.Flags().String("publish-to", "", fmt.Sprintf("Where to publish the release. Must be one of %s. Inferred from --repo if not set", strings.Join(publishers, ", ")))
+	releaseCmd.Flags().Bool("push", false, "Set to true to push the annotated tag to origin. Only applies to tag publisher")
+	releaseCmd.Flags().StringSlice("asset", []string{}, "A file to upload with the release. May be repeated")
+	viper.BindPFlags(releaseCmd.Flags())
+}
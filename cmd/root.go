@@ -1,14 +1,22 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/config"
 	"github.com/skuid/changelog/src/linkStyle"
+	"github.com/skuid/changelog/src/transport"
 	"github.com/skuid/changelog/src/writer"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
@@ -17,13 +25,19 @@ import (
 
 var providers = []string{
 	"local",
+	"local-native",
 	"github",
+	"gitea",
+	"azure",
 }
 
 var (
 	subtitle          = flag.String("subtitle", "", "The release subtitle")
 	changelogFile     = flag.String("changelog", "", "The file to write. Defaults to STDOUT if not set.")
 	fromLatestTag     = flag.Bool("from-latest-tag", false, "If you use tags, set to true to get changes from latest tag.")
+	tagPrefix         = flag.String("tag-prefix", "", "Only consider tags starting with the prefix for the latest tag, like 'pkg-a/'")
+	tagPattern        = flag.String("tag-pattern", "", "Only consider tags matching the glob for the latest tag, like 'v[0-9]*'")
+	ignorePrereleases = flag.Bool("ignore-prereleases", false, "Set to true to skip tags with semver pre-release versions when finding the latest tag")
 	fromCommit        = flag.StringP("from", "f", "", "The beginning commit. Defaults to beginning of the repository history")
 	toCommit          = flag.StringP("to", "t", "HEAD", "The last commit.")
 	sinceTime         = flag.String("since", "", "Show commits more recent than a specific date. Use RFC3339 time '2017-08-01T00:00:00Z'. Takes precedence over to/from.")
@@ -31,13 +45,24 @@ var (
 	version           = flag.StringP("version", "v", "", "The version you are creating")
 	repoLink          = flag.StringP("repo", "r", "", "The repository URL. Defaults to `$(git remote get-url origin)` if using a local provider")
 	includeAllCommits = flag.Bool("include-all", false, "Set to true to include all commits in the changelog. Commit messages that cannot be parsed will be placed in a section titled \"Unknown\".")
+	paths             = flag.StringSlice("path", []string{}, "Only include commits that change the path, relative to the root of the repository. May be repeated")
+	packageName       = flag.String("package", "", "Only generate the changelog for the named package from the packages table")
+	timeout           = flag.Duration("timeout", 0, "How long to wait for git and API calls before giving up, like '30s' or '5m'. Waits forever if not set")
+	contributors      = flag.Bool("contributors", false, "Set to true to add a Contributors section listing everyone who authored commits in the changelog.")
+	linkStyleName     = flag.String("link-style", "", "The style of links to commits, issues and pull requests, one of the built-in styles or a style from the link-styles table. Inferred from --repo if not set")
+	merges            = flag.String("merges", "", fmt.Sprintf("Which merge commits to include. Must be one of %s. Includes every merge if not set", mergePolicies()))
+	mergeCloses       = flag.Bool("merge-closes", false, "Set to true to add the pull request number of 'Merge pull request #12 from ...' commits to what they close.")
+	keepDuplicates    = flag.Bool("keep-duplicates", false, "Set to true to keep reverted commits, their reverts, and cherry-picks of commits already in the changelog.")
+
+	groupBy = flag.String("group-by", "commits", fmt.Sprintf(`How to assign commits to sections. Must be one of %s. "labels" uses the labels of the pull request each commit was merged in. "pull-requests" uses one entry per merged pull request instead of per commit. "labels" only applies to github provider, and "pull-requests" to github, gitea and azure providers`, strings.Join(groupings, ", ")))
 
 	provider = flag.StringP("provider", "p", "local", fmt.Sprintf(`The provider to use. Must be one of %s`, strings.Join(providers, ", ")))
 
-	token = flag.String("token", "", "API token for remote provider. Only applies to github provider")
+	token    = flag.String("token", "", "API token for remote provider, or a personal access token for azure. Only applies to github, gitea and azure providers")
+	cacheDir = flag.String("cache-dir", "", "A directory to cache API responses and commits in between runs. Only applies to github provider and extended configuration URLs")
 
-	gitDir   = flag.String("git-dir", "", "The path to the git directory. If no '--repo' is set, defaults to `$(pwd)/.git`. Only applies to local provider")
-	workTree = flag.String("work-tree", "", "The path to the directory containing the .git directory. Only applies to local provider.")
+	gitDir   = flag.String("git-dir", "", "The path to the git directory. If no '--repo' is set, defaults to `$(pwd)/.git`. Only applies to local providers")
+	workTree = flag.String("work-tree", "", "The path to the directory containing the .git directory. Only applies to local providers.")
 
 	// outfile = flagSet.String("outfile", "", "") // TODO to maintain clog compatibility
 	// infile = flagSet.String("infile", "", "") // TODO to maintain clog compatibility
@@ -46,6 +71,12 @@ var (
 	// debug = flagSet.Bool("debug", false, "Set to output debug logging")
 )
 
+var groupings = []string{
+	"commits",
+	"labels",
+	"pull-requests",
+}
+
 func validateProvider(provider string) error {
 	for i := range providers {
 		if provider == providers[i] {
@@ -55,126 +86,615 @@ func validateProvider(provider string) error {
 	return fmt.Errorf("Provider %s not found! Must be one of %s", provider, strings.Join(providers, ", "))
 }
 
+// newContext returns the context for a run of the CLI, which is cancelled
+// after --timeout if it is set
+func newContext() (context.Context, context.CancelFunc) {
+	if timeout := readConfig().Timeout; timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// readConfig returns the settings of the flags, `CHANGELOG_` environment
+// variables and configuration files read so far
+func readConfig() *config.Config {
+	// AllSettings would split keys containing dots, like the hosts table's
+	all := map[string]interface{}{}
+	for _, key := range config.Keys() {
+		all[key] = viper.Get(key)
+	}
+	c, err := config.Decode(all)
+	if err != nil {
+		exitOnError(err)
+	}
+	return c
+}
+
+// isLocalProvider reports whether the provider reads a repository on disk
+func isLocalProvider(provider string) bool {
+	return provider == "local" || provider == "local-native"
+}
+
+// mergePolicies lists the valid values of --merges
+func mergePolicies() string {
+	policies := []string{}
+	for _, policy := range changelog.MergePolicies {
+		policies = append(policies, string(policy))
+	}
+	return strings.Join(policies, ", ")
+}
+
+func validateMerges(merges string) error {
+	if merges == "" {
+		return nil
+	}
+	for _, policy := range changelog.MergePolicies {
+		if merges == string(policy) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Merge policy %s not found! Must be one of %s", merges, mergePolicies())
+}
+
+func validateGroupBy(groupBy, provider string) error {
+	for i := range groupings {
+		if groupBy != groupings[i] {
+			continue
+		}
+		if groupBy == "labels" && provider != "github" {
+			return fmt.Errorf("Grouping by %s is only supported by the github provider", groupBy)
+		}
+		if groupBy == "pull-requests" && provider != "github" && provider != "gitea" && provider != "azure" {
+			return fmt.Errorf("Grouping by %s is only supported by the github, gitea and azure providers", groupBy)
+		}
+		return nil
+	}
+	return fmt.Errorf("Grouping %s not found! Must be one of %s", groupBy, strings.Join(groupings, ", "))
+}
+
 func exitOnError(err error) {
 	fmt.Printf("Fatal Error: %s", err.Error())
 	os.Exit(1)
 }
 
-// RootCmd represents the base command when called without any subcommands
-var RootCmd = &cobra.Command{
-	Use:   "changelog",
-	Short: "Generate a Clog changelog",
-	// Uncomment the following line if your bare application
-	// has an action associated with it:
-	Run: func(cmd *cobra.Command, args []string) {
-		if err := validateProvider(viper.GetString("provider")); err != nil {
-			exitOnError(err)
-		}
+// errNoPackagePaths is returned for packages with no paths within `--path`
+var errNoPackagePaths = errors.New("no paths within --path")
 
-		var style linkStyle.Style
-		var querier changelog.Querier
+// packageFilter returns the filter for the commits and tags of a package. If
+// `--path` is set, only the parts of the package within it are included.
+func packageFilter(c *config.Config, p config.Package) (changelog.QueryFilter, error) {
+	paths := p.Paths
+	if filter := c.Path; len(filter) > 0 {
+		var err error
+		if paths, err = intersectPaths(p.Paths, filter); err != nil {
+			return changelog.QueryFilter{}, err
+		}
+		if len(paths) == 0 {
+			return changelog.QueryFilter{}, errNoPackagePaths
+		}
+	}
+	return changelog.QueryFilter{
+		Paths:             paths,
+		TagPrefix:         p.TagPrefix,
+		TagPattern:        c.TagPattern,
+		IgnorePrereleases: c.IgnorePrereleases,
+		Merges:            changelog.MergePolicy(c.Merges),
+	}, nil
+}
 
-		switch viper.GetString("provider") {
-		case "github":
-			style = linkStyle.Github
-			querier = changelog.NewGithubQuerier(viper.GetString("repo"), viper.GetString("token"))
-		default:
-			querier = changelog.NewLocalQuerier(viper.GetString("git-dir"), viper.GetString("work-tree"))
-			repo := viper.GetString("repo")
-			if len(repo) == 0 {
-				repo, err := querier.GetOrigin()
-				if err != nil {
-					exitOnError(err)
-				}
-				viper.Set("repo", repo)
-			}
-			style = linkStyle.InferStyle(repo)
+// intersectPaths returns the paths that are within both sets of paths. A
+// path is within another if it is the same path or below it. Pathspecs with
+// magic, like `:(glob)`, can't be intersected.
+func intersectPaths(first, second []string) ([]string, error) {
+	clean := func(path string) (string, error) {
+		if strings.HasPrefix(path, ":") {
+			return "", fmt.Errorf("Path %s can't be combined with the paths of a package", path)
 		}
+		return strings.Trim(filepath.ToSlash(filepath.Clean(path)), "/"), nil
+	}
+	within := func(path, parent string) bool {
+		return parent == "." || path == parent || strings.HasPrefix(path, parent+"/")
+	}
 
-		// Read in the `.clog.toml` file of the repo we're using
-		if config, err := querier.GetConfig(); err == nil {
-			err := viper.ReadConfig(config)
+	paths := []string{}
+	for _, a := range first {
+		a, err := clean(a)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range second {
+			b, err := clean(b)
 			if err != nil {
-				exitOnError(err)
+				return nil, err
+			}
+			switch {
+			case within(a, b):
+				paths = append(paths, a)
+			case within(b, a):
+				paths = append(paths, b)
 			}
 		}
+	}
+	return paths, nil
+}
+
+// getTrackers returns the configured issue trackers, sorted by name
+func getTrackers(c *config.Config) ([]changelog.Tracker, error) {
+	configs := c.Trackers
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	trackers := []changelog.Tracker{}
+	for _, name := range names {
+		tracker, err := changelog.NewTracker(name, configs[name].Pattern, configs[name].URL)
+		if err != nil {
+			return nil, err
+		}
+		trackers = append(trackers, tracker)
+	}
+	return trackers, nil
+}
 
-		c := changelog.ChangeLog{
-			Repo:     viper.GetString("repo"),
-			Version:  viper.GetString("version"),
-			Subtitle: viper.GetString("subtitle"),
+// getProcessors returns the processors of the `processors` array, in order
+func getProcessors(c *config.Config) ([]changelog.Processor, error) {
+	processors := []changelog.Processor{}
+	for i, settings := range c.Processors {
+		name, _ := settings["type"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("Processor %d has no type! Must be one of %s", i+1, changelog.SupportedProcessors())
+		}
+		options := map[string]interface{}{}
+		for key, value := range settings {
+			if key != "type" {
+				options[key] = value
+			}
+		}
+		processor, err := changelog.NewProcessor(name, options)
+		if err != nil {
+			return nil, err
 		}
+		processors = append(processors, processor)
+	}
+	return processors, nil
+}
+
+// getPackages returns the configured packages, or only the package named by
+// `--package` if it is set
+func getPackages(c *config.Config) (map[string]config.Package, error) {
+	packages := c.Packages
+	if packages == nil {
+		packages = map[string]config.Package{}
+	}
+
+	name := c.Package
+	if name == "" {
+		return packages, nil
+	}
+	pkg, ok := packages[name]
+	if !ok {
+		return nil, fmt.Errorf("Package %s not found in the packages table", name)
+	}
+	return map[string]config.Package{name: pkg}, nil
+}
 
-		sectionAliasMap := changelog.MergeSectionAliasMaps(
-			changelog.NewSectionAliasMap(),
-			viper.GetStringMapStringSlice("sections"),
+// getQueryFilter returns the filter from `--path`, or from `--package` if it
+// is set
+func getQueryFilter(c *config.Config) changelog.QueryFilter {
+	filter := changelog.QueryFilter{
+		Paths:             c.Path,
+		TagPrefix:         c.TagPrefix,
+		TagPattern:        c.TagPattern,
+		IgnorePrereleases: c.IgnorePrereleases,
+		Merges:            changelog.MergePolicy(c.Merges),
+	}
+	if c.Package == "" {
+		return filter
+	}
+	packages, err := getPackages(c)
+	if err != nil {
+		exitOnError(err)
+	}
+	filter, err = packageFilter(c, packages[c.Package])
+	if err != nil {
+		exitOnError(errors.Wrapf(err, "Package %s", c.Package))
+	}
+	return filter
+}
+
+func getSectionAliasMap(c *config.Config) changelog.SectionAliasMap {
+	sections := changelog.MergeSectionAliasMaps(
+		changelog.NewSectionAliasMap(),
+		c.Sections,
+	)
+	if c.GroupBy == "labels" {
+		// Pull requests are placed by their labels, and commits that weren't
+		// merged through a pull request keep the section of their prefix
+		changelog.MergeSectionAliasMaps(
+			sections,
+			changelog.NewLabelAliasMap(),
+			c.Labels,
 		)
-		var commits changelog.Commits
+	}
+	return sections
+}
 
-		if len(viper.GetString("since")) > 0 || len(viper.GetString("until")) > 0 {
-			if viper.GetString("until") == "" {
-				viper.Set("until", time.Now().Format(time.RFC3339))
-			}
-			if viper.GetString("since") == "" {
-				viper.Set("since", time.Unix(1, 0).Format(time.RFC3339))
+// getKeywords returns the issue reference keywords of the `keywords` table.
+// They replace the defaults rather than adding to them, so a keyword like
+// "fix" can be dropped. An empty list is no keywords, rather than the
+// defaults.
+func getKeywords(c *config.Config) changelog.Keywords {
+	return changelog.Keywords(c.Keywords)
+}
+
+// getLinkStyles returns the styles of the `link-styles` table, and the hosts
+// of self-hosted providers from the `hosts` table
+func getLinkStyles(c *config.Config) (linkStyle.Styles, linkStyle.Hosts, error) {
+	styles := linkStyle.Styles{}
+	for name, templates := range c.LinkStyles {
+		styles[linkStyle.Style(name)] = templates
+	}
+	hosts := linkStyle.Hosts{}
+	for host, name := range c.Hosts {
+		style, err := styles.Parse(name)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Host %s", host)
+		}
+		hosts[host] = style
+	}
+	if c.LinkStyle != "" {
+		if _, err := styles.Parse(c.LinkStyle); err != nil {
+			return nil, nil, err
+		}
+	}
+	return styles, hosts, nil
+}
+
+func getStyle(c *config.Config, hosts linkStyle.Hosts) linkStyle.Style {
+	if c.LinkStyle != "" {
+		return linkStyle.Style(c.LinkStyle)
+	}
+	switch c.Provider {
+	case "github":
+		return linkStyle.Github
+	case "gitea":
+		return linkStyle.Gitea
+	case "azure":
+		return linkStyle.AzureDevOps
+	}
+	return hosts.Infer(c.Repo)
+}
+
+// newQuerier returns a querier for the configured provider
+func newQuerier(c *config.Config, filter changelog.QueryFilter) changelog.Querier {
+	switch c.Provider {
+	case "github":
+		var querier changelog.Querier
+		if c.GroupBy == "labels" {
+			querier = changelog.NewGithubLabelQuerier(c.Repo, c.Token, getSectionAliasMap(c), filter)
+		} else {
+			querier = changelog.NewGithubQuerier(c.Repo, c.Token, filter)
+		}
+		if dir := c.CacheDir; dir != "" {
+			scope := fmt.Sprintf("%s %q %s", c.Repo, filter.Paths, filter.Merges)
+			querier = changelog.NewCachedQuerier(querier, dir, scope)
+		}
+		return querier
+	case "gitea":
+		return changelog.NewGiteaQuerier(c.Repo, c.Token, filter)
+	case "azure":
+		return changelog.NewAzureQuerier(c.Repo, c.Token, filter)
+	case "local-native":
+		return changelog.NewNativeQuerier(c.GitDir, c.WorkTree, filter)
+	default:
+		return changelog.NewLocalQuerier(c.GitDir, c.WorkTree, filter)
+	}
+}
+
+// closeQuerier releases what a querier holds open, like the pack files of the
+// local-native provider
+func closeQuerier(querier changelog.Querier) {
+	if closer, ok := querier.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// newExtender returns the Extender of the configuration files named by
+// `extends`. Local files and, for local providers, repositories are paths
+// relative to the work tree. HTTP responses are revalidated from --cache-dir.
+func newExtender(c *config.Config) *config.Extender {
+	client := transport.NewClient()
+	if dir := c.CacheDir; dir != "" {
+		client = transport.NewCachingClient(dir)
+	}
+	dir := c.WorkTree
+	if dir == "" {
+		dir = "."
+	}
+	return &config.Extender{
+		Client: client,
+		Dir:    dir,
+		Repository: func(ref string) (changelog.Querier, error) {
+			filter := changelog.QueryFilter{}
+			switch provider := c.Provider; provider {
+			case "github":
+				return changelog.NewGithubQuerier(ref, c.Token, filter), nil
+			case "gitea":
+				return changelog.NewGiteaQuerier(ref, c.Token, filter), nil
+			case "azure":
+				return changelog.NewAzureQuerier(ref, c.Token, filter), nil
+			default:
+				if !filepath.IsAbs(ref) {
+					ref = filepath.Join(dir, ref)
+				}
+				if info, err := os.Stat(ref); err != nil || !info.IsDir() {
+					return nil, fmt.Errorf("%s is not a configuration file or repository", ref)
+				}
+				if provider == "local-native" {
+					return changelog.NewNativeQuerier(filepath.Join(ref, ".git"), ref, filter), nil
+				}
+				return changelog.NewLocalQuerier(filepath.Join(ref, ".git"), ref, filter), nil
 			}
+		},
+	}
+}
+
+// setup validates the flags and reads in the configuration of the repository,
+// returning the settings they make up
+func setup(ctx context.Context) *config.Config {
+	c := readConfig()
+	if err := validateProvider(c.Provider); err != nil {
+		exitOnError(err)
+	}
+	if err := validateGroupBy(c.GroupBy, c.Provider); err != nil {
+		exitOnError(err)
+	}
+
+	querier := newQuerier(c, changelog.QueryFilter{})
+	defer closeQuerier(querier)
+	if isLocalProvider(c.Provider) && len(c.Repo) == 0 {
+		repo, err := querier.GetOrigin(ctx)
+		if err != nil {
+			exitOnError(err)
+		}
+		viper.Set("repo", repo)
+		c.Repo = repo
+	}
 
-			until, err := time.Parse(time.RFC3339, viper.GetString("until"))
+	// Read in the configuration file of the repo we're using, like `.clog.toml`
+	r, err := querier.GetConfig(ctx)
+	if err != nil && !changelog.IsNoConfig(err) {
+		exitOnError(err)
+	}
+	if err == nil {
+		contents, err := ioutil.ReadAll(r)
+		if err != nil {
+			exitOnError(err)
+		}
+		// Settings of the files it extends are merged in
+		file := &changelog.ConfigFile{Reader: bytes.NewReader(contents), Path: changelog.ConfigPath(r)}
+		if err := newExtender(c).Read(ctx, viper.GetViper(), file); err != nil {
+			exitOnError(errors.Wrapf(err, "Could not read %s", file.Path))
+		}
+		warnIgnoredSettings(file.Path, file.Type(), contents)
+		c = readConfig()
+	}
+
+	// The merge policy may come from the config file
+	if err := validateMerges(c.Merges); err != nil {
+		exitOnError(err)
+	}
+
+	// The trackers and link styles are checked before anything is written
+	if _, err := getTrackers(c); err != nil {
+		exitOnError(err)
+	}
+	if _, _, err := getLinkStyles(c); err != nil {
+		exitOnError(err)
+	}
+	return c
+}
+
+// RootCmd represents the base command when called without any subcommands
+var RootCmd = &cobra.Command{
+	Use:   "changelog",
+	Short: "Generate a Clog changelog",
+	// Uncomment the following line if your bare application
+	// has an action associated with it:
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := newContext()
+		defer cancel()
+		c := setup(ctx)
+
+		packages, err := getPackages(c)
+		if err != nil {
+			exitOnError(err)
+		}
+		if len(packages) == 0 {
+			querier := newQuerier(c, getQueryFilter(c))
+			defer closeQuerier(querier)
+			err := writeOutput(c.Changelog, func(w io.Writer) {
+				writeChangelog(ctx, c, querier, c.Version, w)
+			})
 			if err != nil {
 				exitOnError(err)
 			}
+			return
+		}
 
-			since, err := time.Parse(time.RFC3339, viper.GetString("since"))
+		names := []string{}
+		filters := map[string]changelog.QueryFilter{}
+		stdout := 0
+		for name, pkg := range packages {
+			filter, err := packageFilter(c, pkg)
+			if err == errNoPackagePaths && c.Package == "" {
+				fmt.Fprintf(os.Stderr, "Skipping package %s, it has %s\n", name, err)
+				continue
+			}
 			if err != nil {
-				exitOnError(err)
+				exitOnError(errors.Wrapf(err, "Package %s", name))
+			}
+			names = append(names, name)
+			filters[name] = filter
+			if pkg.Changelog == "" {
+				stdout++
 			}
+		}
+		sort.Strings(names)
 
-			commits, err = querier.GetCommitRange(since, until)
-			if err != nil {
-				exitOnError(errors.Wrap(err, "Could not get list of commits"))
+		// Each package gets its own changelog from its own latest tag
+		for _, name := range names {
+			pkg := packages[name]
+			version := pkg.Version
+			if version == "" {
+				version = c.Version
 			}
-		} else {
-			if viper.GetBool("from-latest-tag") {
-				version, err := querier.GetLatestTag()
-				if err != nil {
-					exitOnError(errors.Wrap(err, "Could not get latest tag revision"))
+			querier := newQuerier(c, filters[name])
+			err := writeOutput(repoPath(c, pkg.Changelog), func(w io.Writer) {
+				// Packages written to STDOUT together are told apart by
+				// their names
+				if pkg.Changelog == "" && stdout > 1 {
+					fmt.Fprintf(w, "# %s\n\n", name)
 				}
-				viper.Set("from", version)
-			}
-			var err error
-			commits, err = querier.GetCommits(viper.GetString("from"), viper.GetString("to"))
+				writeChangelog(ctx, c, querier, version, w)
+			})
+			closeQuerier(querier)
 			if err != nil {
-				exitOnError(errors.Wrap(err, "Could not get list of commits"))
+				exitOnError(errors.Wrapf(err, "Could not write changelog for package %s", name))
 			}
 		}
+	},
+}
 
-		// Filter out commits if we're not including all
-		if !viper.GetBool("include-all") {
-			commits = changelog.FilterCommits(
-				commits,
-				sectionAliasMap.Grep(),
-				viper.GetBool("include-all"),
-			)
-			// Set the proper CommitType on each commit from the sectionAliasMap
-			commits = changelog.FormatCommits(commits, sectionAliasMap)
-		} else {
-			// Use all commits
-			commits = changelog.TitleCommitType(commits, sectionAliasMap)
-		}
+// repoPath resolves a path relative to the repository's work tree, if using a
+// local provider with a different work tree
+func repoPath(c *config.Config, path string) string {
+	if path == "" || filepath.IsAbs(path) || !isLocalProvider(c.Provider) {
+		return path
+	}
+	if workTree := c.WorkTree; workTree != "" {
+		return filepath.Join(workTree, path)
+	}
+	if gitDir := c.GitDir; gitDir != "" {
+		return filepath.Join(filepath.Dir(gitDir), path)
+	}
+	return path
+}
 
-		sectionMap := changelog.NewSectionMap(commits)
+// writeOutput writes the changelog to STDOUT if path is empty. Otherwise the
+// changelog is prepended to the file at path, which is created if needed.
+func writeOutput(path string, write func(io.Writer)) error {
+	if path == "" {
+		write(os.Stdout)
+		return nil
+	}
 
-		// If we have an `order` key, use it to set the order on the sectionMap
-		if order := viper.GetStringSlice("order"); len(order) > 0 {
-			sectionMap.SetOrder(order)
-		}
+	var out bytes.Buffer
+	write(&out)
+
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	if len(existing) > 0 {
+		out.WriteString("\n")
+		out.Write(existing)
+	}
+	return errors.WithStack(ioutil.WriteFile(path, out.Bytes(), 0644))
+}
 
-		w := writer.MarkdownWriter{Writer: os.Stdout}
-		err := w.Generate(c, style, sectionMap)
+// generate writes the changelog for the configured provider and range to out
+func generate(ctx context.Context, c *config.Config, out io.Writer) {
+	querier := newQuerier(c, getQueryFilter(c))
+	defer closeQuerier(querier)
+	writeChangelog(ctx, c, querier, c.Version, out)
+}
+
+// generateOptions returns the options for generating the changelog of the
+// querier's commits from the flags and configuration
+func generateOptions(c *config.Config, querier changelog.Querier, version string) (changelog.Options, error) {
+	styles, hosts, err := getLinkStyles(c)
+	if err != nil {
+		return changelog.Options{}, err
+	}
+	trackers, err := getTrackers(c)
+	if err != nil {
+		return changelog.Options{}, err
+	}
+	opts := changelog.Options{
+		Querier:        querier,
+		Repo:           c.Repo,
+		Style:          getStyle(c, hosts),
+		LinkStyles:     styles,
+		Hosts:          hosts,
+		Keywords:       getKeywords(c),
+		Trackers:       trackers,
+		Version:        version,
+		Subtitle:       c.Subtitle,
+		From:           c.From,
+		To:             c.To,
+		FromLatestTag:  c.FromLatestTag,
+		Tag:            c.Tag,
+		Sections:       getSectionAliasMap(c),
+		Order:          c.Order,
+		IncludeAll:     c.IncludeAll,
+		GroupBy:        changelog.GroupBy(c.GroupBy),
+		MergeCloses:    c.MergeCloses,
+		KeepDuplicates: c.KeepDuplicates,
+		Contributors:   c.Contributors,
+	}
+	for _, t := range []struct {
+		value string
+		time  *time.Time
+	}{{c.Since, &opts.Since}, {c.Until, &opts.Until}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
 		if err != nil {
-			panic(err)
+			return opts, err
 		}
-	},
+		*t.time = parsed
+	}
+	processors, err := getProcessors(c)
+	if err != nil {
+		return opts, err
+	}
+	opts.Processors = processors
+	return opts, nil
+}
+
+// writeChangelog writes the changelog for the querier's commits to out,
+// listing the duplicate and reverted commits it leaves out on stderr
+func writeChangelog(ctx context.Context, c *config.Config, querier changelog.Querier, version string, out io.Writer) {
+	opts, err := generateOptions(c, querier, version)
+	if err != nil {
+		exitOnError(err)
+	}
+	release, err := changelog.Generate(ctx, opts)
+	if changelog.IsNoMatchingTag(err) {
+		// Before the first release, the changelog covers the whole history
+		fmt.Fprintf(os.Stderr, "%s, starting from the first commit\n", errors.Cause(err))
+		opts.FromLatestTag = false
+		release, err = changelog.Generate(ctx, opts)
+	}
+	if err != nil {
+		exitOnError(err)
+	}
+
+	if len(release.Dropped) > 0 {
+		fmt.Fprintf(os.Stderr, "Removed %d duplicate or reverted commits:\n", len(release.Dropped))
+		for _, d := range release.Dropped {
+			fmt.Fprintf(os.Stderr, "  %s\n", d)
+		}
+	}
+
+	w := writer.MarkdownWriter{Writer: out}
+	if err := w.Write(release); err != nil {
+		exitOnError(err)
+	}
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -190,12 +710,22 @@ func init() {
 	cobra.OnInitialize(initConfig)
 }
 
-// initConfig reads in config file and ENV variables if set.
+// initConfig reads in config file and ENV variables if set. The first of the
+// ConfigFiles in the working directory is read in its own format.
 func initConfig() {
 	viper.SetEnvPrefix("changelog")
 	viper.AutomaticEnv()
-	viper.SetConfigName(".clog.toml")
-	viper.SetConfigType("toml")
 	viper.BindPFlags(flag.CommandLine)
-	viper.ReadInConfig()
+
+	r, err := changelog.NewLocalQuerier("", "", changelog.QueryFilter{}).GetConfig(context.Background())
+	if changelog.IsNoConfig(err) {
+		return
+	}
+	if err != nil {
+		exitOnError(err)
+	}
+	viper.SetConfigType(changelog.ConfigType(r))
+	if err := viper.ReadConfig(r); err != nil {
+		exitOnError(errors.Wrapf(err, "Could not read %s", changelog.ConfigPath(r)))
+	}
 }
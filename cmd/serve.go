@@ -3,8 +3,11 @@ package cmd
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/skuid/changelog/webhooks/azure"
+	"github.com/skuid/changelog/webhooks/gitea"
 	"github.com/skuid/changelog/webhooks/github"
 	"github.com/skuid/spec"
 	"github.com/skuid/spec/lifecycle"
@@ -23,15 +26,23 @@ var serveCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		l, _ := spec.NewStandardLogger()
 		zap.ReplaceGlobals(l)
+		c := readConfig()
+		if c.Secret == "" {
+			zap.L().Fatal("a --secret is required to verify webhook requests")
+		}
 		var webhookHandler http.Handler
 
-		switch viper.GetString("provider") {
+		switch c.Provider {
 		case "github":
-			webhookHandler = github.New(viper.GetString("secret"), viper.GetString("token"))
+			webhookHandler = github.New(c.Secret, c.Token, c.RequestTimeout)
+		case "azure":
+			webhookHandler = azure.New(c.Secret, c.Token, c.RequestTimeout)
+		case "gitea":
+			webhookHandler = gitea.New(c.Secret, c.Token, c.RequestTimeout)
 		default:
 			zap.L().Fatal(
-				fmt.Sprintf("webhook for provider %s isn't supported", viper.GetString("provider")),
-				zap.String("provider", viper.GetString("provider")),
+				fmt.Sprintf("webhook for provider %s isn't supported", c.Provider),
+				zap.String("provider", c.Provider),
 			)
 		}
 
@@ -48,12 +59,14 @@ var serveCmd = &cobra.Command{
 		internalMux.HandleFunc("/ready", lifecycle.ReadinessHandler)
 
 		server := &http.Server{
-			Addr:    fmt.Sprintf(":%d", viper.GetInt("port")),
-			Handler: internalMux,
+			Addr:         fmt.Sprintf(":%d", c.Port),
+			Handler:      internalMux,
+			ReadTimeout:  c.RequestTimeout,
+			WriteTimeout: c.RequestTimeout,
 		}
 		lifecycle.ShutdownOnTerm(server)
 
-		zap.L().Info("starting changelog webhook server", zap.Int("port", viper.GetInt("port")))
+		zap.L().Info("starting changelog webhook server", zap.Int("port", c.Port))
 		if err := server.ListenAndServe(); err != http.ErrServerClosed {
 			zap.L().Fatal(err.Error())
 		}
@@ -64,7 +77,8 @@ var serveCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(serveCmd)
 
-	serveCmd.Flags().StringP("secret", "s", "", "webhook secret")
+	serveCmd.Flags().StringP("secret", "s", "", "webhook secret, required to verify requests")
 	serveCmd.Flags().IntP("port", "n", 3000, "webhook server port")
+	serveCmd.Flags().Duration("request-timeout", time.Minute, "deadline for reading each request, writing its response and validating its commits. Zero means no deadline")
 	viper.BindPFlags(serveCmd.Flags())
 }
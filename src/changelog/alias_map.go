@@ -21,6 +21,28 @@ func NewSectionAliasMap() SectionAliasMap {
 	return sectionAliasMap
 }
 
+// NewLabelAliasMap returns the default map of pull request labels to sections
+func NewLabelAliasMap() SectionAliasMap {
+	labelAliasMap := make(SectionAliasMap)
+	labelAliasMap["Features"] = []string{"enhancement", "feature"}
+	labelAliasMap["Bug Fixes"] = []string{"bug"}
+	labelAliasMap["Performance"] = []string{"performance"}
+	labelAliasMap["Breaking Changes"] = []string{"breaking"}
+	return labelAliasMap
+}
+
+// Has reports whether the alias belongs to any section
+func (s SectionAliasMap) Has(alias string) bool {
+	for _, aliases := range s {
+		for i := range aliases {
+			if aliases[i] == alias {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // SectionFor returns the section title for a given alias
 func (s SectionAliasMap) SectionFor(alias string) string {
 	for title, aliases := range s {
@@ -0,0 +1,92 @@
+package changelog
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// mailmapRegex matches a `.mailmap` line, capturing the proper name and email
+// and optionally the name and email used in commits
+var mailmapRegex = regexp.MustCompile(`^([^<]*?)\s*<([^>]*)>\s*(?:([^<]*?)\s*<([^>]*)>)?\s*$`)
+
+type authorAlias struct {
+	properName  string
+	properEmail string
+	commitName  string
+	commitEmail string
+}
+
+// AuthorAliasMap maps the names and emails authors have used in commits to a
+// single canonical identity, following the `.mailmap` format used by git
+type AuthorAliasMap []authorAlias
+
+// ParseAuthorAliasMap reads a `.mailmap` formatted file. Blank lines and
+// comments starting with `#` are ignored.
+func ParseAuthorAliasMap(r io.Reader) (AuthorAliasMap, error) {
+	aliases := AuthorAliasMap{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		match := mailmapRegex.FindStringSubmatch(line)
+		if match == nil {
+			return nil, errors.Errorf("invalid mailmap line %q", line)
+		}
+		alias := authorAlias{
+			properName:  match[1],
+			properEmail: match[2],
+			commitName:  match[3],
+			commitEmail: match[4],
+		}
+		if alias.commitEmail == "" {
+			// `Proper Name <commit@email>` only replaces the name
+			alias.commitEmail = alias.properEmail
+			alias.properEmail = ""
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, errors.WithStack(scanner.Err())
+}
+
+// Canonical returns the canonical identity for a commit author. Entries that
+// match on both name and email take precedence over entries that only match
+// on email.
+func (a AuthorAliasMap) Canonical(p Person) Person {
+	var found *authorAlias
+	for i := range a {
+		if !strings.EqualFold(a[i].commitEmail, p.Email) {
+			continue
+		}
+		if a[i].commitName == "" {
+			if found == nil {
+				found = &a[i]
+			}
+			continue
+		}
+		if a[i].commitName == p.Name {
+			found = &a[i]
+			break
+		}
+	}
+	if found == nil {
+		return p
+	}
+	if found.properName != "" {
+		p.Name = found.properName
+	}
+	if found.properEmail != "" {
+		p.Email = found.properEmail
+	}
+	return p
+}
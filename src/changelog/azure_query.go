@@ -0,0 +1,533 @@
+package changelog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/remote"
+	"github.com/skuid/changelog/src/transport"
+)
+
+const (
+	// azureAPIVersion is the Azure DevOps REST API version requested
+	azureAPIVersion = "7.0"
+	// azurePageSize is the number of commits and pull requests listed at once
+	azurePageSize = 100
+)
+
+type azureQuerier struct {
+	repo   string
+	apiURL string
+	token  string
+	filter QueryFilter
+	client *http.Client
+}
+
+// NewAzureQuerier queries Azure DevOps Repos for commits, authenticating with
+// a personal access token. The repository URL is its web URL, like
+// `https://dev.azure.com/org/project/_git/repo`, or a clone URL.
+func NewAzureQuerier(repo, token string, filter QueryFilter) Querier {
+	a := azureQuerier{repo: repo, token: token, filter: filter, client: transport.NewClient()}
+	a.apiURL = AzureAPIURL(repo)
+	return a
+}
+
+// AzureAPIURL returns the Git API URL of an Azure DevOps repository, like
+// `https://dev.azure.com/org/project/_apis/git/repositories/repo`, or an empty
+// string if the URL isn't a repository URL
+func AzureAPIURL(repo string) string {
+	u, err := remote.Parse(repo)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s/%s/_apis/git/repositories/%s", u.Scheme, u.Host, u.Owner, url.PathEscape(u.Repo))
+}
+
+type azureCommit struct {
+	CommitID string `json:"commitId"`
+	Comment  string `json:"comment"`
+	// CommentTruncated is set when the comment in a list is shortened
+	CommentTruncated bool `json:"commentTruncated"`
+	Author           struct {
+		Name  string    `json:"name"`
+		Email string    `json:"email"`
+		Date  time.Time `json:"date"`
+	} `json:"author"`
+	Committer struct {
+		Date time.Time `json:"date"`
+	} `json:"committer"`
+	Parents []string `json:"parents"`
+}
+
+func (c azureCommit) commit() *Commit {
+	commit := NewCommit(c.CommitID, c.Comment)
+	if commit == nil {
+		return nil
+	}
+	commit.Author = Person{
+		Name:  c.Author.Name,
+		Email: c.Author.Email,
+	}
+	return commit
+}
+
+type azurePullRequest struct {
+	PullRequestID   int       `json:"pullRequestId"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	ClosedDate      time.Time `json:"closedDate"`
+	LastMergeCommit struct {
+		CommitID string `json:"commitId"`
+	} `json:"lastMergeCommit"`
+	CreatedBy struct {
+		DisplayName string `json:"displayName"`
+	} `json:"createdBy"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+}
+
+// commit parses the pull request title and description as if it were a
+// commit message
+func (p azurePullRequest) commit() *Commit {
+	body := strings.Replace(p.Description, "\r\n", "\n", -1)
+	commit := NewCommit(p.LastMergeCommit.CommitID, fmt.Sprintf("%s\n\n%s", p.Title, body))
+	if commit == nil {
+		return nil
+	}
+	commit.Author = Person{Name: p.CreatedBy.DisplayName}
+	commit.PullRequest = &PullRequest{Number: p.PullRequestID, Title: p.Title}
+	for _, label := range p.Labels {
+		commit.PullRequest.Labels = append(commit.PullRequest.Labels, label.Name)
+	}
+	return commit
+}
+
+// get sends a GET request for a path of the repository's API, decoding the
+// response into v. The response headers are returned for continuation tokens.
+func (a azureQuerier) get(ctx context.Context, path string, params url.Values, v interface{}) (http.Header, error) {
+	body, header, err := a.getRaw(ctx, path, params)
+	if err != nil {
+		return nil, err
+	}
+	return header, errors.Wrapf(json.Unmarshal(body, v), "Could not decode %s", path)
+}
+
+func (a azureQuerier) getRaw(ctx context.Context, path string, params url.Values) ([]byte, http.Header, error) {
+	if a.apiURL == "" {
+		return nil, nil, errors.Errorf("%s is not an Azure DevOps repository URL", a.repo)
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("api-version", azureAPIVersion)
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s?%s", a.apiURL, path, params.Encode()), nil)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	if a.token != "" {
+		// Personal access tokens are sent as the password, with no user
+		req.SetBasicAuth("", a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, errors.WithStack(&statusError{path: path, code: resp.StatusCode, body: strings.TrimSpace(string(body))})
+	}
+	return body, resp.Header, nil
+}
+
+// versionOf returns the version and version type identifying a revision in
+// API requests. An empty version is the default branch.
+func (a azureQuerier) versionOf(ctx context.Context, rev string) (string, string, error) {
+	switch {
+	case rev == "" || rev == "HEAD":
+		return "", "", nil
+	case fullHashRegex.MatchString(rev):
+		return rev, "commit", nil
+	}
+	name := strings.TrimPrefix(rev, "refs/tags/")
+	var refs struct {
+		Value []struct {
+			Name string `json:"name"`
+		} `json:"value"`
+	}
+	if _, err := a.get(ctx, "/refs", url.Values{"filter": {"tags/" + name}}, &refs); err != nil {
+		return "", "", err
+	}
+	for _, ref := range refs.Value {
+		if ref.Name == "refs/tags/"+name {
+			return name, "tag", nil
+		}
+	}
+	return strings.TrimPrefix(rev, "refs/heads/"), "branch", nil
+}
+
+// listCommits returns the page of commits listed with the search criteria
+// after skipping the first skip
+func (a azureQuerier) listCommits(ctx context.Context, params url.Values, skip int) ([]azureCommit, error) {
+	params.Set("searchCriteria.$top", strconv.Itoa(azurePageSize))
+	params.Set("searchCriteria.$skip", strconv.Itoa(skip))
+	var commits struct {
+		Value []azureCommit `json:"value"`
+	}
+	_, err := a.get(ctx, "/commits", params, &commits)
+	return commits.Value, err
+}
+
+// eachCommit calls fn with each commit listed with the search criteria, a page
+// at a time
+func (a azureQuerier) eachCommit(ctx context.Context, params url.Values, fn func(azureCommit) error) error {
+	for skip := 0; ; skip += azurePageSize {
+		commits, err := a.listCommits(ctx, params, skip)
+		if err != nil {
+			return err
+		}
+		for _, commit := range commits {
+			if commit.CommentTruncated {
+				// Lists shorten long messages, which hides their footers
+				full, err := a.getCommit(ctx, commit.CommitID)
+				if err != nil {
+					return err
+				}
+				commit.Comment = full.Comment
+			}
+			if err := fn(commit); err != nil {
+				return err
+			}
+		}
+		if len(commits) < azurePageSize {
+			return nil
+		}
+	}
+}
+
+// azurePathFilter keeps the commits that change at least one of the filtered
+// paths. The API only takes one path, so the history of each path is listed
+// alongside the commits, a page at a time, only as far back as the commit
+// being checked.
+type azurePathFilter struct {
+	a       azureQuerier
+	cursors []*azurePathCursor
+	touched map[string]bool
+}
+
+type azurePathCursor struct {
+	params url.Values
+	skip   int
+	// oldest is the date of the last commit listed so far
+	oldest time.Time
+	done   bool
+}
+
+// newPathFilter returns a filter for commits listed with the search criteria
+func (a azureQuerier) newPathFilter(params url.Values) *azurePathFilter {
+	f := &azurePathFilter{a: a, touched: map[string]bool{}}
+	for _, path := range a.filter.Paths {
+		pathParams := url.Values{}
+		for key, values := range params {
+			pathParams[key] = append([]string{}, values...)
+		}
+		pathParams.Set("searchCriteria.itemPath", "/"+strings.Trim(path, "/"))
+		f.cursors = append(f.cursors, &azurePathCursor{params: pathParams})
+	}
+	return f
+}
+
+// keep reports whether the commit changes any of the filtered paths
+func (f *azurePathFilter) keep(ctx context.Context, c azureCommit) (bool, error) {
+	if len(f.cursors) == 0 {
+		return true, nil
+	}
+	date := c.Committer.Date
+	for _, cursor := range f.cursors {
+		for !cursor.done && (cursor.oldest.IsZero() || !cursor.oldest.Before(date)) {
+			pathCommits, err := f.a.listCommits(ctx, cursor.params, cursor.skip)
+			if err != nil {
+				return false, err
+			}
+			for _, pathCommit := range pathCommits {
+				f.touched[pathCommit.CommitID] = true
+				cursor.oldest = pathCommit.Committer.Date
+			}
+			cursor.done = len(pathCommits) < azurePageSize
+			cursor.skip += azurePageSize
+		}
+	}
+	return f.touched[c.CommitID], nil
+}
+
+func (a azureQuerier) getCommit(ctx context.Context, sha string) (azureCommit, error) {
+	var commit azureCommit
+	_, err := a.get(ctx, "/commits/"+url.PathEscape(sha), nil, &commit)
+	return commit, err
+}
+
+// resolve returns the SHA of a revision
+func (a azureQuerier) resolve(ctx context.Context, rev string) (string, error) {
+	if fullHashRegex.MatchString(rev) {
+		return rev, nil
+	}
+	params, err := a.rangeParams(ctx, rev)
+	if err != nil {
+		return "", err
+	}
+	params.Set("searchCriteria.$top", "1")
+	var commits struct {
+		Value []azureCommit `json:"value"`
+	}
+	if _, err := a.get(ctx, "/commits", params, &commits); err != nil {
+		return "", err
+	}
+	if len(commits.Value) == 0 {
+		return "", errors.Errorf("Revision %s not found", rev)
+	}
+	return commits.Value[0].CommitID, nil
+}
+
+// rangeParams returns the search criteria listing the history of a revision
+func (a azureQuerier) rangeParams(ctx context.Context, rev string) (url.Values, error) {
+	params := url.Values{}
+	version, versionType, err := a.versionOf(ctx, rev)
+	if err != nil {
+		return nil, err
+	}
+	if version != "" {
+		params.Set("searchCriteria.itemVersion.version", version)
+		params.Set("searchCriteria.itemVersion.versionType", versionType)
+	}
+	return params, nil
+}
+
+// eachRangeCommit calls fn with each commit in the range that changes one of
+// the filtered paths, newest first. A `from..to` range is listed by comparing
+// the versions, so it holds the commits reachable from `to` and not from
+// `from`, whatever their dates.
+func (a azureQuerier) eachRangeCommit(ctx context.Context, r CommitRange, fn func(azureCommit) error) error {
+	params := url.Values{}
+	if r.byDate() {
+		if !r.Since.IsZero() {
+			params.Set("searchCriteria.fromDate", r.Since.Format(time.RFC3339))
+		}
+		if !r.Until.IsZero() {
+			params.Set("searchCriteria.toDate", r.Until.Format(time.RFC3339))
+		}
+	} else {
+		var err error
+		if params, err = a.rangeParams(ctx, r.to()); err != nil {
+			return err
+		}
+		if r.From != "" {
+			version, versionType, err := a.versionOf(ctx, r.From)
+			if err != nil {
+				return err
+			}
+			params.Set("searchCriteria.compareVersion.version", version)
+			params.Set("searchCriteria.compareVersion.versionType", versionType)
+		}
+	}
+
+	paths := a.newPathFilter(params)
+	return a.eachCommit(ctx, params, func(c azureCommit) error {
+		keep, err := paths.keep(ctx, c)
+		if err != nil || !keep {
+			return err
+		}
+		return fn(c)
+	})
+}
+
+func (a azureQuerier) GetOrigin(ctx context.Context) (string, error) {
+	return a.repo, nil
+}
+
+func (a azureQuerier) GetCommits(ctx context.Context, from, to string) (Commits, error) {
+	return collectCommits(ctx, a, CommitRange{From: from, To: to})
+}
+
+func (a azureQuerier) GetCommitRange(ctx context.Context, since, until time.Time) (Commits, error) {
+	return collectCommits(ctx, a, CommitRange{Since: since, Until: until})
+}
+
+// ForEachCommit lists commits a page at a time
+func (a azureQuerier) ForEachCommit(ctx context.Context, r CommitRange, fn CommitFunc) error {
+	merges := &mergeFilter{policy: a.filter.Merges}
+	err := a.eachRangeCommit(ctx, r, func(c azureCommit) error {
+		if !merges.keep(c.CommitID, c.Parents) {
+			return nil
+		}
+		commit := c.commit()
+		if commit == nil {
+			return nil
+		}
+		return fn(*commit)
+	})
+	if err == ErrStopIteration {
+		return nil
+	}
+	return err
+}
+
+// GetPullRequests returns a commit for each completed pull request whose merge
+// commit is between `from` and `to`. The commit is parsed from the pull
+// request title, and its description is searched for closes and breaks
+// references.
+func (a azureQuerier) GetPullRequests(ctx context.Context, from, to string) (Commits, error) {
+	// Only the SHAs are kept to match against merge commits
+	shas := map[string]bool{}
+	var oldest time.Time
+	err := a.eachRangeCommit(ctx, CommitRange{From: from, To: to}, func(c azureCommit) error {
+		shas[c.CommitID] = true
+		if date := c.Committer.Date; oldest.IsZero() || date.Before(oldest) {
+			oldest = date
+		}
+		return nil
+	})
+	if err != nil || len(shas) == 0 {
+		return Commits{}, err
+	}
+
+	commits := Commits{}
+	params := url.Values{}
+	params.Set("searchCriteria.status", "completed")
+	params.Set("$top", strconv.Itoa(azurePageSize))
+	for skip := 0; ; skip += azurePageSize {
+		params.Set("$skip", strconv.Itoa(skip))
+		var pulls struct {
+			Value []azurePullRequest `json:"value"`
+		}
+		if _, err := a.get(ctx, "/pullrequests", params, &pulls); err != nil {
+			return nil, err
+		}
+		for _, pull := range pulls.Value {
+			if !shas[pull.LastMergeCommit.CommitID] {
+				continue
+			}
+			if commit := pull.commit(); commit != nil {
+				commits = append(commits, *commit)
+			}
+		}
+		if len(pulls.Value) < azurePageSize {
+			return commits, nil
+		}
+		// Completed pull requests are listed newest first, so once we're past
+		// the oldest commit there's nothing left to find
+		if last := pulls.Value[len(pulls.Value)-1]; !oldest.IsZero() && last.ClosedDate.Before(oldest) {
+			return commits, nil
+		}
+	}
+}
+
+func (a azureQuerier) GetLatestCommit(ctx context.Context) (string, error) {
+	return a.resolve(ctx, "HEAD")
+}
+
+// GetTags returns every tag in the repository, with annotated tags peeled to
+// their commits
+func (a azureQuerier) GetTags(ctx context.Context) ([]Tag, error) {
+	tags := []Tag{}
+	params := url.Values{}
+	params.Set("filter", "tags/")
+	params.Set("peelTags", "true")
+	for {
+		var refs struct {
+			Value []struct {
+				Name           string `json:"name"`
+				ObjectID       string `json:"objectId"`
+				PeeledObjectID string `json:"peeledObjectId"`
+			} `json:"value"`
+		}
+		header, err := a.get(ctx, "/refs", params, &refs)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs.Value {
+			commit := ref.ObjectID
+			if ref.PeeledObjectID != "" {
+				commit = ref.PeeledObjectID
+			}
+			tags = append(tags, Tag{Name: strings.TrimPrefix(ref.Name, "refs/tags/"), Commit: commit})
+		}
+		token := header.Get("X-Ms-Continuationtoken")
+		if token == "" {
+			return tags, nil
+		}
+		params.Set("continuationToken", token)
+	}
+}
+
+// IsAncestor reports whether commit is part of the history of `to`, which is
+// when it is the common commit of the two
+func (a azureQuerier) IsAncestor(ctx context.Context, commit, to string) (bool, error) {
+	base, err := a.resolve(ctx, commit)
+	if err != nil {
+		return false, err
+	}
+	version, versionType, err := a.versionOf(ctx, to)
+	if err != nil {
+		return false, err
+	}
+	params := url.Values{}
+	params.Set("baseVersion", base)
+	params.Set("baseVersionType", "commit")
+	if version != "" {
+		params.Set("targetVersion", version)
+		params.Set("targetVersionType", versionType)
+	}
+	params.Set("$top", "0")
+	var diff struct {
+		CommonCommit string `json:"commonCommit"`
+	}
+	if _, err := a.get(ctx, "/diffs/commits", params, &diff); err != nil {
+		return false, err
+	}
+	return diff.CommonCommit == base, nil
+}
+
+// GetLatestTag returns the commit of the latest tag reachable from `to`
+func (a azureQuerier) GetLatestTag(ctx context.Context, to string) (string, error) {
+	tag, err := LatestTag(ctx, a, a.filter, to)
+	return tag.Commit, err
+}
+
+// GetLatestTagVersion returns the name of the latest tag reachable from `to`
+func (a azureQuerier) GetLatestTagVersion(ctx context.Context, to string) (string, error) {
+	tag, err := LatestTag(ctx, a, a.filter, to)
+	return tag.Name, err
+}
+
+func (a azureQuerier) GetConfig(ctx context.Context) (io.Reader, error) {
+	return findConfig(ctx, a.GetFile)
+}
+
+// GetFile returns a file from the default branch
+func (a azureQuerier) GetFile(ctx context.Context, path string) (io.Reader, error) {
+	params := url.Values{}
+	params.Set("path", "/"+strings.TrimPrefix(path, "/"))
+	params.Set("$format", "octetStream")
+	body, _, err := a.getRaw(ctx, "/items", params)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(body), nil
+}
@@ -0,0 +1,297 @@
+package changelog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const azureRepoPath = "/org/project/_apis/git/repositories/repo"
+
+// newTestAzureQuerier returns an azureQuerier pointed at a local stand-in for
+// the Azure DevOps API
+func newTestAzureQuerier(t *testing.T, mux *http.ServeMux, filter QueryFilter) (azureQuerier, func()) {
+	t.Helper()
+	server := httptest.NewServer(mux)
+	a := NewAzureQuerier(server.URL+"/org/project/_git/repo", "pat", filter).(azureQuerier)
+	return a, server.Close
+}
+
+func TestAzureAPIURL(t *testing.T) {
+	cases := []struct {
+		repo string
+		want string
+	}{
+		{"https://dev.azure.com/org/project/_git/repo", "https://dev.azure.com/org/project/_apis/git/repositories/repo"},
+		{"https://org@dev.azure.com/org/project/_git/repo", "https://dev.azure.com/org/project/_apis/git/repositories/repo"},
+		{"git@ssh.dev.azure.com:v3/org/project/repo", "https://dev.azure.com/org/project/_apis/git/repositories/repo"},
+		{"https://org.visualstudio.com/project/_git/repo", "https://org.visualstudio.com/project/_apis/git/repositories/repo"},
+		{"not a url", ""},
+	}
+	for _, c := range cases {
+		if got := AzureAPIURL(c.repo); got != c.want {
+			t.Errorf("AzureAPIURL(%q)!\nExpected\n\t%s\nGot\n\t%s", c.repo, c.want, got)
+		}
+	}
+}
+
+func TestAzureForEachCommit(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(azureRepoPath+"/refs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value": [{"name": "refs/tags/v1.0.0", "objectId": "ccc"}]}`)
+	})
+	mux.HandleFunc(azureRepoPath+"/commits/aaa", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"commitId": "aaa", "comment": "fix(api): a thing\n\nCloses AB#3"}`)
+	})
+	mux.HandleFunc(azureRepoPath+"/commits", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "" || pass != "pat" {
+			t.Errorf("Expected the token as the password, got %q %q", user, pass)
+		}
+		if got := r.URL.Query().Get("api-version"); got != azureAPIVersion {
+			t.Errorf("Expected API version %s, got %q", azureAPIVersion, got)
+		}
+		query := r.URL.Query()
+		if query.Get("searchCriteria.compareVersion.version") != "v1.0.0" || query.Get("searchCriteria.compareVersion.versionType") != "tag" {
+			t.Errorf("Expected the range to be compared with the v1.0.0 tag, got %v", query)
+		}
+		switch {
+		case query.Get("searchCriteria.itemPath") == "/api":
+			fmt.Fprint(w, `{"value": [{"commitId": "aaa"}, {"commitId": "bbb"}]}`)
+		default:
+			fmt.Fprint(w, `{"value": [
+				{"commitId": "aaa", "comment": "fix(api): a thing", "commentTruncated": true, "author": {"name": "Ann", "email": "ann@example.com"}, "parents": ["bbb"]},
+				{"commitId": "bbb", "comment": "Merged PR 2: other", "parents": ["x", "y"]},
+				{"commitId": "ddd", "comment": "docs: readme", "parents": ["ccc"]}
+			]}`)
+		}
+	})
+
+	a, closer := newTestAzureQuerier(t, mux, QueryFilter{Paths: []string{"api"}, Merges: ExcludeMerges})
+	defer closer()
+
+	commits, err := a.GetCommits(context.Background(), "v1.0.0", "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(commits) != 1 {
+		t.Fatalf("Expected 1 commit, got %d: %+v", len(commits), commits)
+	}
+	want := NewCommit("aaa", "fix(api): a thing\n\nCloses AB#3")
+	want.Author = Person{Name: "Ann", Email: "ann@example.com"}
+	if !reflect.DeepEqual(commits[0], *want) {
+		t.Errorf("Expected %+v, got %+v", *want, commits[0])
+	}
+	if !reflect.DeepEqual(commits[0].Closes, []string{"AB#3"}) {
+		t.Errorf("Expected the truncated message to be fetched, got closes %v", commits[0].Closes)
+	}
+}
+
+func TestAzureForEachCommitMergedBranch(t *testing.T) {
+	// v1.0.0 is ccc. The side branch merged by mmm was started before it, so
+	// sss is dated before the tag, and aaa is an ancestor of the tag committed
+	// after it.
+	type node struct {
+		date    string
+		message string
+		parents []string
+	}
+	graph := map[string]node{
+		"mmm": {"2017-08-05T00:00:00Z", "Merged PR 3: side", []string{"fff", "sss"}},
+		"fff": {"2017-08-04T00:00:00Z", "feat: after the tag", []string{"ccc"}},
+		"ccc": {"2017-08-02T00:00:00Z", "feat: tagged", []string{"aaa"}},
+		"aaa": {"2017-08-03T00:00:00Z", "feat: rebased before the tag", []string{"eee"}},
+		"sss": {"2017-08-01T00:00:00Z", "feat: side branch", []string{"eee"}},
+		"eee": {"2017-07-01T00:00:00Z", "feat: first", nil},
+	}
+	ancestors := func(sha string) map[string]bool {
+		seen := map[string]bool{}
+		queue := []string{sha}
+		for len(queue) > 0 {
+			c := queue[0]
+			queue = queue[1:]
+			if !seen[c] {
+				seen[c] = true
+				queue = append(queue, graph[c].parents...)
+			}
+		}
+		return seen
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(azureRepoPath+"/refs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value": [{"name": "refs/tags/v1.0.0", "objectId": "ccc"}]}`)
+	})
+	mux.HandleFunc(azureRepoPath+"/commits", func(w http.ResponseWriter, r *http.Request) {
+		// The commits reachable from the item version and not from the
+		// compare version, newest first
+		query := r.URL.Query()
+		reachable := ancestors("mmm")
+		if query.Get("searchCriteria.compareVersion.version") == "v1.0.0" {
+			for sha := range ancestors("ccc") {
+				delete(reachable, sha)
+			}
+		}
+		shas := []string{}
+		for sha := range reachable {
+			shas = append(shas, sha)
+		}
+		sort.Slice(shas, func(i, j int) bool { return graph[shas[i]].date > graph[shas[j]].date })
+		commits := []string{}
+		for _, sha := range shas {
+			parents, _ := json.Marshal(graph[sha].parents)
+			commits = append(commits, fmt.Sprintf(`{"commitId": %q, "comment": %q, "committer": {"date": %q}, "parents": %s}`, sha, graph[sha].message, graph[sha].date, parents))
+		}
+		fmt.Fprintf(w, `{"value": [%s]}`, strings.Join(commits, ","))
+	})
+
+	a, closer := newTestAzureQuerier(t, mux, QueryFilter{Merges: ExcludeMerges})
+	defer closer()
+
+	commits, err := a.GetCommits(context.Background(), "v1.0.0", "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	got := []string{}
+	for _, c := range commits {
+		got = append(got, c.Hash)
+	}
+	if want := []string{"fff", "sss"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected commits %v, got %v", want, got)
+	}
+}
+
+func TestAzureGetTags(t *testing.T) {
+	older, newer := strings.Repeat("a", 40), strings.Repeat("b", 40)
+	mux := http.NewServeMux()
+	mux.HandleFunc(azureRepoPath+"/refs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("continuationToken") == "" {
+			w.Header().Set("X-Ms-Continuationtoken", "next")
+			fmt.Fprintf(w, `{"value": [{"name": "refs/tags/v1.0.0", "objectId": "tagobject", "peeledObjectId": %q}]}`, older)
+			return
+		}
+		fmt.Fprintf(w, `{"value": [{"name": "refs/tags/v2.0.0", "objectId": %q}]}`, newer)
+	})
+	mux.HandleFunc(azureRepoPath+"/diffs/commits", func(w http.ResponseWriter, r *http.Request) {
+		// v2.0.0 is on another branch, so the common commit is older
+		common := r.URL.Query().Get("baseVersion")
+		if common == newer {
+			common = older
+		}
+		fmt.Fprintf(w, `{"commonCommit": %q}`, common)
+	})
+
+	a, closer := newTestAzureQuerier(t, mux, QueryFilter{})
+	defer closer()
+
+	tags, err := a.GetTags(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	want := []Tag{{Name: "v1.0.0", Commit: older}, {Name: "v2.0.0", Commit: newer}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("Expected %v, got %v", want, tags)
+	}
+
+	version, err := a.GetLatestTagVersion(context.Background(), "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if version != "v1.0.0" {
+		t.Errorf("Expected the reachable tag v1.0.0, got %s", version)
+	}
+}
+
+func TestAzureGetPullRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(azureRepoPath+"/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value": [{"commitId": "aaa", "comment": "Merged PR 1: Add a thing"}]}`)
+	})
+	mux.HandleFunc(azureRepoPath+"/pullrequests", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("searchCriteria.status"); got != "completed" {
+			t.Errorf("Expected completed pull requests, got %q", got)
+		}
+		fmt.Fprint(w, `{"value": [
+			{"pullRequestId": 2, "title": "feat: elsewhere", "lastMergeCommit": {"commitId": "zzz"}},
+			{"pullRequestId": 1, "title": "feat(api): add a thing", "description": "Fixes AB#5", "lastMergeCommit": {"commitId": "aaa"}, "createdBy": {"displayName": "Ann"}, "labels": [{"name": "enhancement"}]}
+		]}`)
+	})
+
+	a, closer := newTestAzureQuerier(t, mux, QueryFilter{})
+	defer closer()
+
+	commits, err := a.GetPullRequests(context.Background(), "", "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(commits) != 1 {
+		t.Fatalf("Expected 1 pull request, got %d", len(commits))
+	}
+	got := commits[0]
+	want := &PullRequest{Number: 1, Title: "feat(api): add a thing", Labels: []string{"enhancement"}}
+	if !reflect.DeepEqual(got.PullRequest, want) {
+		t.Errorf("Expected pull request %v, got %v", want, got.PullRequest)
+	}
+	if got.Subject != "add a thing" || !reflect.DeepEqual(got.Closes, []string{"AB#5"}) || got.Author.Name != "Ann" {
+		t.Errorf("Pull request not parsed, got %+v", got)
+	}
+}
+
+func TestAzureGetPullRequestsStops(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(azureRepoPath+"/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value": [{"commitId": "aaa", "committer": {"date": "2017-08-02T00:00:00Z"}}]}`)
+	})
+	mux.HandleFunc(azureRepoPath+"/pullrequests", func(w http.ResponseWriter, r *http.Request) {
+		if skip := r.URL.Query().Get("$skip"); skip != "0" {
+			t.Errorf("Expected paging to stop at pull requests older than the commits, got $skip=%s", skip)
+		}
+		pulls := []string{}
+		for i := azurePageSize; i > 0; i-- {
+			pulls = append(pulls, fmt.Sprintf(`{"pullRequestId": %d, "title": "feat: thing %d", "closedDate": "2017-08-01T00:00:00Z", "lastMergeCommit": {"commitId": "%d"}}`, i, i, i))
+		}
+		fmt.Fprintf(w, `{"value": [%s]}`, strings.Join(pulls, ","))
+	})
+
+	a, closer := newTestAzureQuerier(t, mux, QueryFilter{})
+	defer closer()
+
+	commits, err := a.GetPullRequests(context.Background(), "", "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(commits) != 0 {
+		t.Errorf("Expected no pull requests, got %d", len(commits))
+	}
+}
+
+func TestAzureGetConfig(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(azureRepoPath+"/items", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") != "/.clog.toml" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "[sections]\n")
+	})
+
+	a, closer := newTestAzureQuerier(t, mux, QueryFilter{})
+	defer closer()
+
+	config, err := a.GetConfig(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if raw, _ := ioutil.ReadAll(config); string(raw) != "[sections]\n" {
+		t.Errorf("Expected the config file, got %q", raw)
+	}
+	if _, err := a.GetFile(context.Background(), "missing.toml"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package changelog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// fullHashRegex matches a full commit SHA, the only kind of revision that
+// can't move
+var fullHashRegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// httpCacher is implemented by queriers whose API responses can be cached on
+// disk and revalidated with ETags
+type httpCacher interface {
+	withHTTPCache(dir string) Querier
+}
+
+// mutableQuerier is implemented by queriers whose commits may change after
+// they are fetched, so their ranges can't be stored
+type mutableQuerier interface {
+	mutableCommits() bool
+}
+
+type cachedQuerier struct {
+	Querier
+	dir   string
+	scope string
+}
+
+// NewCachedQuerier wraps a querier with an on-disk cache in dir. Commits are
+// stored by SHA, and the commits between two revisions are reused as long as
+// both revisions still resolve to the same SHAs. Tags and HEAD are resolved
+// again on every run, so a moved tag or new commit is picked up, and
+// revisions that can't be resolved, like branches, are never cached. Queriers
+// that make API requests also revalidate list responses with ETags. The scope
+// separates the entries of different repositories and of queriers whose
+// results differ for the same repository, like ones filtering by path.
+func NewCachedQuerier(querier Querier, dir, scope string) Querier {
+	if h, ok := querier.(httpCacher); ok {
+		querier = h.withHTTPCache(dir)
+	}
+	return cachedQuerier{querier, dir, scope}
+}
+
+// cachedCommit is the stored form of a commit. Only what the querier read is
+// stored, the message is parsed again when it's loaded, so changes to the
+// settings of parsing, like the issue keywords or trackers, apply to cached
+// commits too.
+type cachedCommit struct {
+	Hash        string
+	Message     string
+	Author      Person
+	PullRequest *PullRequest
+}
+
+func newCachedCommit(c Commit) cachedCommit {
+	return cachedCommit{c.Hash, c.message, c.Author, c.PullRequest}
+}
+
+func (c cachedCommit) commit() Commit {
+	commit := NewCommit(c.Hash, c.Message)
+	commit.Author = c.Author
+	commit.PullRequest = c.PullRequest
+	return *commit
+}
+
+// GetCommits returns the commits between two revisions, from the cache if
+// possible
+func (c cachedQuerier) GetCommits(ctx context.Context, from, to string) (Commits, error) {
+	return collectCommits(ctx, c, CommitRange{From: from, To: to})
+}
+
+// ForEachCommit calls fn with each commit in range, reading them from the
+// cache if the range was fetched before
+func (c cachedQuerier) ForEachCommit(ctx context.Context, r CommitRange, fn CommitFunc) error {
+	// Dates don't pin down a set of commits, since history can be pushed
+	// with old dates, and commits with mutable details can't be reused
+	if m, ok := c.Querier.(mutableQuerier); r.byDate() || (ok && m.mutableCommits()) {
+		return c.Querier.ForEachCommit(ctx, r, fn)
+	}
+
+	key, ok, err := c.rangeKey(ctx, r)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.Querier.ForEachCommit(ctx, r, fn)
+	}
+
+	if commits, ok := c.loadRange(key); ok {
+		for _, commit := range commits {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(commit); err != nil {
+				if err == ErrStopIteration {
+					return nil
+				}
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Only a range that was read to the end can be reused
+	hashes := []string{}
+	complete := true
+	err = c.Querier.ForEachCommit(ctx, r, func(commit Commit) error {
+		c.store(filepath.Join("commits", c.scopeKey(commit.Hash)), newCachedCommit(commit))
+		hashes = append(hashes, commit.Hash)
+		err := fn(commit)
+		if err != nil {
+			complete = false
+		}
+		return err
+	})
+	if err == nil && complete {
+		c.store(filepath.Join("ranges", key), hashes)
+	}
+	return err
+}
+
+// IsAncestor reports whether commit is part of the history of to. The answer
+// for two SHAs never changes, so it is cached.
+func (c cachedQuerier) IsAncestor(ctx context.Context, commit, to string) (bool, error) {
+	if !fullHashRegex.MatchString(commit) || !fullHashRegex.MatchString(to) {
+		return c.Querier.IsAncestor(ctx, commit, to)
+	}
+
+	path := filepath.Join("ancestors", c.scopeKey(commit, to))
+	var ancestor bool
+	if c.load(path, &ancestor) {
+		return ancestor, nil
+	}
+	ancestor, err := c.Querier.IsAncestor(ctx, commit, to)
+	if err != nil {
+		return false, err
+	}
+	c.store(path, ancestor)
+	return ancestor, nil
+}
+
+// rangeKey returns the cache key for a range, or false if either end can't be
+// resolved to a SHA
+func (c cachedQuerier) rangeKey(ctx context.Context, r CommitRange) (string, bool, error) {
+	var tags map[string]string
+	resolve := func(rev string) (string, bool, error) {
+		if fullHashRegex.MatchString(rev) {
+			return rev, true, nil
+		}
+		if rev == "HEAD" {
+			latest, err := c.Querier.GetLatestCommit(ctx)
+			if err != nil {
+				return "", false, err
+			}
+			return latest, fullHashRegex.MatchString(latest), nil
+		}
+		if tags == nil {
+			list, err := c.Querier.GetTags(ctx)
+			if err != nil {
+				return "", false, err
+			}
+			tags = map[string]string{}
+			for _, tag := range list {
+				tags[tag.Name] = tag.Commit
+			}
+		}
+		name := strings.TrimPrefix(rev, "refs/tags/")
+		sha, ok := tags[name]
+		return sha, ok && fullHashRegex.MatchString(sha), nil
+	}
+
+	to, ok, err := resolve(r.to())
+	if err != nil || !ok {
+		return "", false, err
+	}
+	from := ""
+	if r.From != "" {
+		if from, ok, err = resolve(r.From); err != nil || !ok {
+			return "", false, err
+		}
+	}
+	return c.scopeKey(from, to), true, nil
+}
+
+// loadRange reads the commits of a cached range, or returns false if the range
+// or any of its commits is missing
+func (c cachedQuerier) loadRange(key string) (Commits, bool) {
+	var hashes []string
+	if !c.load(filepath.Join("ranges", key), &hashes) {
+		return nil, false
+	}
+	commits := make(Commits, 0, len(hashes))
+	for _, hash := range hashes {
+		var commit cachedCommit
+		// Commits cached without their message are fetched again
+		if !c.load(filepath.Join("commits", c.scopeKey(hash)), &commit) || commit.Message == "" {
+			return nil, false
+		}
+		commits = append(commits, commit.commit())
+	}
+	return commits, true
+}
+
+// scopeKey hashes parts of a key together with the querier's scope, so entries
+// from different repositories and settings don't collide
+func (c cachedQuerier) scopeKey(parts ...string) string {
+	key := sha256.New()
+	fmt.Fprintf(key, "%q", append([]string{c.scope}, parts...))
+	return hex.EncodeToString(key.Sum(nil))
+}
+
+func (c cachedQuerier) load(path string, v interface{}) bool {
+	raw, err := ioutil.ReadFile(filepath.Join(c.dir, path))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+// store writes a cache entry. A cache that can't be written is only slower, so
+// errors are ignored
+func (c cachedQuerier) store(path string, v interface{}) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	path = filepath.Join(c.dir, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err == nil {
+		os.Rename(tmp, path)
+	}
+}
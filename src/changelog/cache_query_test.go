@@ -0,0 +1,129 @@
+package changelog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countingQuerier serves fixed commits and tags, counting the calls that
+// reach it
+type countingQuerier struct {
+	Querier
+	commits   Commits
+	tags      []Tag
+	head      string
+	fetches   int
+	ancestors int
+}
+
+func (q *countingQuerier) ForEachCommit(ctx context.Context, r CommitRange, fn CommitFunc) error {
+	q.fetches++
+	for _, c := range q.commits {
+		if err := fn(c); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *countingQuerier) GetLatestCommit(ctx context.Context) (string, error) {
+	return q.head, nil
+}
+
+func (q *countingQuerier) GetTags(ctx context.Context) ([]Tag, error) {
+	return q.tags, nil
+}
+
+func (q *countingQuerier) IsAncestor(ctx context.Context, commit, to string) (bool, error) {
+	q.ancestors++
+	return true, nil
+}
+
+func TestCachedQuerier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changelog-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sha := func(c string) string { return strings.Repeat(c, 40) }
+	commit := NewCommit(sha("b"), "feat(cache): store commits\n\nCloses #5")
+	commit.Author = Person{"Jane", "jane@example.com"}
+	underlying := &countingQuerier{
+		commits: Commits{*commit, *NewCommit(sha("a"), "fix: first")},
+		tags:    []Tag{{Name: "v1.0.0", Commit: sha("a")}},
+		head:    sha("b"),
+	}
+	q := NewCachedQuerier(underlying, dir, "repo")
+	ctx := context.Background()
+
+	cases := []struct {
+		desc    string
+		from    string
+		fetches int
+	}{
+		{"first run", "v1.0.0", 1},
+		{"cached", "v1.0.0", 1},
+		{"cached by SHA", sha("a"), 1},
+		{"branches aren't cached", "master", 2},
+		{"branches still aren't cached", "master", 3},
+	}
+	for _, c := range cases {
+		got, err := q.GetCommits(ctx, c.from, "HEAD")
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %s", c.desc, err)
+		}
+		if !reflect.DeepEqual(got, underlying.commits) {
+			t.Errorf("%s: Expected %+v, got %+v", c.desc, underlying.commits, got)
+		}
+		if underlying.fetches != c.fetches {
+			t.Errorf("%s: Expected %d fetches, got %d", c.desc, c.fetches, underlying.fetches)
+		}
+	}
+
+	// A moved tag or new HEAD is a different range
+	underlying.tags[0].Commit = sha("c")
+	q.GetCommits(ctx, "v1.0.0", "HEAD")
+	underlying.head = sha("d")
+	q.GetCommits(ctx, "v1.0.0", "HEAD")
+	if underlying.fetches != 5 {
+		t.Errorf("Expected moved revisions to be fetched again, got %d fetches", underlying.fetches)
+	}
+
+	// Stopping early doesn't store a partial range
+	underlying.head = sha("e")
+	err = q.ForEachCommit(ctx, CommitRange{To: "HEAD"}, func(c Commit) error { return ErrStopIteration })
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	q.GetCommits(ctx, "", "HEAD")
+	if underlying.fetches != 7 {
+		t.Errorf("Expected a stopped range to be fetched again, got %d fetches", underlying.fetches)
+	}
+
+	for i := 0; i < 2; i++ {
+		if ok, err := q.IsAncestor(ctx, sha("a"), sha("b")); err != nil || !ok {
+			t.Errorf("Expected an ancestor, got %t, %v", ok, err)
+		}
+	}
+	if underlying.ancestors != 1 {
+		t.Errorf("Expected IsAncestor to be cached, got %d calls", underlying.ancestors)
+	}
+
+	// Cached messages can be parsed with other settings
+	got, err := q.GetCommits(ctx, "", "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	NewParser(Keywords{Closes: []string{"resolves"}}, nil).parseReferences(&got[0])
+	if underlying.fetches != 7 || len(got[0].Closes) != 0 || got[0].Author.Name != "Jane" {
+		t.Errorf("Expected the cached commit to be parsed again, got %+v after %d fetches", got[0], underlying.fetches)
+	}
+}
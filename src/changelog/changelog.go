@@ -2,8 +2,13 @@ package changelog
 
 // ChangeLog is a type for general configuration for producing a changelog
 type ChangeLog struct {
-	Repo         string `toml:"repo"`
-	Version      string `toml:"version"`
-	PatchVersion bool   `toml:"patch_ver"`
-	Subtitle     string `toml:"subtitle"`
+	Repo         string       `toml:"repo"`
+	Version      string       `toml:"version"`
+	PatchVersion bool         `toml:"patch_ver"`
+	Subtitle     string       `toml:"subtitle"`
+	Contributors Contributors `toml:"-"`
+	// From and To are the revisions compared by the link in the heading,
+	// usually the previous and new tags. There is no link if either is empty
+	From string `toml:"-"`
+	To   string `toml:"-"`
 }
@@ -3,35 +3,119 @@ package changelog
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/skuid/changelog/src/linkStyle"
+	"github.com/skuid/changelog/src/remote"
 )
 
 var (
 	// CommitRegex is used to parse the first line of commits
 	CommitRegex = regexp.MustCompile(`^([^:\(]+?)(?:\(([^\)]*?)?\))?:(.*)`)
-	// ClosesRegex is used to find any closes links
-	ClosesRegex = regexp.MustCompile(`(?:Closes|Fixes|Resolves)\s((?:#(\d+)(?:,\s)?)+)`)
-	// BreaksRegex is used to find any breaks links
-	BreaksRegex = regexp.MustCompile(`(?:Breaks|Broke)\s((?:#(\d+)(?:,\s)?)+)`)
+	// ReferenceRegex is used to find each issue reference after a keyword,
+	// like `#12`, `GH-12`, `owner/repo#12`, an issue URL or an Azure Boards
+	// work item `AB#12`
+	ReferenceRegex = regexp.MustCompile(`(?i)(?:https?://[^\s/]+/([\w.-]+/[\w.-]+)/(?:issues|pull)/(\d+)|\b([\w.-]+/[\w.-]+)#(\d+)|#(\d+)|\bGH-(\d+)|\bAB#(\d+))`)
 	// BreakingRegex is used to find anything that is a breaking change
 	BreakingRegex = regexp.MustCompile(`(?i:breaking)`)
+	// CoAuthorRegex is used to find any co-authors in commit trailers
+	CoAuthorRegex = regexp.MustCompile(`^(?i:co-authored-by):\s*(.*?)\s*<([^>]*)>`)
+	// RevertsRegex is used to find the commit a `git revert` commit reverts
+	RevertsRegex = regexp.MustCompile(`^This reverts commit ([0-9a-f]{40})`)
+	// MergePullRequestRegex is used to find the pull request number in the
+	// subject of a Github merge commit
+	MergePullRequestRegex = regexp.MustCompile(`^Merge pull request #(\d+) from `)
+	// CherryPickRegex is used to find the commit a `git cherry-pick -x` commit
+	// was picked from
+	CherryPickRegex = regexp.MustCompile(`^\(cherry picked from commit ([0-9a-f]{40})\)`)
 )
 
+// DefaultClosesKeywords are Github's keywords for closing issues
+var DefaultClosesKeywords = []string{"close", "closes", "closed", "fix", "fixes", "fixed", "resolve", "resolves", "resolved"}
+
+// DefaultBreaksKeywords are the keywords for referencing the issues a commit
+// breaks
+var DefaultBreaksKeywords = []string{"breaks", "broke"}
+
+// Keywords are the words before the references to issues commits close or
+// break, like `Fixes #12`. Nil keywords are the defaults, and empty ones match
+// nothing.
+type Keywords struct {
+	Closes []string `mapstructure:"closes"`
+	Breaks []string `mapstructure:"breaks"`
+}
+
+// referencePattern matches one issue reference, for NewReferenceRegex
+const referencePattern = `(?:https?://[^\s/]+/[\w.-]+/[\w.-]+/(?:issues|pull)/\d+|[\w.-]+/[\w.-]+#\d+|#\d+|GH-\d+|AB#\d+)`
+
+// NewReferenceRegex returns a regex matching any of the keywords followed by
+// a list of issue references, with Github's closing keyword grammar. Keywords
+// are matched case insensitively, may be followed by a colon, and the
+// references may be separated by commas or "and", like
+// `Fixes: #1, owner/repo#2 and GH-3`. The references are the first capture.
+func NewReferenceRegex(keywords []string) *regexp.Regexp {
+	if len(keywords) == 0 {
+		// Matches nothing
+		return regexp.MustCompile(`$.^`)
+	}
+	quoted := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		quoted[i] = regexp.QuoteMeta(keyword)
+	}
+	return regexp.MustCompile(fmt.Sprintf(
+		`(?i)\b(?:%s):?\s+(%s(?:(?:\s*,\s*|\s+and\s+|\s+)%s)*)`,
+		strings.Join(quoted, "|"), referencePattern, referencePattern,
+	))
+}
+
+// parseReferences returns each issue referenced after the keywords of regex
+// in line. References to the same repository are issue numbers, like `12`,
+// other repositories are `owner/repo#12`, and Azure Boards work items are
+// `AB#12`.
+func parseReferences(regex *regexp.Regexp, line string) []string {
+	refs := []string{}
+	for _, match := range regex.FindAllStringSubmatch(line, -1) {
+		for _, ref := range ReferenceRegex.FindAllStringSubmatch(match[1], -1) {
+			switch {
+			case ref[1] != "":
+				refs = append(refs, ref[1]+"#"+ref[2])
+			case ref[3] != "":
+				refs = append(refs, ref[3]+"#"+ref[4])
+			case ref[5] != "":
+				refs = append(refs, ref[5])
+			case ref[6] != "":
+				refs = append(refs, ref[6])
+			default:
+				refs = append(refs, boardsPrefix+ref[7])
+			}
+		}
+	}
+	return refs
+}
+
 // FilterCommits only keeps commits that are to be included in the changelog
 func FilterCommits(commits Commits, grep string, includeAll bool) Commits {
 	response := Commits{}
 
-	regex := regexp.MustCompile(grep)
+	keep := NewCommitFilter(grep, includeAll)
 	for i := range commits {
-		if includeAll || (!includeAll && regex.MatchString(commits[i].rawCommitType)) {
+		if keep(commits[i]) {
 			response = append(response, commits[i])
 		}
 	}
 	return response
 }
 
+// NewCommitFilter returns a function reporting whether FilterCommits would
+// keep a commit, for filtering commits one at a time as they are streamed
+func NewCommitFilter(grep string, includeAll bool) func(Commit) bool {
+	regex := regexp.MustCompile(grep)
+	return func(c Commit) bool {
+		return includeAll || regex.MatchString(c.rawCommitType)
+	}
+}
+
 // FormatCommits sets the CommitType on each commit from the given SectionAliasMap
 func FormatCommits(commits Commits, sectionAliasMap SectionAliasMap) Commits {
 	for i := range commits {
@@ -55,6 +139,13 @@ func TitleCommitType(commits Commits, sectionAliasMap SectionAliasMap) Commits {
 	return commits
 }
 
+// PullRequest is the pull request a commit was merged through
+type PullRequest struct {
+	Number int
+	Title  string
+	Labels []string
+}
+
 // Commit is a struct for representing a git commit
 type Commit struct {
 	Hash          string
@@ -62,47 +153,182 @@ type Commit struct {
 	Component     string
 	Closes        []string
 	Breaks        []string
+	Author        Person
+	CoAuthors     []Person
+	PullRequest   *PullRequest
 	rawCommitType string
 	CommitType    string
+	// Reverts is the commit this one reverts, from a `This reverts commit`
+	// line
+	Reverts string
+	// CherryPickOf is the commit this one was cherry-picked from, from a
+	// `(cherry picked from commit ...)` trailer
+	CherryPickOf string
+	// References are the issues in external trackers the commit mentions
+	References []Reference
+	// header is the first line of the commit message
+	header string
+	// message is the whole commit message the commit was parsed from
+	message string
+	// grouped are the messages of the commits grouped into this one, like
+	// those merged in the same pull request, whose references it keeps
+	grouped []string
 }
 
-// Summary generates a summary line for the commit used in the change log
-func (c *Commit) Summary(repo string, style linkStyle.Style) string {
-	shortHash := c.Hash[:8]
-	commitLink := style.CommitLink(c.Hash, repo)
-
-	response := fmt.Sprintf("%s ([%s](%s))", c.Subject, shortHash, commitLink)
-
-	closesLinks := []string{}
-	for _, closer := range c.Closes {
-		closesLinks = append(
-			closesLinks,
-			fmt.Sprintf("[#%s](%s)", closer, style.IssueLink(closer, repo)),
-		)
+// Summary generates a summary line for the commit used in the change log,
+// with links from the templates of the repository's link style
+func (c *Commit) Summary(repo string, links linkStyle.Templates) string {
+	var response string
+	if c.PullRequest != nil {
+		number := strconv.Itoa(c.PullRequest.Number)
+		response = fmt.Sprintf("%s (%s)", c.Subject, markdownLink("#"+number, links.PullRequestLink(number, repo)))
+	} else {
+		shortHash := c.Hash[:8]
+		commitLink := links.CommitLink(c.Hash, repo)
+		response = fmt.Sprintf("%s (%s)", c.Subject, markdownLink(shortHash, commitLink))
 	}
 
+	closesLinks := c.issueLinks(c.Closes, repo, links)
 	if len(closesLinks) > 0 {
 		response += fmt.Sprintf(", closes %s", strings.Join(closesLinks, " "))
 	}
 
-	breaksLinks := []string{}
-	for _, breaker := range c.Breaks {
-		breaksLinks = append(
-			breaksLinks,
-			fmt.Sprintf("[#%s](%s)", breaker, style.IssueLink(breaker, repo)),
-		)
-	}
+	breaksLinks := c.issueLinks(c.Breaks, repo, links)
 	if len(breaksLinks) > 0 {
 		response += fmt.Sprintf(", breaks %s", strings.Join(breaksLinks, " "))
 	}
+
+	refLinks := []string{}
+	for _, ref := range c.References {
+		// Work items already linked as closed or broken aren't repeated
+		if ref.Tracker == BoardsTracker && (contains(c.Closes, boardsPrefix+ref.Key) || contains(c.Breaks, boardsPrefix+ref.Key)) {
+			continue
+		}
+		refLinks = append(refLinks, markdownLink(ref.Key, ref.URL))
+	}
+	if len(refLinks) > 0 {
+		response += fmt.Sprintf(", refs %s", strings.Join(refLinks, " "))
+	}
 	return response
 }
 
+// CloseMergedPullRequest adds the pull request number of a Github
+// `Merge pull request #12 from ...` commit to Closes
+func (c *Commit) CloseMergedPullRequest() {
+	capture := MergePullRequestRegex.FindStringSubmatch(c.header)
+	if len(capture) < 2 {
+		return
+	}
+	for _, closes := range c.Closes {
+		if closes == capture[1] {
+			return
+		}
+	}
+	c.Closes = append(c.Closes, capture[1])
+}
+
+// issueLinks returns a markdown link for each issue reference. References to
+// other repositories, like `owner/repo#12`, link to that repository on the
+// same host, and Azure Boards work items, like `AB#12`, to the boards
+// tracker or the style's work items.
+func (c *Commit) issueLinks(refs []string, repo string, links linkStyle.Templates) []string {
+	result := []string{}
+	for _, ref := range refs {
+		// An empty reference only marks a breaking change
+		if ref == "" {
+			continue
+		}
+		if strings.HasPrefix(ref, boardsPrefix) {
+			result = append(result, markdownLink(ref, c.workItemLink(strings.TrimPrefix(ref, boardsPrefix), repo, links)))
+			continue
+		}
+		i := strings.LastIndex(ref, "#")
+		if i < 0 {
+			result = append(result, markdownLink("#"+ref, links.IssueLink(ref, repo)))
+			continue
+		}
+		ownerRepo, number := ref[:i], ref[i+1:]
+		u, err := remote.Parse(repo)
+		if err != nil {
+			result = append(result, ref)
+			continue
+		}
+		if strings.EqualFold(ownerRepo, u.FullName()) {
+			result = append(result, markdownLink("#"+number, links.IssueLink(number, repo)))
+			continue
+		}
+		result = append(result, markdownLink(ref, links.IssueLink(number, u.WithFullName(ownerRepo).WebURL())))
+	}
+	return result
+}
+
+// workItemLink returns the link of an Azure Boards work item, from the boards
+// tracker if it found the work item, or else from the link style
+func (c *Commit) workItemLink(id, repo string, links linkStyle.Templates) string {
+	for _, ref := range c.References {
+		if ref.Tracker == BoardsTracker && ref.Key == id {
+			return ref.URL
+		}
+	}
+	return links.WorkItemLink(id, repo)
+}
+
+// contains reports whether the value is one of values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownLink returns a markdown link, or just the text if there is no URL
+// because the provider has no such page
+func markdownLink(text, url string) string {
+	if url == "" {
+		return text
+	}
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
 // Commits is a slice of Commit
 type Commits []Commit
 
-// NewCommit creates a commit
+// Parser parses commit messages, finding the issues they close and break
+// after its keywords and the keys of its trackers
+type Parser struct {
+	closes   *regexp.Regexp
+	breaks   *regexp.Regexp
+	trackers []Tracker
+}
+
+// NewParser returns a parser with the keywords and trackers
+func NewParser(keywords Keywords, trackers []Tracker) *Parser {
+	closes, breaks := keywords.Closes, keywords.Breaks
+	if closes == nil {
+		closes = DefaultClosesKeywords
+	}
+	if breaks == nil {
+		breaks = DefaultBreaksKeywords
+	}
+	return &Parser{
+		closes:   NewReferenceRegex(closes),
+		breaks:   NewReferenceRegex(breaks),
+		trackers: trackers,
+	}
+}
+
+// defaultParser has the default keywords and no trackers
+var defaultParser = NewParser(Keywords{}, nil)
+
+// NewCommit creates a commit, with the default keywords and no trackers
 func NewCommit(hash, message string) *Commit {
+	return defaultParser.Parse(hash, message)
+}
+
+// Parse creates a commit
+func (p *Parser) Parse(hash, message string) *Commit {
 	lines := strings.Split(message, "\n")
 	if len(lines) == 0 {
 
@@ -125,26 +351,59 @@ func NewCommit(hash, message string) *Commit {
 	}
 
 	var (
-		closes []string
-		breaks []string
+		coAuthors    []Person
+		reverts      string
+		cherryPickOf string
 	)
 	for _, line := range lines {
-		if capture := ClosesRegex.FindStringSubmatch(line); len(capture) > 2 {
-			closes = append(closes, capture[2])
+		if capture := CoAuthorRegex.FindStringSubmatch(strings.TrimSpace(line)); len(capture) > 2 {
+			coAuthors = append(coAuthors, Person{Name: capture[1], Email: capture[2]})
 		}
-		if capture := BreaksRegex.FindStringSubmatch(line); len(capture) > 2 {
-			breaks = append(breaks, capture[2])
-		} else if BreakingRegex.FindString(line) != "" {
-			breaks = append(breaks, "")
+		if capture := RevertsRegex.FindStringSubmatch(line); len(capture) > 1 {
+			reverts = capture[1]
+		}
+		if capture := CherryPickRegex.FindStringSubmatch(strings.TrimSpace(line)); len(capture) > 1 {
+			cherryPickOf = capture[1]
 		}
 	}
 
-	return &Commit{
+	commit := &Commit{
 		Hash:          hash,
 		Subject:       strings.TrimSpace(subject),
 		Component:     component,
 		rawCommitType: commitType,
-		Closes:        closes,
-		Breaks:        breaks,
+		CoAuthors:     coAuthors,
+		Reverts:       reverts,
+		CherryPickOf:  cherryPickOf,
+		header:        strings.TrimSpace(lines[0]),
+		message:       message,
+	}
+	p.parseReferences(commit)
+	return commit
+}
+
+// parseReferences sets the issues a commit closes and breaks, and its tracker
+// references, from its message and those of the commits grouped into it
+func (p *Parser) parseReferences(c *Commit) {
+	c.Closes, c.Breaks, c.References = p.references(c.message)
+	for _, message := range c.grouped {
+		closes, breaks, refs := p.references(message)
+		c.Closes = mergeStringSlices(c.Closes, closes)
+		c.Breaks = mergeStringSlices(c.Breaks, breaks)
+		c.References = mergeReferences(c.References, refs)
+	}
+}
+
+// references returns the issues a message closes and breaks, and its tracker
+// references
+func (p *Parser) references(message string) (closes, breaks []string, refs []Reference) {
+	for _, line := range strings.Split(message, "\n") {
+		closes = append(closes, parseReferences(p.closes, line)...)
+		if found := parseReferences(p.breaks, line); len(found) > 0 {
+			breaks = append(breaks, found...)
+		} else if BreakingRegex.FindString(line) != "" {
+			breaks = append(breaks, "")
+		}
 	}
+	return closes, breaks, findReferences(p.trackers, message)
 }
@@ -2,6 +2,7 @@ package changelog_test
 
 import (
 	"fmt"
+	"reflect"
 	"sort"
 	"testing"
 
@@ -14,9 +15,15 @@ func errorDiff(t *testing.T, message, expected, got string) {
 	t.Errorf("%s!\nExpected\n\t%s\nGot\n\t%s", message, expected, got)
 }
 
+// templates returns the templates of a built-in link style
+func templates(style linkStyle.Style) linkStyle.Templates {
+	t, _ := linkStyle.Lookup(style)
+	return t
+}
+
 func TestSummary(t *testing.T) {
 	repo := "https://github.com/skuid/changelog"
-	style := linkStyle.Github
+	links := templates(linkStyle.Github)
 
 	cases := []struct {
 		commit changelog.Commit
@@ -52,10 +59,30 @@ func TestSummary(t *testing.T) {
 			},
 			"Initial Commit ([029aafdc](https://github.com/skuid/changelog/commit/029aafdc7579af19b3ce6acf0ce245a230633953)), closes [#2](https://github.com/skuid/changelog/issues/2), breaks [#1](https://github.com/skuid/changelog/issues/1)",
 		},
+		{
+			changelog.Commit{
+				Hash:        "029aafdc7579af19b3ce6acf0ce245a230633953",
+				Subject:     "Add a README",
+				CommitType:  "Features",
+				Closes:      []string{"2"},
+				PullRequest: &changelog.PullRequest{Number: 12, Title: "Add a README"},
+			},
+			"Add a README ([#12](https://github.com/skuid/changelog/pull/12)), closes [#2](https://github.com/skuid/changelog/issues/2)",
+		},
+		{
+			changelog.Commit{
+				Hash:       "029aafdc7579af19b3ce6acf0ce245a230633953",
+				Subject:    "Initial Commit",
+				CommitType: "feat",
+				Closes:     []string{"skuid/other#3", "Skuid/Changelog#4"},
+				Breaks:     []string{""},
+			},
+			"Initial Commit ([029aafdc](https://github.com/skuid/changelog/commit/029aafdc7579af19b3ce6acf0ce245a230633953)), closes [skuid/other#3](https://github.com/skuid/other/issues/3) [#4](https://github.com/skuid/changelog/issues/4)",
+		},
 	}
 
 	for i := range cases {
-		got := cases[i].commit.Summary(repo, style)
+		got := cases[i].commit.Summary(repo, links)
 		if got != cases[i].want {
 			errorDiff(t, "Commit summary failed", cases[i].want, got)
 		}
@@ -89,11 +116,27 @@ func commitsEqual(a, b changelog.Commit) bool {
 		return false
 	case !stringSliceEqual(a.Breaks, b.Breaks):
 		return false
+	case !reflect.DeepEqual(a.CoAuthors, b.CoAuthors):
+		return false
+	case a.Reverts != b.Reverts || a.CherryPickOf != b.CherryPickOf:
+		return false
 	default:
 		return true
 	}
 }
 
+func TestSummaryWithoutLinks(t *testing.T) {
+	commit := changelog.Commit{
+		Hash:    "029aafdc7579af19b3ce6acf0ce245a230633953",
+		Subject: "Initial Commit",
+		Closes:  []string{"2"},
+	}
+	want := "Initial Commit ([029aafdc](https://git.example.com/skuid/changelog/commit/?id=029aafdc7579af19b3ce6acf0ce245a230633953)), closes #2"
+	if got := commit.Summary("https://git.example.com/skuid/changelog", templates(linkStyle.Cgit)); got != want {
+		errorDiff(t, "Commit summary failed", want, got)
+	}
+}
+
 func TestNewCommit(t *testing.T) {
 	cases := []struct {
 		hash    string
@@ -111,6 +154,42 @@ func TestNewCommit(t *testing.T) {
 				Breaks:    []string{},
 			},
 		},
+		{
+			"029aafdc7579af19b3ce6acf0ce245a230633953",
+			"feat(README): Initial Commit\n\nCo-authored-by: Jane Doe <jane@example.com>",
+			&changelog.Commit{
+				Hash:      "029aafdc7579af19b3ce6acf0ce245a230633953",
+				Subject:   "Initial Commit",
+				Component: "README",
+				Closes:    []string{},
+				Breaks:    []string{},
+				CoAuthors: []changelog.Person{{Name: "Jane Doe", Email: "jane@example.com"}},
+			},
+		},
+		{
+			"029aafdc7579af19b3ce6acf0ce245a230633953",
+			"Revert \"feat(README): Initial Commit\"\n\nThis reverts commit 1e8b4c1b1a3c0c6d1f5f2ef9a2c7a0d3b5e6f7a8.",
+			&changelog.Commit{
+				Hash:      "029aafdc7579af19b3ce6acf0ce245a230633953",
+				Subject:   "Initial Commit\"",
+				Component: "README",
+				Closes:    []string{},
+				Breaks:    []string{},
+				Reverts:   "1e8b4c1b1a3c0c6d1f5f2ef9a2c7a0d3b5e6f7a8",
+			},
+		},
+		{
+			"029aafdc7579af19b3ce6acf0ce245a230633953",
+			"fix(README): Typo\n\n(cherry picked from commit 1e8b4c1b1a3c0c6d1f5f2ef9a2c7a0d3b5e6f7a8)",
+			&changelog.Commit{
+				Hash:         "029aafdc7579af19b3ce6acf0ce245a230633953",
+				Subject:      "Typo",
+				Component:    "README",
+				Closes:       []string{},
+				Breaks:       []string{},
+				CherryPickOf: "1e8b4c1b1a3c0c6d1f5f2ef9a2c7a0d3b5e6f7a8",
+			},
+		},
 	}
 
 	for i := range cases {
@@ -120,3 +199,73 @@ func TestNewCommit(t *testing.T) {
 		}
 	}
 }
+
+func TestNewCommitReferences(t *testing.T) {
+	cases := []struct {
+		message string
+		closes  []string
+		breaks  []string
+	}{
+		{"fix: thing\n\nCloses #1, #2", []string{"1", "2"}, nil},
+		{"fix: thing\n\nfixes #1,#2 and #3", []string{"1", "2", "3"}, nil},
+		{"fix: thing\n\nResolved: GH-4", []string{"4"}, nil},
+		{"fix: thing\n\nCLOSED skuid/other#5", []string{"skuid/other#5"}, nil},
+		{"fix: thing\n\nFixes https://github.com/skuid/other/issues/6", []string{"skuid/other#6"}, nil},
+		{"fix: thing\n\nCloses #7. Also fixes #8", []string{"7", "8"}, nil},
+		{"fix: thing\n\nprefixes #9 with a fixture", nil, nil},
+		{"fix: thing\n\nThe fix for #10", nil, nil},
+		{"feat: thing\n\nbroke #11 and skuid/other#12", nil, []string{"11", "skuid/other#12"}},
+		{"fix: thing\n\nFixes AB#13 and ab#14", []string{"AB#13", "AB#14"}, nil},
+	}
+	for _, c := range cases {
+		commit := changelog.NewCommit("029aafdc7579af19b3ce6acf0ce245a230633953", c.message)
+		if !reflect.DeepEqual(commit.Closes, c.closes) {
+			errorDiff(t, fmt.Sprintf("Closes of %q not equal!", c.message), fmt.Sprintf("%v", c.closes), fmt.Sprintf("%v", commit.Closes))
+		}
+		if !reflect.DeepEqual(commit.Breaks, c.breaks) {
+			errorDiff(t, fmt.Sprintf("Breaks of %q not equal!", c.message), fmt.Sprintf("%v", c.breaks), fmt.Sprintf("%v", commit.Breaks))
+		}
+	}
+}
+
+func TestParserKeywords(t *testing.T) {
+	parser := changelog.NewParser(changelog.Keywords{Closes: []string{"refs"}}, nil)
+	commit := parser.Parse("029aafdc7579af19b3ce6acf0ce245a230633953", "fix: thing\n\nFixes #1\nRefs #2\nBroke #3")
+	if !reflect.DeepEqual(commit.Closes, []string{"2"}) {
+		errorDiff(t, "Closes not equal!", "[2]", fmt.Sprintf("%v", commit.Closes))
+	}
+	if !reflect.DeepEqual(commit.Breaks, []string{"3"}) {
+		errorDiff(t, "Breaks not equal!", "[3]", fmt.Sprintf("%v", commit.Breaks))
+	}
+
+	parser = changelog.NewParser(changelog.Keywords{Closes: []string{}}, nil)
+	commit = parser.Parse("029aafdc7579af19b3ce6acf0ce245a230633953", "fix: thing\n\nFixes #1")
+	if len(commit.Closes) != 0 {
+		errorDiff(t, "Closes not empty!", "[]", fmt.Sprintf("%v", commit.Closes))
+	}
+
+	// Other parsers don't change the defaults
+	commit = changelog.NewCommit("029aafdc7579af19b3ce6acf0ce245a230633953", "fix: thing\n\nFixes #1\nRefs #2")
+	if !reflect.DeepEqual(commit.Closes, []string{"1"}) {
+		errorDiff(t, "Closes not equal!", "[1]", fmt.Sprintf("%v", commit.Closes))
+	}
+}
+
+func TestCloseMergedPullRequest(t *testing.T) {
+	cases := []struct {
+		message string
+		want    []string
+	}{
+		{"Merge pull request #12 from skuid/feature\n\nfeat: thing", []string{"12"}},
+		{"Merge pull request #12 from skuid/feature\n\nCloses #12", []string{"12"}},
+		{"Merge pull request #12 from skuid/feature\n\nCloses #3", []string{"3", "12"}},
+		{"Merge branch 'master' into feature", nil},
+	}
+	for _, c := range cases {
+		commit := changelog.NewCommit("029aafdc7579af19b3ce6acf0ce245a230633953", c.message)
+		commit.CloseMergedPullRequest()
+		if !reflect.DeepEqual(commit.Closes, c.want) {
+			errorDiff(t, "Closes not equal!", fmt.Sprintf("%v", c.want), fmt.Sprintf("%v", commit.Closes))
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package changelog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// ConfigFiles are the configuration files GetConfig looks for in a
+// repository, in order. The configuration in package.json is its `changelog`
+// key.
+var ConfigFiles = []string{".clog.toml", ".changelog.yml", ".changelog.json", "package.json"}
+
+// ConfigFile is a configuration file found in a repository
+type ConfigFile struct {
+	io.Reader
+	// Path is the path of the file in the repository
+	Path string
+}
+
+// Type returns the format of the file, one of toml, yaml or json
+func (c ConfigFile) Type() string {
+	switch strings.ToLower(filepath.Ext(c.Path)) {
+	case ".yml", ".yaml":
+		return "yaml"
+	case ".json":
+		return "json"
+	}
+	return "toml"
+}
+
+// ConfigType returns the format of a configuration returned by GetConfig.
+// Configurations of queriers that don't return a ConfigFile are TOML.
+func ConfigType(r io.Reader) string {
+	if file, ok := r.(*ConfigFile); ok {
+		return file.Type()
+	}
+	return "toml"
+}
+
+// ConfigPath returns the path of a configuration returned by GetConfig
+func ConfigPath(r io.Reader) string {
+	if file, ok := r.(*ConfigFile); ok {
+		return file.Path
+	}
+	return ConfigFiles[0]
+}
+
+// NoConfigError is returned by GetConfig when the repository has none of
+// the ConfigFiles
+type NoConfigError struct {
+	Files []string
+}
+
+func (e *NoConfigError) Error() string {
+	return fmt.Sprintf("No configuration file found, looked for %s", strings.Join(e.Files, ", "))
+}
+
+// IsNoConfig reports whether the cause of an error is a NoConfigError
+func IsNoConfig(err error) bool {
+	_, ok := errors.Cause(err).(*NoConfigError)
+	return ok
+}
+
+// noChangelogKeyError is returned for a package.json without a `changelog`
+// key, which findConfig passes over like a missing file
+type noChangelogKeyError struct {
+	path string
+}
+
+func (e *noChangelogKeyError) Error() string {
+	return fmt.Sprintf("%s has no changelog key", e.path)
+}
+
+// statusError is an unsuccessful response of a provider's API
+type statusError struct {
+	path string
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("GET %s: %d %s", e.path, e.code, e.body)
+}
+
+// isNotFound reports whether getFile failed because the file doesn't exist
+func isNotFound(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case *noChangelogKeyError:
+		return true
+	case *statusError:
+		return cause.code == http.StatusNotFound
+	case *github.ErrorResponse:
+		return cause.Response != nil && cause.Response.StatusCode == http.StatusNotFound
+	}
+	return os.IsNotExist(errors.Cause(err))
+}
+
+// findConfig returns the first of the ConfigFiles that getFile finds. Files
+// that can't be read for another reason than not existing are an error,
+// rather than falling through to the next.
+func findConfig(ctx context.Context, getFile func(ctx context.Context, path string) (io.Reader, error)) (io.Reader, error) {
+	for _, path := range ConfigFiles {
+		file, err := getFile(ctx, path)
+		if err == nil {
+			var config *ConfigFile
+			if config, err = NewConfigFile(path, file); err == nil {
+				return config, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, errors.WithStack(ctx.Err())
+		}
+		if !isNotFound(err) {
+			return nil, errors.Wrapf(err, "Could not read %s", path)
+		}
+	}
+	return nil, errors.WithStack(&NoConfigError{Files: ConfigFiles})
+}
+
+// NewConfigFile reads the configuration file at the path. The configuration
+// of a package.json is its `changelog` key, and it is an error if it has
+// none.
+func NewConfigFile(path string, r io.Reader) (*ConfigFile, error) {
+	if filepath.Base(path) != "package.json" {
+		return &ConfigFile{Reader: r, Path: path}, nil
+	}
+
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	manifest := struct {
+		Changelog json.RawMessage `json:"changelog"`
+	}{}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "Could not parse %s", path)
+	}
+	if len(manifest.Changelog) == 0 {
+		return nil, errors.WithStack(&noChangelogKeyError{path: path})
+	}
+	return &ConfigFile{Reader: bytes.NewReader(manifest.Changelog), Path: path}, nil
+}
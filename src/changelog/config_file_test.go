@@ -0,0 +1,108 @@
+package changelog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFindConfig(t *testing.T) {
+	cases := []struct {
+		files    map[string]string
+		path     string
+		fileType string
+		want     string
+	}{
+		{
+			map[string]string{".clog.toml": "[sections]\n", ".changelog.yml": "sections: {}\n"},
+			".clog.toml", "toml", "[sections]\n",
+		},
+		{
+			map[string]string{".changelog.yml": "sections: {}\n", "package.json": `{"changelog": {}}`},
+			".changelog.yml", "yaml", "sections: {}\n",
+		},
+		{
+			map[string]string{".changelog.json": `{"sections": {}}`},
+			".changelog.json", "json", `{"sections": {}}`,
+		},
+		{
+			map[string]string{"package.json": `{"name": "pkg", "changelog": {"sections": {"docs": ["docs"]}}}`},
+			"package.json", "json", `{"sections": {"docs": ["docs"]}}`,
+		},
+		{
+			map[string]string{"package.json": `{"name": "pkg"}`},
+			"", "", "",
+		},
+	}
+	for _, c := range cases {
+		getFile := func(ctx context.Context, path string) (io.Reader, error) {
+			content, ok := c.files[path]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			return bytes.NewBufferString(content), nil
+		}
+
+		config, err := findConfig(context.Background(), getFile)
+		if c.path == "" {
+			if err == nil {
+				t.Errorf("Expected no configuration to be found in %v", c.files)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if path := ConfigPath(config); path != c.path {
+			t.Errorf("Expected %s, got %s", c.path, path)
+		}
+		if fileType := ConfigType(config); fileType != c.fileType {
+			t.Errorf("Expected %s to be %s, got %s", c.path, c.fileType, fileType)
+		}
+		if raw, _ := ioutil.ReadAll(config); string(raw) != c.want {
+			t.Errorf("Expected %q, got %q", c.want, raw)
+		}
+	}
+}
+
+func TestFindConfigErrors(t *testing.T) {
+	cases := []struct {
+		err      error
+		want     string
+		noConfig bool
+	}{
+		{os.ErrNotExist, "", true},
+		{&statusError{path: "/raw/.clog.toml", code: 404}, "", true},
+		{&statusError{path: "/raw/.clog.toml", code: 401, body: "unauthorized"}, "Could not read .clog.toml: GET /raw/.clog.toml: 401 unauthorized", false},
+		{os.ErrPermission, "Could not read .clog.toml: permission denied", false},
+	}
+	for _, c := range cases {
+		getFile := func(ctx context.Context, path string) (io.Reader, error) {
+			if path == ".clog.toml" {
+				return nil, c.err
+			}
+			return nil, os.ErrNotExist
+		}
+
+		_, err := findConfig(context.Background(), getFile)
+		if IsNoConfig(err) != c.noConfig {
+			t.Errorf("Expected IsNoConfig to be %t for %v, got %v", c.noConfig, c.err, err)
+		}
+		if c.want != "" && (err == nil || err.Error() != c.want) {
+			t.Errorf("Expected %q, got %v", c.want, err)
+		}
+	}
+
+	getFile := func(ctx context.Context, path string) (io.Reader, error) {
+		if path == "package.json" {
+			return bytes.NewBufferString("{"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	if _, err := findConfig(context.Background(), getFile); err == nil || IsNoConfig(err) {
+		t.Errorf("Expected an unparsable package.json to be an error, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package changelog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Person is a commit author or co-author
+type Person struct {
+	Name  string
+	Email string
+}
+
+// String returns the person's name, or their email if they have no name
+func (p Person) String() string {
+	if p.Name == "" {
+		return p.Email
+	}
+	return p.Name
+}
+
+func (p Person) key() string {
+	if p.Email != "" {
+		return strings.ToLower(p.Email)
+	}
+	return strings.ToLower(p.Name)
+}
+
+// Authors returns the commit's author followed by any co-authors
+func (c Commit) Authors() []Person {
+	authors := []Person{}
+	if c.Author != (Person{}) {
+		authors = append(authors, c.Author)
+	}
+	return append(authors, c.CoAuthors...)
+}
+
+// Contributor is a person who authored commits in a release
+type Contributor struct {
+	Person
+	Commits   int
+	FirstTime bool
+}
+
+// Contributors is a slice of Contributor
+type Contributors []Contributor
+
+// NewContributors returns everyone who authored or co-authored the given
+// commits, sorted by name. Authors are de-duplicated through the alias map,
+// and anyone who doesn't appear in the previous commits is marked as a
+// first-time contributor.
+func NewContributors(commits, previous Commits, aliases AuthorAliasMap) Contributors {
+	seen := map[string]bool{}
+	for _, commit := range previous {
+		for _, author := range commit.Authors() {
+			seen[aliases.Canonical(author).key()] = true
+		}
+	}
+
+	indexes := map[string]int{}
+	contributors := Contributors{}
+	for _, commit := range commits {
+		for _, author := range commit.Authors() {
+			author = aliases.Canonical(author)
+			key := author.key()
+			if i, ok := indexes[key]; ok {
+				contributors[i].Commits++
+				continue
+			}
+			indexes[key] = len(contributors)
+			contributors = append(contributors, Contributor{
+				Person:    author,
+				Commits:   1,
+				FirstTime: !seen[key],
+			})
+		}
+	}
+
+	sort.SliceStable(contributors, func(i, j int) bool {
+		return strings.ToLower(contributors[i].String()) < strings.ToLower(contributors[j].String())
+	})
+	return contributors
+}
+
+// Summary generates a summary line for the contributor used in the change log
+func (c Contributor) Summary() string {
+	if c.FirstTime {
+		return fmt.Sprintf("%s (first contribution)", c.String())
+	}
+	return c.String()
+}
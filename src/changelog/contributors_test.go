@@ -0,0 +1,81 @@
+package changelog_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/skuid/changelog/src/changelog"
+)
+
+func TestParseAuthorAliasMap(t *testing.T) {
+	mailmap := `# comment
+Jane Doe <jane@example.com>
+Jane Doe <jane@example.com> <jdoe@old.example.com>
+<john@example.com> <john@laptop.local>
+John Smith <john@example.com> johnny <johnny@example.com>
+`
+	aliases, err := changelog.ParseAuthorAliasMap(bytes.NewBufferString(mailmap))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		person changelog.Person
+		want   changelog.Person
+	}{
+		{
+			changelog.Person{Name: "jane", Email: "jane@example.com"},
+			changelog.Person{Name: "Jane Doe", Email: "jane@example.com"},
+		},
+		{
+			changelog.Person{Name: "J. Doe", Email: "JDoe@old.example.com"},
+			changelog.Person{Name: "Jane Doe", Email: "jane@example.com"},
+		},
+		{
+			changelog.Person{Name: "John Smith", Email: "john@laptop.local"},
+			changelog.Person{Name: "John Smith", Email: "john@example.com"},
+		},
+		{
+			changelog.Person{Name: "johnny", Email: "johnny@example.com"},
+			changelog.Person{Name: "John Smith", Email: "john@example.com"},
+		},
+		{
+			changelog.Person{Name: "someone else", Email: "johnny@example.com"},
+			changelog.Person{Name: "someone else", Email: "johnny@example.com"},
+		},
+	}
+	for _, c := range cases {
+		if got := aliases.Canonical(c.person); got != c.want {
+			errorDiff(t, "Canonical author not equal!", fmt.Sprintf("%v", c.want), fmt.Sprintf("%v", got))
+		}
+	}
+}
+
+func TestNewContributors(t *testing.T) {
+	jane := changelog.Person{Name: "Jane Doe", Email: "jane@example.com"}
+	john := changelog.Person{Name: "John Smith", Email: "john@example.com"}
+	alex := changelog.Person{Name: "alex", Email: "alex@example.com"}
+
+	aliases, _ := changelog.ParseAuthorAliasMap(bytes.NewBufferString("Jane Doe <jane@example.com> <jane@laptop.local>"))
+
+	commits := changelog.Commits{
+		{Hash: "1", Author: jane},
+		{Hash: "2", Author: changelog.Person{Name: "jane", Email: "jane@laptop.local"}},
+		{Hash: "3", Author: john, CoAuthors: []changelog.Person{alex}},
+	}
+	previous := changelog.Commits{
+		{Hash: "0", Author: jane},
+	}
+
+	want := changelog.Contributors{
+		{Person: alex, Commits: 1, FirstTime: true},
+		{Person: jane, Commits: 2, FirstTime: false},
+		{Person: john, Commits: 1, FirstTime: true},
+	}
+	got := changelog.NewContributors(commits, previous, aliases)
+	if !reflect.DeepEqual(got, want) {
+		errorDiff(t, "Contributors not equal!", fmt.Sprintf("%v", want), fmt.Sprintf("%v", got))
+	}
+}
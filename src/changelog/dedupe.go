@@ -0,0 +1,122 @@
+package changelog
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// RevertSubjectRegex is used to find the subject of the commit a revert
+// commit reverts, for reverts without a `This reverts commit` line, like
+// squash merged pull requests
+var RevertSubjectRegex = regexp.MustCompile(`^Revert "(.*)"(?: \(#\d+\))?$`)
+
+// PatchIDer is an interface for queriers that can tell when two commits make
+// the same changes, like a fix cherry-picked without a trailer
+type PatchIDer interface {
+	// PatchIDs returns the patch ID of each commit that changes any files,
+	// keyed by hash
+	PatchIDs(ctx context.Context, hashes []string) (map[string]string, error)
+}
+
+// DroppedCommit is a commit left out of the changelog because it cancels out
+// or duplicates another commit
+type DroppedCommit struct {
+	Commit Commit
+	Reason string
+}
+
+// String describes the dropped commit, like `1a2b3c4d feat: thing (reverted by 5e6f7a8b)`
+func (d DroppedCommit) String() string {
+	return fmt.Sprintf("%s %s (%s)", shortHash(d.Commit.Hash), d.Commit.header, d.Reason)
+}
+
+// IsRevert reports whether the commit reverts another commit
+func (c Commit) IsRevert() bool {
+	return c.Reverts != "" || RevertSubjectRegex.MatchString(c.header)
+}
+
+// DedupeCommits removes reverted commits and duplicated changes from commits,
+// which must be ordered newest first, returning the commits kept and the
+// commits removed.
+//
+// A commit reverted within the list is dropped along with its revert. Reverts
+// are matched newest first, so reverting a revert brings the original commit
+// back. A commit cherry-picked from another commit in the list is dropped in
+// favor of the original, as are commits with the same patch ID as an older
+// commit.
+func DedupeCommits(commits Commits, patchIDs map[string]string) (Commits, []DroppedCommit) {
+	byHash := make(map[string]int, len(commits))
+	for i, c := range commits {
+		byHash[c.Hash] = i
+	}
+	reasons := make([]string, len(commits))
+
+	// revertedBy finds the older commit the commit at i reverts
+	revertedBy := func(i int) (int, bool) {
+		if commits[i].Reverts != "" {
+			j, ok := byHash[commits[i].Reverts]
+			return j, ok && j > i && reasons[j] == ""
+		}
+		capture := RevertSubjectRegex.FindStringSubmatch(commits[i].header)
+		if len(capture) < 2 {
+			return 0, false
+		}
+		for j := i + 1; j < len(commits); j++ {
+			if reasons[j] == "" && commits[j].header == capture[1] {
+				return j, true
+			}
+		}
+		return 0, false
+	}
+
+	for i := range commits {
+		if reasons[i] != "" {
+			continue
+		}
+		if j, ok := revertedBy(i); ok {
+			reasons[i] = fmt.Sprintf("reverts %s", shortHash(commits[j].Hash))
+			reasons[j] = fmt.Sprintf("reverted by %s", shortHash(commits[i].Hash))
+		}
+	}
+
+	// Oldest first, so the original of each change is the one kept
+	original := map[string]string{}
+	for i := len(commits) - 1; i >= 0; i-- {
+		c := commits[i]
+		if reasons[i] != "" {
+			continue
+		}
+		if j, ok := byHash[c.CherryPickOf]; ok && reasons[j] == "" {
+			reasons[i] = fmt.Sprintf("cherry-picked from %s", shortHash(c.CherryPickOf))
+			continue
+		}
+		patchID, ok := patchIDs[c.Hash]
+		if !ok {
+			continue
+		}
+		if hash, ok := original[patchID]; ok {
+			reasons[i] = fmt.Sprintf("same changes as %s", shortHash(hash))
+			continue
+		}
+		original[patchID] = c.Hash
+	}
+
+	kept := Commits{}
+	dropped := []DroppedCommit{}
+	for i, c := range commits {
+		if reasons[i] == "" {
+			kept = append(kept, c)
+		} else {
+			dropped = append(dropped, DroppedCommit{c, reasons[i]})
+		}
+	}
+	return kept, dropped
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
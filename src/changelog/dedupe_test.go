@@ -0,0 +1,150 @@
+package changelog_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/skuid/changelog/src/changelog"
+)
+
+func TestDedupeCommits(t *testing.T) {
+	sha := func(c string) string { return strings.Repeat(c, 40) }
+	commit := func(hash, message string) changelog.Commit {
+		return *changelog.NewCommit(hash, message)
+	}
+	hashes := func(commits changelog.Commits) []string {
+		got := []string{}
+		for _, c := range commits {
+			got = append(got, c.Hash[:1])
+		}
+		return got
+	}
+
+	cases := []struct {
+		desc     string
+		commits  changelog.Commits
+		patchIDs map[string]string
+		kept     []string
+		dropped  []string
+	}{
+		{
+			"revert by hash",
+			changelog.Commits{
+				commit(sha("c"), "fix: other"),
+				commit(sha("b"), "Revert \"feat: thing\"\n\nThis reverts commit "+sha("a")+"."),
+				commit(sha("a"), "feat: thing"),
+			},
+			nil,
+			[]string{"c"},
+			[]string{"bbbbbbbb Revert \"feat: thing\" (reverts aaaaaaaa)", "aaaaaaaa feat: thing (reverted by bbbbbbbb)"},
+		},
+		{
+			"revert of a commit out of range",
+			changelog.Commits{
+				commit(sha("b"), "Revert \"feat: thing\"\n\nThis reverts commit "+sha("a")+"."),
+			},
+			nil,
+			[]string{"b"},
+			[]string{},
+		},
+		{
+			"squash merged revert by subject",
+			changelog.Commits{
+				commit(sha("b"), "Revert \"feat: thing (#1)\" (#2)"),
+				commit(sha("a"), "feat: thing (#1)"),
+			},
+			nil,
+			[]string{},
+			[]string{"bbbbbbbb Revert \"feat: thing (#1)\" (#2) (reverts aaaaaaaa)", "aaaaaaaa feat: thing (#1) (reverted by bbbbbbbb)"},
+		},
+		{
+			"reverted revert",
+			changelog.Commits{
+				commit(sha("c"), "Revert \"Revert \"feat: thing\"\"\n\nThis reverts commit "+sha("b")+"."),
+				commit(sha("b"), "Revert \"feat: thing\"\n\nThis reverts commit "+sha("a")+"."),
+				commit(sha("a"), "feat: thing"),
+			},
+			nil,
+			[]string{"a"},
+			[]string{"cccccccc Revert \"Revert \"feat: thing\"\" (reverts bbbbbbbb)", "bbbbbbbb Revert \"feat: thing\" (reverted by cccccccc)"},
+		},
+		{
+			"cherry-pick trailer",
+			changelog.Commits{
+				commit(sha("b"), "fix: thing\n\n(cherry picked from commit "+sha("a")+")"),
+				commit(sha("a"), "fix: thing"),
+			},
+			nil,
+			[]string{"a"},
+			[]string{"bbbbbbbb fix: thing (cherry-picked from aaaaaaaa)"},
+		},
+		{
+			"same patch ID",
+			changelog.Commits{
+				commit(sha("c"), "fix: thing on the release branch"),
+				commit(sha("b"), "feat: other"),
+				commit(sha("a"), "fix: thing"),
+			},
+			map[string]string{sha("a"): "1", sha("b"): "2", sha("c"): "1"},
+			[]string{"b", "a"},
+			[]string{"cccccccc fix: thing on the release branch (same changes as aaaaaaaa)"},
+		},
+	}
+
+	for _, c := range cases {
+		kept, dropped := changelog.DedupeCommits(c.commits, c.patchIDs)
+		if got := hashes(kept); !reflect.DeepEqual(got, c.kept) {
+			t.Errorf("%s: Expected to keep %v, got %v", c.desc, c.kept, got)
+		}
+		got := []string{}
+		for _, d := range dropped {
+			got = append(got, d.String())
+		}
+		if !reflect.DeepEqual(got, c.dropped) {
+			t.Errorf("%s: Expected to drop\n\t%q\nGot\n\t%q", c.desc, c.dropped, got)
+		}
+	}
+}
+
+func TestPatchIDs(t *testing.T) {
+	dir := fixtureRepo(t)
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com",
+			"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com",
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	// Pick the fix on master onto a release branch without a trailer
+	fix := git("rev-list", "-1", "--grep", "handle empty input", "master")
+	git("checkout", "-q", "-b", "release", "v1.0.0")
+	git("cherry-pick", fix)
+	pick := git("rev-parse", "HEAD")
+	merge := git("rev-list", "-1", "--merges", "master")
+
+	q := changelog.NewLocalQuerier(dir+"/.git", dir, changelog.QueryFilter{}).(changelog.PatchIDer)
+	ids, err := q.PatchIDs(context.Background(), []string{fix, pick, merge})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if ids[fix] == "" || ids[fix] != ids[pick] {
+		t.Errorf("Expected the pick to have the same patch ID as %s, got %v", fix, ids)
+	}
+	if _, ok := ids[merge]; ok {
+		t.Errorf("Expected no patch ID for the merge, got %v", ids)
+	}
+}
@@ -0,0 +1,320 @@
+package changelog
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/linkStyle"
+)
+
+// GroupBy is how commits are assigned to entries and sections
+type GroupBy string
+
+const (
+	// GroupByCommits has one entry per commit, in the section of its prefix
+	GroupByCommits GroupBy = "commits"
+	// GroupByLabels has one entry per commit, in the section of the labels of
+	// the pull request it was merged in. The querier does the grouping, see
+	// NewGithubLabelQuerier.
+	GroupByLabels GroupBy = "labels"
+	// GroupByPullRequests has one entry per merged pull request
+	GroupByPullRequests GroupBy = "pull-requests"
+)
+
+// Options configure Generate
+type Options struct {
+	// Querier reads the repository's commits. It is required.
+	Querier Querier
+	// Repo is the web URL of the repository, for links. Defaults to the
+	// querier's origin.
+	Repo string
+	// Style is the style of links, one of the built-in styles or LinkStyles.
+	// Inferred from the host of Repo if empty.
+	Style linkStyle.Style
+	// LinkStyles are styles added to the built-in ones, or replacing them
+	LinkStyles linkStyle.Styles
+	// Hosts are the styles of self-hosted instances, for inferring Style
+	Hosts linkStyle.Hosts
+
+	// Keywords are the words before the issues commits close or break.
+	// Defaults to DefaultClosesKeywords and DefaultBreaksKeywords.
+	Keywords Keywords
+	// Trackers are the external issue trackers whose keys are linked
+	Trackers []Tracker
+
+	Version  string
+	Subtitle string
+
+	// From and To are the range of commits. From defaults to the beginning of
+	// the history, and To to HEAD.
+	From string
+	To   string
+	// FromLatestTag starts the range at the latest tag reachable from To
+	// allowed by the querier's filter, instead of From
+	FromLatestTag bool
+	// Since and Until select commits by date instead of From and To, if
+	// either is set. Until defaults to now.
+	Since time.Time
+	Until time.Time
+	// Tag is the tag being released, for the link comparing it to the
+	// previous tag when To is HEAD. Defaults to Version named like the
+	// previous tag.
+	Tag string
+
+	// Sections maps section titles to commit prefixes. Defaults to
+	// NewSectionAliasMap().
+	Sections SectionAliasMap
+	// Order is the order of the sections. Unlisted sections follow
+	// alphabetically.
+	Order []string
+	// IncludeAll includes commits that can't be parsed, in the Unknown
+	// section
+	IncludeAll bool
+	GroupBy    GroupBy
+	// MergeCloses adds the pull request of each Github merge commit to what
+	// it closes
+	MergeCloses bool
+	// KeepDuplicates keeps reverted commits, their reverts and cherry-picks
+	// of commits already in range
+	KeepDuplicates bool
+	// Contributors lists the authors of the changelog's commits
+	Contributors bool
+	// Processors transform the commits, in order, before they are sorted
+	// into sections
+	Processors []Processor
+}
+
+// Release is a generated changelog, ready to be written
+type Release struct {
+	ChangeLog
+	Style linkStyle.Style
+	// Links are the templates of Style's links
+	Links    linkStyle.Templates
+	Date     time.Time
+	Sections SectionMap
+	// Dropped are the duplicate and reverted commits left out
+	Dropped []DroppedCommit
+}
+
+// byDate reports whether the options select commits by date
+func (o Options) byDate() bool {
+	return !o.Since.IsZero() || !o.Until.IsZero()
+}
+
+// Generate reads the commits selected by the options and sorts them into the
+// sections of a release
+func Generate(ctx context.Context, opts Options) (*Release, error) {
+	if opts.Querier == nil {
+		return nil, errors.New("A querier is required")
+	}
+	querier := opts.Querier
+	if opts.Repo == "" {
+		repo, err := querier.GetOrigin(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get the repository URL")
+		}
+		opts.Repo = repo
+	}
+	if opts.Style == "" {
+		opts.Style = opts.Hosts.Infer(opts.Repo)
+	}
+	links, ok := opts.LinkStyles.Lookup(opts.Style)
+	if !ok {
+		_, err := opts.LinkStyles.Parse(string(opts.Style))
+		return nil, err
+	}
+	if opts.Sections == nil {
+		opts.Sections = NewSectionAliasMap()
+	}
+	parser := NewParser(opts.Keywords, opts.Trackers)
+
+	release := &Release{
+		ChangeLog: ChangeLog{
+			Repo:     opts.Repo,
+			Version:  opts.Version,
+			Subtitle: opts.Subtitle,
+		},
+		Style: opts.Style,
+		Links: links,
+		Date:  time.Now(),
+	}
+
+	from := opts.From
+	var r CommitRange
+	if opts.byDate() {
+		if opts.GroupBy == GroupByPullRequests {
+			return nil, errors.New("Grouping by pull-requests requires from/to rather than since/until")
+		}
+		r = CommitRange{Since: opts.Since, Until: opts.Until}
+		if r.Until.IsZero() {
+			r.Until = time.Now()
+		}
+		if r.Since.IsZero() {
+			r.Since = time.Unix(1, 0)
+		}
+	} else {
+		if opts.FromLatestTag {
+			// The tag's name rather than its commit, for the compare link
+			var err error
+			from, err = querier.GetLatestTagVersion(ctx, opts.To)
+			if err != nil {
+				return nil, errors.Wrap(err, "Could not get latest tag revision")
+			}
+		}
+		r = CommitRange{From: from, To: opts.To}
+		release.From, release.To = from, compareTo(from, opts.To, opts.Tag, opts.Version)
+	}
+
+	// others are the commits in range that won't be in the changelog, kept
+	// only for their authors
+	var commits, others Commits
+	if opts.GroupBy == GroupByPullRequests {
+		var err error
+		commits, err = querier.GetPullRequests(ctx, r.From, r.To)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get list of commits")
+		}
+		for i := range commits {
+			parser.parseReferences(&commits[i])
+		}
+	} else {
+		keep := NewCommitFilter(opts.Sections.Grep(), opts.IncludeAll)
+		err := querier.ForEachCommit(ctx, r, func(commit Commit) error {
+			// Queriers parse commits with the default keywords
+			parser.parseReferences(&commit)
+			if opts.MergeCloses {
+				commit.CloseMergedPullRequest()
+			}
+			// Reverts are kept until duplicates are removed, even if they
+			// won't be in the changelog, to cancel out what they revert
+			if keep(commit) || commit.IsRevert() {
+				commits = append(commits, commit)
+			} else if opts.Contributors {
+				others = append(others, commit)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get list of commits")
+		}
+	}
+
+	if !opts.KeepDuplicates {
+		var patchIDs map[string]string
+		if p, ok := querier.(PatchIDer); ok && opts.GroupBy != GroupByPullRequests {
+			hashes := make([]string, len(commits))
+			for i := range commits {
+				hashes[i] = commits[i].Hash
+			}
+			var err error
+			if patchIDs, err = p.PatchIDs(ctx, hashes); err != nil {
+				return nil, errors.Wrap(err, "Could not get patch IDs")
+			}
+		}
+		commits, release.Dropped = DedupeCommits(commits, patchIDs)
+	}
+
+	pipeline := append(Pipeline{}, opts.Processors...)
+	if !opts.IncludeAll {
+		// Reverts kept for removing duplicates are dropped here
+		pipeline = append(pipeline, filterProcessor{matches: NewCommitFilter(opts.Sections.Grep(), false)})
+	}
+	// Set the proper CommitType on each commit from the section aliases
+	pipeline = append(pipeline, sectionFormatter{opts.Sections, opts.IncludeAll})
+	commits, err := pipeline.Process(ctx, querier, commits)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Contributors {
+		// The authors of commits left out of the changelog are contributors
+		// too, unless the processors drop their commits, like those of bots
+		for _, d := range release.Dropped {
+			others = append(others, d.Commit)
+		}
+		others, err = Pipeline(opts.Processors).Process(ctx, querier, others)
+		if err != nil {
+			return nil, err
+		}
+		contributors, err := collectContributors(ctx, querier, r, append(others, commits...))
+		if err != nil {
+			return nil, err
+		}
+		release.Contributors = contributors
+	}
+
+	release.Sections = NewSectionMap(commits)
+	if len(opts.Order) > 0 {
+		release.Sections.SetOrder(opts.Order)
+	}
+	return release, nil
+}
+
+// compareTo returns the end of the heading's compare link. That is `to`, or
+// if it is HEAD, the tag being released: tag if it is set, or the version
+// named like the previous tag, so `api/v1.2.0` is followed by `api/v1.3.0`.
+func compareTo(from, to, tag, version string) string {
+	if to != "" && to != "HEAD" {
+		return to
+	}
+	if tag != "" {
+		return tag
+	}
+	if from == "" || version == "" {
+		return ""
+	}
+	for i := range from {
+		if _, err := ParseVersion(from[i:]); err != nil {
+			continue
+		}
+		prefix := from[:i]
+		if from[i] == 'v' && !strings.HasPrefix(version, "v") {
+			prefix += "v"
+		}
+		return prefix + version
+	}
+	return version
+}
+
+// collectContributors lists the authors of the given commits, de-duplicated
+// with the repository's `.mailmap`. Authors with no commits before the range
+// are marked as first-time contributors.
+func collectContributors(ctx context.Context, querier Querier, r CommitRange, commits Commits) (Contributors, error) {
+	aliases := AuthorAliasMap{}
+	if mailmap, err := querier.GetFile(ctx, ".mailmap"); err == nil {
+		aliases, err = ParseAuthorAliasMap(mailmap)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not parse .mailmap")
+		}
+	}
+
+	var previous Commits
+	var before CommitRange
+	switch {
+	case r.byDate():
+		before = CommitRange{Since: time.Unix(1, 0), Until: r.Since.Add(-time.Second)}
+	case r.From != "":
+		before = CommitRange{To: r.From}
+	default:
+		return NewContributors(commits, previous, aliases), nil
+	}
+
+	// The earlier history can be long, so only one commit per author is kept
+	seen := map[Person]bool{}
+	err := querier.ForEachCommit(ctx, before, func(commit Commit) error {
+		for _, author := range commit.Authors() {
+			if !seen[author] {
+				seen[author] = true
+				previous = append(previous, Commit{Author: author})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get list of previous commits")
+	}
+
+	return NewContributors(commits, previous, aliases), nil
+}
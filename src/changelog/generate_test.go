@@ -0,0 +1,319 @@
+package changelog_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/linkStyle"
+	"github.com/skuid/changelog/src/writer"
+)
+
+// fakeQuerier serves a fixed list of commits, and the ranges it was asked for
+type fakeQuerier struct {
+	changelog.Querier
+	commits   changelog.Commits
+	latestTag string
+	ranges    []changelog.CommitRange
+}
+
+func (q *fakeQuerier) GetOrigin(ctx context.Context) (string, error) {
+	return "https://gitlab.com/skuid/changelog", nil
+}
+
+func (q *fakeQuerier) GetLatestTagVersion(ctx context.Context, to string) (string, error) {
+	if q.latestTag == "" {
+		return "", &changelog.NoMatchingTagError{To: to}
+	}
+	return q.latestTag, nil
+}
+
+func (q *fakeQuerier) GetFile(ctx context.Context, path string) (io.Reader, error) {
+	return nil, errors.New("not found")
+}
+
+func (q *fakeQuerier) ForEachCommit(ctx context.Context, r changelog.CommitRange, fn changelog.CommitFunc) error {
+	q.ranges = append(q.ranges, r)
+	if r.From == "" && r.To == q.latestTag {
+		// Everything before the latest tag
+		return fn(changelog.Commit{Author: changelog.Person{Name: "Old", Email: "old@example.com"}})
+	}
+	for _, c := range q.commits {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	reverted = "1111111111111111111111111111111111111111"
+	revert   = "2222222222222222222222222222222222222222"
+)
+
+func newFakeQuerier() *fakeQuerier {
+	commits := changelog.Commits{}
+	for _, c := range []struct{ hash, message, author string }{
+		{revert, "Revert \"feat: oops\"\n\nThis reverts commit " + reverted + ".", "New"},
+		{"3333333333333333333333333333333333333333", "fix(api): a bug", "New"},
+		{"4444444444444444444444444444444444444444", "feat(api): a thing\n\nCloses #4", "Old"},
+		{"5555555555555555555555555555555555555555", "not conventional", "New"},
+		{reverted, "feat: oops", "New"},
+	} {
+		commit := changelog.NewCommit(c.hash, c.message)
+		commit.Author = changelog.Person{Name: c.author, Email: strings.ToLower(c.author) + "@example.com"}
+		commits = append(commits, *commit)
+	}
+	return &fakeQuerier{commits: commits, latestTag: "v1.0.0"}
+}
+
+func TestGenerate(t *testing.T) {
+	querier := newFakeQuerier()
+	release, err := changelog.Generate(context.Background(), changelog.Options{
+		Querier:       querier,
+		Version:       "1.1.0",
+		FromLatestTag: true,
+		Contributors:  true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if release.Repo != "https://gitlab.com/skuid/changelog" || release.Style != linkStyle.Gitlab {
+		t.Errorf("Expected the querier's origin and its style, got %s %s", release.Repo, release.Style)
+	}
+	if release.From != "v1.0.0" || release.To != "v1.1.0" {
+		t.Errorf("Expected to compare v1.0.0 with v1.1.0, got %s...%s", release.From, release.To)
+	}
+	if want := (changelog.CommitRange{From: "v1.0.0", To: ""}); !reflect.DeepEqual(querier.ranges[0], want) {
+		t.Errorf("Expected range %+v, got %+v", want, querier.ranges[0])
+	}
+
+	if !droppedHashes(release.Dropped, revert, reverted) {
+		t.Errorf("Expected the revert and reverted commit to be dropped, got %v", release.Dropped)
+	}
+	if got := release.Sections.Order(); !reflect.DeepEqual(got, []string{"Features", "Bug Fixes", "Unknown"}) {
+		t.Errorf("Unexpected sections %v", got)
+	}
+	if got := release.Sections.Sections["Features"]["api"]; len(got) != 1 || got[0].Subject != "a thing" {
+		t.Errorf("Expected one feature, got %v", got)
+	}
+
+	names := []string{}
+	for _, contributor := range release.Contributors {
+		names = append(names, contributor.Summary())
+	}
+	if !reflect.DeepEqual(names, []string{"New (first contribution)", "Old"}) {
+		t.Errorf("Unexpected contributors %v", names)
+	}
+}
+
+func TestGenerateContributorsProcessed(t *testing.T) {
+	querier := newFakeQuerier()
+	for _, message := range []string{"feat(deps): a bot feature", "chore(deps): bump a dependency"} {
+		commit := changelog.NewCommit("6666666666666666666666666666666666666666", message)
+		commit.Author = changelog.Person{Name: "dependabot[bot]", Email: "bot@example.com"}
+		querier.commits = append(querier.commits, *commit)
+	}
+	dropBots, err := changelog.NewProcessor("drop-bots", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	release, err := changelog.Generate(context.Background(), changelog.Options{
+		Querier:       querier,
+		FromLatestTag: true,
+		Contributors:  true,
+		Processors:    []changelog.Processor{dropBots},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, ok := release.Sections.Sections["Features"]["deps"]; ok {
+		t.Errorf("Expected the bot's feature to be dropped, got %v", release.Sections.Sections["Features"])
+	}
+	names := []string{}
+	for _, contributor := range release.Contributors {
+		names = append(names, contributor.Summary())
+	}
+	if !reflect.DeepEqual(names, []string{"New (first contribution)", "Old"}) {
+		t.Errorf("Expected the bot not to be a contributor, got %v", names)
+	}
+}
+
+func TestGenerateNoMatchingTag(t *testing.T) {
+	querier := newFakeQuerier()
+	querier.latestTag = ""
+	_, err := changelog.Generate(context.Background(), changelog.Options{Querier: querier, FromLatestTag: true})
+	if !changelog.IsNoMatchingTag(err) {
+		t.Errorf("Expected a NoMatchingTagError, got %v", err)
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		opts changelog.Options
+		err  string
+		to   string
+	}{
+		{"no querier", changelog.Options{}, "A querier is required", ""},
+		{
+			"pull requests by date",
+			changelog.Options{Querier: newFakeQuerier(), GroupBy: changelog.GroupByPullRequests, Since: time.Now()},
+			"Grouping by pull-requests requires from/to rather than since/until", "",
+		},
+		{"explicit to", changelog.Options{Querier: newFakeQuerier(), From: "v1.0.0", To: "v1.0.1", Version: "1.1.0"}, "", "v1.0.1"},
+		{"tag", changelog.Options{Querier: newFakeQuerier(), From: "v1.0.0", To: "HEAD", Tag: "release-1.1", Version: "1.1.0"}, "", "release-1.1"},
+		{"prefixed tag", changelog.Options{Querier: newFakeQuerier(), From: "api/v1.0.0", Version: "1.1.0"}, "", "api/v1.1.0"},
+		{"no previous tag", changelog.Options{Querier: newFakeQuerier(), Version: "1.1.0"}, "", ""},
+	}
+
+	for _, c := range cases {
+		release, err := changelog.Generate(context.Background(), c.opts)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		if release.To != c.to {
+			t.Errorf("%s: expected to compare with %q, got %q", c.name, c.to, release.To)
+		}
+	}
+}
+
+func TestGenerateParseOptions(t *testing.T) {
+	tracker, err := changelog.NewTracker("things", `a (thing)`, "https://things.example.com/{key}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	feature := func(opts changelog.Options) (*changelog.Release, changelog.Commit) {
+		t.Helper()
+		opts.Querier = newFakeQuerier()
+		release, err := changelog.Generate(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		return release, release.Sections.Sections["Features"]["api"][0]
+	}
+
+	release, commit := feature(changelog.Options{
+		Repo:       "https://git.example.com/skuid/changelog",
+		Hosts:      linkStyle.Hosts{"git.example.com": "forge"},
+		LinkStyles: linkStyle.Styles{"forge": {Commit: "{repo}/c/{hash}"}},
+		Keywords:   changelog.Keywords{Closes: []string{"resolves"}},
+		Trackers:   []changelog.Tracker{tracker},
+	})
+	if release.Style != "forge" || release.Links.CommitLink("abc", release.Repo) != "https://git.example.com/skuid/changelog/c/abc" {
+		t.Errorf("Expected the links of the host's style, got %s %+v", release.Style, release.Links)
+	}
+	want := []changelog.Reference{{Tracker: "things", Key: "thing", URL: "https://things.example.com/thing"}}
+	if len(commit.Closes) != 0 || !reflect.DeepEqual(commit.References, want) {
+		t.Errorf("Expected the keywords and trackers of the options, got closes %v and references %v", commit.Closes, commit.References)
+	}
+
+	// Settings don't carry over from one call to the next
+	release, commit = feature(changelog.Options{Repo: "https://git.example.com/skuid/changelog"})
+	if release.Style != linkStyle.Github || !reflect.DeepEqual(commit.Closes, []string{"4"}) || len(commit.References) != 0 {
+		t.Errorf("Expected the defaults, got style %s, closes %v and references %v", release.Style, commit.Closes, commit.References)
+	}
+
+	_, err = changelog.Generate(context.Background(), changelog.Options{Querier: newFakeQuerier(), Style: "forge"})
+	if err == nil || !strings.Contains(err.Error(), "Link style forge not found") {
+		t.Errorf("Expected an error for an unknown style, got %v", err)
+	}
+}
+
+func TestGenerateByDate(t *testing.T) {
+	querier := newFakeQuerier()
+	until := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	release, err := changelog.Generate(context.Background(), changelog.Options{
+		Querier:        querier,
+		Repo:           "https://github.com/skuid/changelog",
+		Until:          until,
+		IncludeAll:     true,
+		KeepDuplicates: true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if want := (changelog.CommitRange{Since: time.Unix(1, 0), Until: until}); !reflect.DeepEqual(querier.ranges[0], want) {
+		t.Errorf("Expected range %+v, got %+v", want, querier.ranges[0])
+	}
+	if release.From != "" || release.To != "" || len(release.Dropped) != 0 {
+		t.Errorf("Expected no compare link or dropped commits, got %+v", release)
+	}
+	if got := release.Sections.Sections["Unknown"]["Unknown"]; len(got) != 1 || got[0].Subject != "not conventional" {
+		t.Errorf("Expected the unparsed commit in Unknown, got %v", got)
+	}
+}
+
+func TestGenerateWrite(t *testing.T) {
+	release, err := changelog.Generate(context.Background(), changelog.Options{
+		Querier: newFakeQuerier(),
+		Repo:    "https://github.com/skuid/changelog",
+		Version: "1.1.0",
+		From:    "v1.0.0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	release.Date = time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	if err := (writer.MarkdownWriter{Writer: &out}).Write(release); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	heading := "## [1.1.0](https://github.com/skuid/changelog/compare/v1.0.0...v1.1.0) (2017-08-01)"
+	if !strings.Contains(out.String(), heading) {
+		errorDiff(t, "Heading not found", heading, out.String())
+	}
+}
+
+func TestGenerateWriteTagLink(t *testing.T) {
+	release, err := changelog.Generate(context.Background(), changelog.Options{
+		Querier: newFakeQuerier(),
+		Repo:    "https://git.sr.ht/~skuid/changelog",
+		Version: "1.1.0",
+		From:    "v1.0.0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	release.Date = time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	if err := (writer.MarkdownWriter{Writer: &out}).Write(release); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	// Sourcehut can't compare revisions, so the version links to its tag
+	heading := "## [1.1.0](https://git.sr.ht/~skuid/changelog/refs/v1.1.0) (2017-08-01)"
+	if !strings.Contains(out.String(), heading) {
+		errorDiff(t, "Heading not found", heading, out.String())
+	}
+}
+
+// droppedHashes reports whether exactly the given commits were dropped
+func droppedHashes(dropped []changelog.DroppedCommit, hashes ...string) bool {
+	got := map[string]bool{}
+	for _, d := range dropped {
+		got[d.Commit.Hash] = true
+	}
+	for _, hash := range hashes {
+		if !got[hash] {
+			return false
+		}
+	}
+	return len(got) == len(hashes)
+}
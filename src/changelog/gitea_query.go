@@ -0,0 +1,375 @@
+package changelog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/remote"
+	"github.com/skuid/changelog/src/transport"
+)
+
+// giteaPageSize is the largest page Gitea and Forgejo return by default
+const giteaPageSize = 50
+
+type giteaQuerier struct {
+	repo   string
+	apiURL string
+	owner  string
+	name   string
+	token  string
+	filter QueryFilter
+	client *http.Client
+}
+
+// NewGiteaQuerier queries a Gitea or Forgejo instance for commits. The API is
+// found at `/api/v1` on the host of the repository URL.
+func NewGiteaQuerier(repo, token string, filter QueryFilter) Querier {
+	g := giteaQuerier{repo: repo, token: token, filter: filter, client: transport.NewClient()}
+	if u, err := remote.Parse(repo); err == nil {
+		g.apiURL = fmt.Sprintf("%s://%s/api/v1", u.Scheme, u.Host)
+		g.owner, g.name = u.Owner, u.Repo
+	}
+	return g
+}
+
+type giteaCommit struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Message string `json:"message"`
+		Author  struct {
+			Name  string    `json:"name"`
+			Email string    `json:"email"`
+			Date  time.Time `json:"date"`
+		} `json:"author"`
+	} `json:"commit"`
+	Parents []struct {
+		SHA string `json:"sha"`
+	} `json:"parents"`
+	Files []struct {
+		Filename string `json:"filename"`
+	} `json:"files"`
+}
+
+func (c giteaCommit) commit() *Commit {
+	commit := NewCommit(c.SHA, c.Commit.Message)
+	if commit == nil {
+		return nil
+	}
+	commit.Author = Person{
+		Name:  c.Commit.Author.Name,
+		Email: c.Commit.Author.Email,
+	}
+	return commit
+}
+
+// changesPaths reports whether the commit changes any of the paths, or any
+// file in them
+func (c giteaCommit) changesPaths(paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, file := range c.Files {
+		for _, path := range paths {
+			path = strings.Trim(path, "/")
+			if path == "" || file.Filename == path || strings.HasPrefix(file.Filename, path+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type giteaPullRequest struct {
+	Number         int        `json:"number"`
+	Title          string     `json:"title"`
+	Body           string     `json:"body"`
+	Merged         bool       `json:"merged"`
+	MergedAt       *time.Time `json:"merged_at"`
+	MergeCommitSHA string     `json:"merge_commit_sha"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	User           struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+}
+
+// commit parses the pull request title and body as if it were a commit message
+func (p giteaPullRequest) commit() *Commit {
+	body := strings.Replace(p.Body, "\r\n", "\n", -1)
+	commit := NewCommit(p.MergeCommitSHA, fmt.Sprintf("%s\n\n%s", p.Title, body))
+	if commit == nil {
+		return nil
+	}
+	commit.Author = Person{Name: p.User.Login}
+	commit.PullRequest = &PullRequest{Number: p.Number, Title: p.Title}
+	for _, label := range p.Labels {
+		commit.PullRequest.Labels = append(commit.PullRequest.Labels, label.Name)
+	}
+	return commit
+}
+
+// repoPath returns the API URL of a path in the repository
+func (g giteaQuerier) repoPath(format string, args ...interface{}) string {
+	return fmt.Sprintf("%s/repos/%s/%s%s", g.apiURL, url.PathEscape(g.owner), url.PathEscape(g.name), fmt.Sprintf(format, args...))
+}
+
+// get sends a GET request to the Gitea API, decoding the response into v
+func (g giteaQuerier) get(ctx context.Context, path string, v interface{}) error {
+	body, err := g.getRaw(ctx, path)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(json.Unmarshal(body, v), "Could not decode %s", path)
+}
+
+func (g giteaQuerier) getRaw(ctx context.Context, path string) ([]byte, error) {
+	if g.apiURL == "" {
+		return nil, errors.Errorf("%s is not a Gitea repository URL", g.repo)
+	}
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	if g.token != "" {
+		req.Header.Set("Authorization", "token "+g.token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.WithStack(&statusError{path: path, code: resp.StatusCode, body: strings.TrimSpace(string(body))})
+	}
+	return body, nil
+}
+
+// eachCommit calls fn with each commit listed with the parameters, a page at a
+// time
+func (g giteaQuerier) eachCommit(ctx context.Context, params url.Values, fn func(giteaCommit) error) error {
+	params.Set("limit", strconv.Itoa(giteaPageSize))
+	for page := 1; ; page++ {
+		params.Set("page", strconv.Itoa(page))
+		var commits []giteaCommit
+		if err := g.get(ctx, g.repoPath("/commits?%s", params.Encode()), &commits); err != nil {
+			return err
+		}
+		for _, commit := range commits {
+			if err := fn(commit); err != nil {
+				return err
+			}
+		}
+		if len(commits) < giteaPageSize {
+			return nil
+		}
+	}
+}
+
+// eachRangeCommit calls fn with each commit in the range, newest first
+func (g giteaQuerier) eachRangeCommit(ctx context.Context, r CommitRange, fn func(giteaCommit) error) error {
+	params := url.Values{}
+	if r.byDate() {
+		if !r.Since.IsZero() {
+			params.Set("since", r.Since.Format(time.RFC3339))
+		}
+		if !r.Until.IsZero() {
+			params.Set("until", r.Until.Format(time.RFC3339))
+		}
+		return g.eachCommit(ctx, params, fn)
+	}
+
+	if r.From == "" {
+		if to := r.to(); to != "HEAD" {
+			params.Set("sha", to)
+		}
+		return g.eachCommit(ctx, params, fn)
+	}
+
+	// The comparison lists every commit reachable from `to` but not from
+	// `from`, newest first like `git log from..to`, including the commits
+	// of merged branches
+	var comparison struct {
+		Commits []giteaCommit `json:"commits"`
+	}
+	if err := g.get(ctx, g.repoPath("/compare/%s...%s", url.PathEscape(r.From), url.PathEscape(r.to())), &comparison); err != nil {
+		return err
+	}
+	for _, commit := range comparison.Commits {
+		if err := fn(commit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g giteaQuerier) GetOrigin(ctx context.Context) (string, error) {
+	return g.repo, nil
+}
+
+func (g giteaQuerier) GetCommits(ctx context.Context, from, to string) (Commits, error) {
+	return collectCommits(ctx, g, CommitRange{From: from, To: to})
+}
+
+func (g giteaQuerier) GetCommitRange(ctx context.Context, since, until time.Time) (Commits, error) {
+	return collectCommits(ctx, g, CommitRange{Since: since, Until: until})
+}
+
+// ForEachCommit lists commits a page at a time
+func (g giteaQuerier) ForEachCommit(ctx context.Context, r CommitRange, fn CommitFunc) error {
+	merges := &mergeFilter{policy: g.filter.Merges}
+	err := g.eachRangeCommit(ctx, r, func(c giteaCommit) error {
+		parents := make([]string, len(c.Parents))
+		for i := range c.Parents {
+			parents[i] = c.Parents[i].SHA
+		}
+		if !merges.keep(c.SHA, parents) || !c.changesPaths(g.filter.Paths) {
+			return nil
+		}
+		commit := c.commit()
+		if commit == nil {
+			return nil
+		}
+		return fn(*commit)
+	})
+	if err == ErrStopIteration {
+		return nil
+	}
+	return err
+}
+
+// GetPullRequests returns a commit for each pull request whose merge commit is
+// between `from` and `to`. The commit is parsed from the pull request title,
+// and its body is searched for closes and breaks references.
+func (g giteaQuerier) GetPullRequests(ctx context.Context, from, to string) (Commits, error) {
+	shas := map[string]bool{}
+	var oldest time.Time
+	err := g.eachRangeCommit(ctx, CommitRange{From: from, To: to}, func(c giteaCommit) error {
+		if !c.changesPaths(g.filter.Paths) {
+			return nil
+		}
+		shas[c.SHA] = true
+		if date := c.Commit.Author.Date; oldest.IsZero() || date.Before(oldest) {
+			oldest = date
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	commits := Commits{}
+	params := url.Values{}
+	params.Set("state", "closed")
+	params.Set("sort", "recentupdate")
+	params.Set("limit", strconv.Itoa(giteaPageSize))
+	for page := 1; ; page++ {
+		params.Set("page", strconv.Itoa(page))
+		var pulls []giteaPullRequest
+		if err := g.get(ctx, g.repoPath("/pulls?%s", params.Encode()), &pulls); err != nil {
+			return nil, err
+		}
+		for _, pull := range pulls {
+			if !pull.Merged || !shas[pull.MergeCommitSHA] {
+				continue
+			}
+			if commit := pull.commit(); commit != nil {
+				commits = append(commits, *commit)
+			}
+		}
+		// Pull requests are sorted by when they were last updated, so once
+		// we're past the oldest commit there's nothing left to find
+		if len(pulls) < giteaPageSize || (!oldest.IsZero() && pulls[len(pulls)-1].UpdatedAt.Before(oldest)) {
+			return commits, nil
+		}
+	}
+}
+
+func (g giteaQuerier) GetLatestCommit(ctx context.Context) (string, error) {
+	var commits []giteaCommit
+	if err := g.get(ctx, g.repoPath("/commits?limit=1&stat=false&files=false"), &commits); err != nil {
+		return "", err
+	}
+	if len(commits) == 0 {
+		return "", errors.New("No commits in response")
+	}
+	return commits[0].SHA, nil
+}
+
+// GetTags returns every tag in the repository
+func (g giteaQuerier) GetTags(ctx context.Context) ([]Tag, error) {
+	tags := []Tag{}
+	for page := 1; ; page++ {
+		var giteaTags []struct {
+			Name   string `json:"name"`
+			Commit struct {
+				SHA     string    `json:"sha"`
+				Created time.Time `json:"created"`
+			} `json:"commit"`
+		}
+		if err := g.get(ctx, g.repoPath("/tags?page=%d&limit=%d", page, giteaPageSize), &giteaTags); err != nil {
+			return nil, err
+		}
+		for _, tag := range giteaTags {
+			tags = append(tags, Tag{Name: tag.Name, Commit: tag.Commit.SHA, Date: tag.Commit.Created})
+		}
+		if len(giteaTags) < giteaPageSize {
+			return tags, nil
+		}
+	}
+}
+
+// IsAncestor reports whether commit is part of the history of `to`, which is
+// when comparing `to` with commit finds no new commits
+func (g giteaQuerier) IsAncestor(ctx context.Context, commit, to string) (bool, error) {
+	var comparison struct {
+		TotalCommits int `json:"total_commits"`
+	}
+	if err := g.get(ctx, g.repoPath("/compare/%s...%s", url.PathEscape(to), url.PathEscape(commit)), &comparison); err != nil {
+		return false, err
+	}
+	return comparison.TotalCommits == 0, nil
+}
+
+// GetLatestTag returns the commit of the latest tag reachable from `to`
+func (g giteaQuerier) GetLatestTag(ctx context.Context, to string) (string, error) {
+	tag, err := LatestTag(ctx, g, g.filter, to)
+	return tag.Commit, err
+}
+
+// GetLatestTagVersion returns the name of the latest tag reachable from `to`
+func (g giteaQuerier) GetLatestTagVersion(ctx context.Context, to string) (string, error) {
+	tag, err := LatestTag(ctx, g, g.filter, to)
+	return tag.Name, err
+}
+
+func (g giteaQuerier) GetConfig(ctx context.Context) (io.Reader, error) {
+	return findConfig(ctx, g.GetFile)
+}
+
+// GetFile returns a file from the default branch
+func (g giteaQuerier) GetFile(ctx context.Context, path string) (io.Reader, error) {
+	body, err := g.getRaw(ctx, g.repoPath("/raw/%s", strings.TrimPrefix(path, "/")))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(body), nil
+}
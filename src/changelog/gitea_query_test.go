@@ -0,0 +1,190 @@
+package changelog
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newTestGiteaQuerier returns a giteaQuerier pointed at a local stand-in for
+// the Gitea API
+func newTestGiteaQuerier(t *testing.T, mux *http.ServeMux, filter QueryFilter) (giteaQuerier, func()) {
+	t.Helper()
+	server := httptest.NewServer(mux)
+	g := NewGiteaQuerier(server.URL+"/skuid/changelog.git", "secret", filter).(giteaQuerier)
+	return g, server.Close
+}
+
+func TestNewGiteaQuerier(t *testing.T) {
+	g := NewGiteaQuerier("git@git.example.com:tools/changelog.git", "", QueryFilter{}).(giteaQuerier)
+	if g.apiURL != "https://git.example.com/api/v1" || g.owner != "tools" || g.name != "changelog" {
+		t.Errorf("Expected the API of git.example.com for tools/changelog, got %s %s/%s", g.apiURL, g.owner, g.name)
+	}
+}
+
+func TestGiteaForEachCommit(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/skuid/changelog/compare/v1.0.0...HEAD", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_commits": 3, "commits": [
+			{"sha": "aaa", "commit": {"message": "fix(api): a thing\n\nCloses #3", "author": {"name": "Ann", "email": "ann@example.com"}}, "parents": [{"sha": "bbb"}], "files": [{"filename": "api/handler.go"}]},
+			{"sha": "bbb", "commit": {"message": "Merge branch 'other'"}, "parents": [{"sha": "ccc"}, {"sha": "ddd"}], "files": [{"filename": "api/other.go"}]},
+			{"sha": "ddd", "commit": {"message": "feat(api): merged branch"}, "parents": [{"sha": "ccc"}], "files": [{"filename": "api/other.go"}]}
+		]}`)
+	})
+	var pages []string
+	mux.HandleFunc("/api/v1/repos/skuid/changelog/commits", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "token secret" {
+			t.Errorf("Expected the token to be sent, got %q", got)
+		}
+		if got := r.URL.Query().Get("sha"); got != "" {
+			t.Errorf("Expected HEAD to list the default branch, got sha %q", got)
+		}
+		pages = append(pages, r.URL.Query().Get("page"))
+		if r.URL.Query().Get("page") != "1" {
+			fmt.Fprint(w, `[
+				{"sha": "ccc", "commit": {"message": "feat: tagged"}, "parents": [{"sha": "ddd"}]}
+			]`)
+			return
+		}
+		// A full page, so the next one is requested
+		fmt.Fprint(w, "[")
+		for i := 0; i < giteaPageSize; i++ {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			switch i {
+			case 0:
+				fmt.Fprint(w, `{"sha": "aaa", "commit": {"message": "fix(api): a thing\n\nCloses #3", "author": {"name": "Ann", "email": "ann@example.com"}}, "parents": [{"sha": "bbb"}], "files": [{"filename": "api/handler.go"}]}`)
+			case 1:
+				fmt.Fprint(w, `{"sha": "bbb", "commit": {"message": "Merge branch 'other'"}, "parents": [{"sha": "x"}, {"sha": "y"}], "files": [{"filename": "api/other.go"}]}`)
+			default:
+				fmt.Fprintf(w, `{"sha": "%03d", "commit": {"message": "docs: readme"}, "parents": [{"sha": "x"}], "files": [{"filename": "README.md"}]}`, i)
+			}
+		}
+		fmt.Fprint(w, "]")
+	})
+
+	g, closer := newTestGiteaQuerier(t, mux, QueryFilter{Paths: []string{"api/"}, Merges: ExcludeMerges})
+	defer closer()
+
+	want := NewCommit("aaa", "fix(api): a thing\n\nCloses #3")
+	want.Author = Person{Name: "Ann", Email: "ann@example.com"}
+
+	commits, err := g.GetCommits(context.Background(), "", "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(pages, []string{"1", "2"}) {
+		t.Errorf("Expected pages 1 and 2, got %v", pages)
+	}
+	if !reflect.DeepEqual(commits, Commits{*want}) {
+		t.Errorf("Expected %+v, got %+v", Commits{*want}, commits)
+	}
+
+	// Ranges are compared, which includes the commits of merged branches
+	commits, err = g.GetCommits(context.Background(), "v1.0.0", "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(pages) != 2 {
+		t.Errorf("Expected the range not to list commits, got pages %v", pages)
+	}
+	if len(commits) != 2 || !reflect.DeepEqual(commits[0], *want) || commits[1].Hash != "ddd" {
+		t.Errorf("Expected aaa and ddd, got %+v", commits)
+	}
+}
+
+func TestGiteaGetPullRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/skuid/changelog/compare/v1.0.0...v1.1.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_commits": 2, "commits": [
+			{"sha": "aaa", "commit": {"message": "Merge pull request 'Add a thing' (#1)", "author": {"date": "2017-01-03T00:00:00Z"}}},
+			{"sha": "bbb", "commit": {"message": "feat: a thing", "author": {"date": "2017-01-02T00:00:00Z"}}}
+		]}`)
+	})
+	mux.HandleFunc("/api/v1/repos/skuid/changelog/pulls", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("state"); got != "closed" {
+			t.Errorf("Expected closed pull requests, got %q", got)
+		}
+		fmt.Fprint(w, `[
+			{"number": 2, "title": "Not merged", "merged": false, "updated_at": "2017-01-04T00:00:00Z"},
+			{"number": 1, "title": "feat(api): add a thing", "body": "Closes #5", "merged": true, "merge_commit_sha": "aaa", "updated_at": "2017-01-03T00:00:00Z", "user": {"login": "ann"}, "labels": [{"name": "enhancement"}]}
+		]`)
+	})
+
+	g, closer := newTestGiteaQuerier(t, mux, QueryFilter{})
+	defer closer()
+
+	commits, err := g.GetPullRequests(context.Background(), "v1.0.0", "v1.1.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(commits) != 1 {
+		t.Fatalf("Expected 1 pull request, got %d", len(commits))
+	}
+	got := commits[0]
+	want := &PullRequest{Number: 1, Title: "feat(api): add a thing", Labels: []string{"enhancement"}}
+	if !reflect.DeepEqual(got.PullRequest, want) {
+		t.Errorf("Expected pull request %v, got %v", want, got.PullRequest)
+	}
+	if got.Hash != "aaa" || got.Subject != "add a thing" || !reflect.DeepEqual(got.Closes, []string{"5"}) || got.Author.Name != "ann" {
+		t.Errorf("Pull request not parsed, got %+v", got)
+	}
+}
+
+func TestGiteaLatestTag(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/skuid/changelog/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"name": "v2.0.0", "commit": {"sha": "bbb"}},
+			{"name": "v1.0.0", "commit": {"sha": "aaa"}}
+		]`)
+	})
+	mux.HandleFunc("/api/v1/repos/skuid/changelog/compare/", func(w http.ResponseWriter, r *http.Request) {
+		// v2.0.0 is on another branch, so it has a commit `HEAD` doesn't
+		total := 0
+		if r.URL.Path == "/api/v1/repos/skuid/changelog/compare/HEAD...bbb" {
+			total = 1
+		}
+		fmt.Fprintf(w, `{"total_commits": %d}`, total)
+	})
+
+	g, closer := newTestGiteaQuerier(t, mux, QueryFilter{})
+	defer closer()
+
+	version, err := g.GetLatestTagVersion(context.Background(), "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if version != "v1.0.0" {
+		t.Errorf("Expected the reachable tag v1.0.0, got %s", version)
+	}
+}
+
+func TestGiteaGetConfig(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/skuid/changelog/raw/.clog.toml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "[sections]\n")
+	})
+	mux.HandleFunc("/api/v1/repos/skuid/changelog/raw/missing.toml", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+
+	g, closer := newTestGiteaQuerier(t, mux, QueryFilter{})
+	defer closer()
+
+	config, err := g.GetConfig(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if raw, _ := ioutil.ReadAll(config); string(raw) != "[sections]\n" {
+		t.Errorf("Expected the config file, got %q", raw)
+	}
+	if _, err := g.GetFile(context.Background(), "missing.toml"); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
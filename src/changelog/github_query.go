@@ -5,58 +5,92 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
-	"golang.org/x/oauth2"
+	"github.com/skuid/changelog/src/transport"
 )
 
 type githubQuerier struct {
 	repo   string
 	client *github.Client
+	labels SectionAliasMap
+	filter QueryFilter
+	token  string
+}
+
+// newGithubClient returns an authenticated client. Responses are cached in
+// cacheDir unless it is empty.
+func newGithubClient(token, cacheDir string) *github.Client {
+	return github.NewClient(transport.NewTokenClient(token, cacheDir))
 }
 
 // NewGithubQuerier queries Github for commits
-func NewGithubQuerier(repo, token string) Querier {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	client := github.NewClient(oauth2.NewClient(ctx, ts))
-	return githubQuerier{repo, client}
+func NewGithubQuerier(repo, token string, filter QueryFilter) Querier {
+	return githubQuerier{repo, newGithubClient(token, ""), nil, filter, token}
 }
 
-func (g githubQuerier) getOwnerRepo() (owner string, repo string) {
+// NewGithubLabelQuerier queries Github for commits, replacing each commit with
+// the pull request it was merged in. The section of each pull request is
+// chosen from its labels using the given label alias map.
+func NewGithubLabelQuerier(repo, token string, labels SectionAliasMap, filter QueryFilter) Querier {
+	return githubQuerier{repo, newGithubClient(token, ""), labels, filter, token}
+}
+
+// withHTTPCache returns a copy of the querier that revalidates cached API
+// responses in dir with ETags
+func (g githubQuerier) withHTTPCache(dir string) Querier {
+	client := newGithubClient(g.token, dir)
+	client.BaseURL = g.client.BaseURL
+	g.client = client
+	return g
+}
+
+// mutableCommits reports whether commits are grouped by pull request labels,
+// which can change after the commits are merged
+func (g githubQuerier) mutableCommits() bool {
+	return g.labels != nil
+}
+
+// GithubOwnerRepo returns the owner and repository name from a Github URL
+func GithubOwnerRepo(repoURL string) (owner string, repo string) {
 	regex := regexp.MustCompile(`(?:.*)github.com[\/\:]([\w-]*)\/([\w-]*)(?:\.git)?`)
-	if capture := regex.FindStringSubmatch(g.repo); len(capture) > 2 {
+	if capture := regex.FindStringSubmatch(repoURL); len(capture) > 2 {
 		return capture[1], capture[2]
 	}
 	return "", ""
 }
 
-func (g githubQuerier) GetOrigin() (string, error) {
+func (g githubQuerier) getOwnerRepo() (owner string, repo string) {
+	return GithubOwnerRepo(g.repo)
+}
+
+func (g githubQuerier) GetOrigin(ctx context.Context) (string, error) {
 	return g.repo, nil
 }
 
-func (g githubQuerier) listCommits(opts *github.CommitsListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+func (g githubQuerier) listCommits(ctx context.Context, opts *github.CommitsListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
 	owner, repo := g.getOwnerRepo()
 
 	return g.client.Repositories.ListCommits(
-		context.Background(),
+		ctx,
 		owner,
 		repo,
 		opts,
 	)
 }
 
-func (g githubQuerier) compareCommits(from, to string) (*github.CommitsComparison, *github.Response, error) {
+func (g githubQuerier) compareCommits(ctx context.Context, from, to string) (*github.CommitsComparison, *github.Response, error) {
 	owner, repo := g.getOwnerRepo()
 
 	return g.client.Repositories.CompareCommits(
-		context.Background(),
+		ctx,
 		owner,
 		repo,
 		from,
@@ -64,130 +98,466 @@ func (g githubQuerier) compareCommits(from, to string) (*github.CommitsCompariso
 	)
 }
 
-func (g githubQuerier) GetCommitRange(since, until time.Time) (Commits, error) {
-	allGhCommits := []*github.RepositoryCommit{}
+// githubPathFilter keeps the commits that change at least one of the filtered
+// paths. The history of each path is listed alongside the commits, a page at a
+// time, only as far back as the commit being checked.
+type githubPathFilter struct {
+	g       githubQuerier
+	cursors []*githubPathCursor
+	touched map[string]bool
+}
 
-	opt := &github.CommitsListOptions{Since: since, Until: until}
-	for {
-		ghCommits, resp, err := g.listCommits(opt)
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
+type githubPathCursor struct {
+	opt *github.CommitsListOptions
+	// oldest is the date of the last commit listed so far
+	oldest time.Time
+	done   bool
+}
 
-		allGhCommits = append(allGhCommits, ghCommits...)
-		if resp.NextPage == 0 {
-			break
-		}
-		opt.Page = resp.NextPage
+func (g githubQuerier) newPathFilter(sha string) *githubPathFilter {
+	if sha == "HEAD" {
+		// An empty SHA lists from the default branch
+		sha = ""
+	}
+	f := &githubPathFilter{g: g, touched: map[string]bool{}}
+	for _, path := range g.filter.Paths {
+		f.cursors = append(f.cursors, &githubPathCursor{
+			opt: &github.CommitsListOptions{SHA: sha, Path: path},
+		})
 	}
+	return f
+}
 
-	commits := Commits{}
-	for _, c := range allGhCommits {
-		commit := NewCommit(c.GetSHA(), c.Commit.GetMessage())
-		if commit == nil {
-			continue
+// keep reports whether the commit changes any of the filtered paths
+func (f *githubPathFilter) keep(ctx context.Context, c *github.RepositoryCommit) (bool, error) {
+	if len(f.cursors) == 0 {
+		return true, nil
+	}
+	date := c.Commit.Committer.GetDate()
+	for _, cursor := range f.cursors {
+		for !cursor.done && (cursor.oldest.IsZero() || !cursor.oldest.Before(date)) {
+			pathCommits, resp, err := f.g.listCommits(ctx, cursor.opt)
+			if err != nil {
+				return false, errors.WithStack(err)
+			}
+			for _, pathCommit := range pathCommits {
+				f.touched[pathCommit.GetSHA()] = true
+				cursor.oldest = pathCommit.Commit.Committer.GetDate()
+			}
+			cursor.done = resp.NextPage == 0
+			cursor.opt.Page = resp.NextPage
 		}
-		commits = append(commits, *commit)
 	}
+	return f.touched[c.GetSHA()], nil
+}
 
-	return commits, nil
+func newGithubCommit(c *github.RepositoryCommit) *Commit {
+	commit := NewCommit(c.GetSHA(), c.Commit.GetMessage())
+	if commit == nil {
+		return nil
+	}
+	commit.Author = Person{
+		Name:  c.Commit.Author.GetName(),
+		Email: c.Commit.Author.GetEmail(),
+	}
+	return commit
 }
 
-func (g githubQuerier) GetCommits(from, to string) (Commits, error) {
-	allGhCommits := []*github.RepositoryCommit{}
+func (g githubQuerier) GetCommitRange(ctx context.Context, since, until time.Time) (Commits, error) {
+	return collectCommits(ctx, g, CommitRange{Since: since, Until: until})
+}
+
+// eachRangeCommit calls fn with each commit in the range, a page at a time
+func (g githubQuerier) eachRangeCommit(ctx context.Context, r CommitRange, fn func(*github.RepositoryCommit) error) error {
+	eachPage := func(opt *github.CommitsListOptions, fn func(*github.RepositoryCommit) error) error {
+		for {
+			ghCommits, resp, err := g.listCommits(ctx, opt)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			for _, commit := range ghCommits {
+				if err := fn(commit); err != nil {
+					return err
+				}
+			}
+			if resp.NextPage == 0 {
+				return nil
+			}
+			opt.Page = resp.NextPage
+		}
+	}
+
+	if r.byDate() {
+		return eachPage(&github.CommitsListOptions{Since: r.Since, Until: r.Until}, fn)
+	}
+
+	from, to := r.From, r.to()
+	if from == "" {
+		// No starting point, so list the entire history of `to`
+		return eachPage(&github.CommitsListOptions{SHA: to}, fn)
+	}
 
 	if to != "HEAD" {
-		comparison, _, err := g.compareCommits(from, to)
+		comparison, _, err := g.compareCommits(ctx, from, to)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return errors.WithStack(err)
 		}
 		if *comparison.TotalCommits >= 250 {
 			// We've hit GH's comparison limit
 			fmt.Fprint(os.Stderr, "Github limits commit comparison to 250 commits! Result may be truncated")
 		}
-		for _, commit := range comparison.Commits {
-			allGhCommits = append(allGhCommits, &commit)
-		}
-	} else {
-		opt := &github.CommitsListOptions{SHA: from}
-		for {
-			ghCommits, resp, err := g.listCommits(opt)
-			if err != nil {
-				return nil, errors.WithStack(err)
+		// The comparison lists oldest first
+		for i := len(comparison.Commits) - 1; i >= 0; i-- {
+			if err := fn(&comparison.Commits[i]); err != nil {
+				return err
 			}
+		}
+		return nil
+	}
 
-			allGhCommits = append(allGhCommits, ghCommits...)
-			if resp.NextPage == 0 {
-				break
-			}
-			opt.Page = resp.NextPage
+	// List back from the default branch until we reach `from`
+	owner, repo := g.getOwnerRepo()
+	fromSHA, _, err := g.client.Repositories.GetCommitSHA1(ctx, owner, repo, from, "")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = eachPage(&github.CommitsListOptions{}, func(commit *github.RepositoryCommit) error {
+		if commit.GetSHA() == fromSHA {
+			return errReachedFrom
 		}
+		return fn(commit)
+	})
+	if err == errReachedFrom {
+		return nil
 	}
+	return err
+}
 
-	commits := Commits{}
-	for _, c := range allGhCommits {
-		commit := NewCommit(c.GetSHA(), c.Commit.GetMessage())
+// errReachedFrom ends listing the default branch once the start of the range
+// is found
+var errReachedFrom = errors.New("reached the start of the range")
+
+func (g githubQuerier) GetCommits(ctx context.Context, from, to string) (Commits, error) {
+	return collectCommits(ctx, g, CommitRange{From: from, To: to})
+}
+
+// ForEachCommit lists commits a page at a time. When grouping by labels,
+// commits are merged into their pull requests as they are listed, and the
+// pull requests are passed to fn once the whole range has been read.
+func (g githubQuerier) ForEachCommit(ctx context.Context, r CommitRange, fn CommitFunc) error {
+	sha := r.to()
+	if r.byDate() {
+		sha = ""
+	}
+	paths := g.newPathFilter(sha)
+
+	merges := &mergeFilter{policy: g.filter.Merges}
+	grouper := g.newLabelGrouper()
+	err := g.eachRangeCommit(ctx, r, func(c *github.RepositoryCommit) error {
+		parents := make([]string, len(c.Parents))
+		for i := range c.Parents {
+			parents[i] = c.Parents[i].GetSHA()
+		}
+		if !merges.keep(c.GetSHA(), parents) {
+			return nil
+		}
+		keep, err := paths.keep(ctx, c)
+		if err != nil || !keep {
+			return err
+		}
+		commit := newGithubCommit(c)
 		if commit == nil {
-			continue
+			return nil
+		}
+		if g.labels != nil {
+			return grouper.add(ctx, *commit)
 		}
-		commits = append(commits, *commit)
+		return fn(*commit)
+	})
+	if err == ErrStopIteration {
+		return nil
 	}
+	if err != nil {
+		return err
+	}
+
+	for _, commit := range grouper.grouped {
+		if err := fn(commit); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPullRequests returns a commit for each pull request whose merge commit is
+// between `from` and `to`. The commit is parsed from the pull request title,
+// and its body is searched for closes and breaks references.
+func (g githubQuerier) GetPullRequests(ctx context.Context, from, to string) (Commits, error) {
+	paths := g.newPathFilter(to)
 
+	// Only the SHAs are kept to match against merge commits
+	shas := map[string]bool{}
+	var oldest time.Time
+	err := g.eachRangeCommit(ctx, CommitRange{From: from, To: to}, func(c *github.RepositoryCommit) error {
+		keep, err := paths.keep(ctx, c)
+		if err != nil || !keep {
+			return err
+		}
+		shas[c.GetSHA()] = true
+		date := c.Commit.Committer.GetDate()
+		if oldest.IsZero() || date.Before(oldest) {
+			oldest = date
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	commits := Commits{}
+	for page := 1; page != 0; {
+		pulls, resp, err := g.listClosedPullRequests(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		for _, pull := range pulls {
+			if pull.MergedAt == nil || !shas[pull.MergeCommitSHA] {
+				continue
+			}
+			commit := pull.commit()
+			if commit == nil {
+				continue
+			}
+			commits = append(commits, *commit)
+		}
+		// Pull requests are sorted by when they were last updated, so once
+		// we're past the oldest commit there's nothing left to find
+		if len(pulls) > 0 && !oldest.IsZero() && pulls[len(pulls)-1].UpdatedAt.Before(oldest) {
+			break
+		}
+		page = resp.NextPage
+	}
 	return commits, nil
 }
 
-func (g githubQuerier) GetLatestCommit() (string, error) {
-	ghCommits, _, err := g.listCommits(&github.CommitsListOptions{})
+// githubPullRequest is the subset of a pull request used for changelogs. The
+// vendored client doesn't support labels or the commits-to-pulls endpoint yet.
+type githubPullRequest struct {
+	Number         int        `json:"number"`
+	Title          string     `json:"title"`
+	Body           string     `json:"body"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	MergedAt       *time.Time `json:"merged_at"`
+	MergeCommitSHA string     `json:"merge_commit_sha"`
+	User           struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+}
+
+func (p githubPullRequest) pullRequest() *PullRequest {
+	pr := &PullRequest{Number: p.Number, Title: p.Title}
+	for _, label := range p.Labels {
+		pr.Labels = append(pr.Labels, label.Name)
+	}
+	return pr
+}
+
+// commit parses the pull request title and body as if it were a commit message
+func (p githubPullRequest) commit() *Commit {
+	body := strings.Replace(p.Body, "\r\n", "\n", -1)
+	commit := NewCommit(p.MergeCommitSHA, fmt.Sprintf("%s\n\n%s", p.Title, body))
+	if commit == nil {
+		return nil
+	}
+	commit.Author = Person{Name: p.User.Login}
+	commit.PullRequest = p.pullRequest()
+	return commit
+}
+
+func (g githubQuerier) listClosedPullRequests(ctx context.Context, page int) ([]githubPullRequest, *github.Response, error) {
+	owner, repo := g.getOwnerRepo()
+
+	params := url.Values{}
+	params.Set("state", "closed")
+	params.Set("sort", "updated")
+	params.Set("direction", "desc")
+	params.Set("per_page", "100")
+	params.Set("page", strconv.Itoa(page))
+
+	req, err := g.client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/pulls?%s", owner, repo, params.Encode()), nil)
 	if err != nil {
-		return "", errors.WithStack(err)
+		return nil, nil, errors.WithStack(err)
 	}
-	if len(ghCommits) == 0 {
-		return "", errors.New("No commits in response")
+
+	var pulls []githubPullRequest
+	resp, err := g.client.Do(ctx, req, &pulls)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
 	}
-	return ghCommits[0].GetSHA(), nil
+	return pulls, resp, nil
 }
 
-func (g githubQuerier) listTags() ([]*github.RepositoryTag, error) {
+func (g githubQuerier) getMergedPullRequest(ctx context.Context, sha string) (*PullRequest, error) {
 	owner, repo := g.getOwnerRepo()
 
-	tags, _, err := g.client.Repositories.ListTags(
-		context.Background(),
-		owner,
-		repo,
-		&github.ListOptions{},
-	)
-	return tags, err
+	req, err := g.client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/commits/%s/pulls", owner, repo, sha), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Accept", "application/vnd.github.groot-preview+json")
+
+	var pulls []githubPullRequest
+	if _, err := g.client.Do(ctx, req, &pulls); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, pull := range pulls {
+		if pull.MergedAt != nil {
+			return pull.pullRequest(), nil
+		}
+	}
+	return nil, nil
+}
+
+// labelGrouper replaces commits with the pull request they were merged in.
+// Commits that weren't merged through a pull request are left as they are.
+type labelGrouper struct {
+	g       githubQuerier
+	pulls   map[int]int
+	grouped Commits
+}
+
+func (g githubQuerier) newLabelGrouper() *labelGrouper {
+	return &labelGrouper{g: g, pulls: map[int]int{}, grouped: Commits{}}
 }
 
-func (g githubQuerier) GetLatestTag() (string, error) {
-	tags, err := g.listTags()
+func (l *labelGrouper) add(ctx context.Context, commit Commit) error {
+	pr, err := l.g.getMergedPullRequest(ctx, commit.Hash)
 	if err != nil {
-		return "", errors.WithStack(err)
+		return err
+	}
+	if pr == nil {
+		l.grouped = append(l.grouped, commit)
+		return nil
 	}
-	if len(tags) == 0 {
-		return "", errors.New("No tags in response")
+	if i, ok := l.pulls[pr.Number]; ok {
+		// Already have this pull request, keep any issue references
+		l.grouped[i].Closes = mergeStringSlices(l.grouped[i].Closes, commit.Closes)
+		l.grouped[i].Breaks = mergeStringSlices(l.grouped[i].Breaks, commit.Breaks)
+		l.grouped[i].References = mergeReferences(l.grouped[i].References, commit.References)
+		l.grouped[i].grouped = append(l.grouped[i].grouped, commit.message)
+		return nil
 	}
-	return tags[0].Commit.GetSHA(), nil
+
+	commit.PullRequest = pr
+	commit.Subject = pr.Title
+	commit.Component = ""
+	commit.rawCommitType = "Unknown"
+	if len(pr.Labels) > 0 {
+		commit.rawCommitType = pr.Labels[0]
+	}
+	for _, label := range pr.Labels {
+		if l.g.labels.Has(label) {
+			commit.rawCommitType = label
+			break
+		}
+	}
+	l.pulls[pr.Number] = len(l.grouped)
+	l.grouped = append(l.grouped, commit)
+	return nil
 }
 
-func (g githubQuerier) GetLatestTagVersion() (string, error) {
-	tags, err := g.listTags()
+// groupByLabels replaces commits with the pull request they were merged in, if
+// the querier was created with a label alias map
+func (g githubQuerier) groupByLabels(ctx context.Context, commits Commits) (Commits, error) {
+	if g.labels == nil {
+		return commits, nil
+	}
+	grouper := g.newLabelGrouper()
+	for _, commit := range commits {
+		if err := grouper.add(ctx, commit); err != nil {
+			return nil, err
+		}
+	}
+	return grouper.grouped, nil
+}
+
+func (g githubQuerier) GetLatestCommit(ctx context.Context) (string, error) {
+	ghCommits, _, err := g.listCommits(ctx, &github.CommitsListOptions{})
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
-	if len(tags) == 0 {
-		return "", errors.New("No tags in response")
+	if len(ghCommits) == 0 {
+		return "", errors.New("No commits in response")
 	}
-	return tags[0].Commit.GetSHA(), nil
+	return ghCommits[0].GetSHA(), nil
+}
+
+// GetTags returns every tag in the repository
+func (g githubQuerier) GetTags(ctx context.Context) ([]Tag, error) {
+	owner, repo := g.getOwnerRepo()
+
+	tags := []Tag{}
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		ghTags, resp, err := g.client.Repositories.ListTags(
+			ctx,
+			owner,
+			repo,
+			opt,
+		)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, tag := range ghTags {
+			tags = append(tags, Tag{Name: tag.GetName(), Commit: tag.Commit.GetSHA()})
+		}
+		if resp.NextPage == 0 {
+			return tags, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// IsAncestor reports whether commit is part of the history of `to`
+func (g githubQuerier) IsAncestor(ctx context.Context, commit, to string) (bool, error) {
+	comparison, _, err := g.compareCommits(ctx, commit, to)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	status := comparison.GetStatus()
+	return status == "ahead" || status == "identical", nil
+}
+
+// GetLatestTag returns the commit of the latest tag reachable from `to`
+func (g githubQuerier) GetLatestTag(ctx context.Context, to string) (string, error) {
+	tag, err := LatestTag(ctx, g, g.filter, to)
+	return tag.Commit, err
+}
+
+// GetLatestTagVersion returns the name of the latest tag reachable from `to`
+func (g githubQuerier) GetLatestTagVersion(ctx context.Context, to string) (string, error) {
+	tag, err := LatestTag(ctx, g, g.filter, to)
+	return tag.Name, err
+}
+
+func (g githubQuerier) GetConfig(ctx context.Context) (io.Reader, error) {
+	return findConfig(ctx, g.GetFile)
 }
 
-func (g githubQuerier) GetConfig() (io.Reader, error) {
+func (g githubQuerier) GetFile(ctx context.Context, path string) (io.Reader, error) {
 	owner, repo := g.getOwnerRepo()
 	fileContent, _, _, err := g.client.Repositories.GetContents(
-		context.Background(),
+		ctx,
 		owner,
 		repo,
-		"/.clog.toml",
+		"/"+path,
 		nil,
 	)
 	if err != nil {
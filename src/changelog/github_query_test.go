@@ -0,0 +1,324 @@
+package changelog
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestGithubQuerier returns a githubQuerier pointed at a local stand-in for
+// the Github API
+func newTestGithubQuerier(t *testing.T, mux *http.ServeMux) (githubQuerier, func()) {
+	t.Helper()
+	server := httptest.NewServer(mux)
+	g := NewGithubQuerier("https://github.com/skuid/changelog", "", QueryFilter{}).(githubQuerier)
+	g.client.BaseURL, _ = url.Parse(server.URL + "/")
+	return g, server.Close
+}
+
+func TestGroupByLabels(t *testing.T) {
+	mux := http.NewServeMux()
+	pulls := map[string]string{
+		"aaa": `[{"number": 1, "title": "Add a thing", "merged_at": "2017-01-01T00:00:00Z", "labels": [{"name": "docs"}, {"name": "enhancement"}]}]`,
+		"bbb": `[{"number": 1, "title": "Add a thing", "merged_at": "2017-01-01T00:00:00Z", "labels": [{"name": "docs"}, {"name": "enhancement"}]}]`,
+		"ccc": `[{"number": 2, "title": "Not merged", "merged_at": null}]`,
+	}
+	for sha, body := range pulls {
+		body := body
+		mux.HandleFunc(fmt.Sprintf("/repos/skuid/changelog/commits/%s/pulls", sha), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		})
+	}
+
+	g, closer := newTestGithubQuerier(t, mux)
+	defer closer()
+	g.labels = NewLabelAliasMap()
+
+	commits := Commits{
+		*NewCommit("aaa", "feat(thing): first part\n\nCloses #3"),
+		*NewCommit("bbb", "feat(thing): second part\n\nCloses #4"),
+		*NewCommit("ccc", "fix(other): direct push"),
+	}
+	got, err := g.groupByLabels(context.Background(), commits)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 commits, got %d", len(got))
+	}
+
+	pr := got[0]
+	want := &PullRequest{Number: 1, Title: "Add a thing", Labels: []string{"docs", "enhancement"}}
+	if !reflect.DeepEqual(pr.PullRequest, want) {
+		t.Errorf("Expected pull request %v, got %v", want, pr.PullRequest)
+	}
+	if pr.Subject != "Add a thing" || pr.rawCommitType != "enhancement" || pr.Component != "" {
+		t.Errorf("Pull request commit not formatted, got %+v", pr)
+	}
+	if !reflect.DeepEqual(pr.Closes, []string{"3", "4"}) {
+		t.Errorf("Expected closes [3 4], got %v", pr.Closes)
+	}
+	// Parsing again keeps the references of every commit in the pull request
+	NewParser(Keywords{}, nil).parseReferences(&pr)
+	if !reflect.DeepEqual(pr.Closes, []string{"3", "4"}) {
+		t.Errorf("Expected closes [3 4] after parsing again, got %v", pr.Closes)
+	}
+
+	if got[1].PullRequest != nil || got[1].rawCommitType != "fix" {
+		t.Errorf("Commit without pull request should be unchanged, got %+v", got[1])
+	}
+}
+
+func TestGroupByLabelsSections(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/skuid/changelog/commits/aaa/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"number": 1, "title": "Add a thing", "merged_at": "2017-01-01T00:00:00Z", "labels": [{"name": "enhancement"}]}]`)
+	})
+	mux.HandleFunc("/repos/skuid/changelog/commits/bbb/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+
+	g, closer := newTestGithubQuerier(t, mux)
+	defer closer()
+	// The label aliases are merged into the commit prefix aliases, like the
+	// sections of `--group-by labels`
+	sections := MergeSectionAliasMaps(NewSectionAliasMap(), NewLabelAliasMap())
+	g.labels = sections
+
+	commits := Commits{
+		*NewCommit("aaa", "add the thing"),
+		*NewCommit("bbb", "fix(other): direct push"),
+	}
+	grouped, err := g.groupByLabels(context.Background(), commits)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	got := FormatCommits(FilterCommits(grouped, sections.Grep(), false), sections)
+	if len(got) != 2 {
+		t.Fatalf("Expected the pull request and the direct push, got %+v", got)
+	}
+	if got[0].CommitType != "Features" || got[0].PullRequest == nil {
+		t.Errorf("Expected the pull request in Features, got %+v", got[0])
+	}
+	if got[1].CommitType != "Bug Fixes" || got[1].PullRequest != nil {
+		t.Errorf("Expected the direct push in Bug Fixes, got %+v", got[1])
+	}
+}
+
+func TestGetPullRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/skuid/changelog/compare/v1.0.0...v1.1.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_commits": 2, "commits": [
+			{"sha": "aaa", "commit": {"message": "Merge pull request #1", "committer": {"date": "2017-01-02T00:00:00Z"}}},
+			{"sha": "bbb", "commit": {"message": "fix: a thing", "committer": {"date": "2017-01-03T00:00:00Z"}}}
+		]}`)
+	})
+	mux.HandleFunc("/repos/skuid/changelog/pulls", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "closed" {
+			t.Errorf("Expected closed pull requests, got %s", r.URL.Query().Get("state"))
+		}
+		fmt.Fprint(w, `[
+			{"number": 3, "title": "feat(api): not merged", "updated_at": "2017-01-04T00:00:00Z", "merged_at": null},
+			{"number": 2, "title": "fix(ui): Fix a thing", "body": "Closes #10\r\nBreaks #11", "updated_at": "2017-01-03T00:00:00Z", "merged_at": "2017-01-03T00:00:00Z", "merge_commit_sha": "bbb", "user": {"login": "jane"}},
+			{"number": 1, "title": "feat(api): Add a thing", "updated_at": "2017-01-02T00:00:00Z", "merged_at": "2017-01-02T00:00:00Z", "merge_commit_sha": "aaa"},
+			{"number": 0, "title": "feat(api): Too old", "updated_at": "2016-01-01T00:00:00Z", "merged_at": "2016-01-01T00:00:00Z", "merge_commit_sha": "zzz"}
+		]`)
+	})
+
+	g, closer := newTestGithubQuerier(t, mux)
+	defer closer()
+
+	got, err := g.GetPullRequests(context.Background(), "v1.0.0", "v1.1.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 pull requests, got %d", len(got))
+	}
+
+	fix := got[0]
+	if fix.PullRequest.Number != 2 || fix.Subject != "Fix a thing" || fix.Component != "ui" || fix.rawCommitType != "fix" {
+		t.Errorf("Pull request not parsed, got %+v", fix)
+	}
+	if !reflect.DeepEqual(fix.Closes, []string{"10"}) || !reflect.DeepEqual(fix.Breaks, []string{"11"}) {
+		t.Errorf("Expected closes [10] and breaks [11], got %v and %v", fix.Closes, fix.Breaks)
+	}
+	if fix.Author.Name != "jane" {
+		t.Errorf("Expected author jane, got %s", fix.Author.Name)
+	}
+	if got[1].PullRequest.Number != 1 {
+		t.Errorf("Expected pull request 1, got %d", got[1].PullRequest.Number)
+	}
+}
+
+func TestForEachCommitPages(t *testing.T) {
+	mux := http.NewServeMux()
+	pages := map[string]string{
+		"1": `[
+			{"sha": "ccc", "commit": {"message": "feat(a): third", "committer": {"date": "2017-01-03T00:00:00Z"}}},
+			{"sha": "bbb", "commit": {"message": "fix(b): second", "committer": {"date": "2017-01-02T00:00:00Z"}}}
+		]`,
+		"2": `[
+			{"sha": "aaa", "commit": {"message": "feat(a): first", "committer": {"date": "2017-01-01T00:00:00Z"}}}
+		]`,
+	}
+	requested := map[string]int{}
+	var server *httptest.Server
+	mux.HandleFunc("/repos/skuid/changelog/commits", func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			page = "1"
+		}
+		path := r.URL.Query().Get("path")
+		requested[path+"#"+page]++
+
+		if path == "a" {
+			fmt.Fprint(w, `[{"sha": "ccc", "commit": {"committer": {"date": "2017-01-03T00:00:00Z"}}}, {"sha": "aaa", "commit": {"committer": {"date": "2017-01-01T00:00:00Z"}}}]`)
+			return
+		}
+		if page == "1" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/skuid/changelog/commits?page=2>; rel="next"`, server.URL))
+		}
+		fmt.Fprint(w, pages[page])
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	g := NewGithubQuerier("https://github.com/skuid/changelog", "", QueryFilter{}).(githubQuerier)
+	g.client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	// Stopping on the first page never requests the second
+	seen := []string{}
+	err := g.ForEachCommit(context.Background(), CommitRange{}, func(c Commit) error {
+		seen = append(seen, c.Hash)
+		return ErrStopIteration
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(seen, []string{"ccc"}) || requested["#2"] != 0 {
+		t.Errorf("Expected to stop after ccc on the first page, got %v and requests %v", seen, requested)
+	}
+
+	// Path histories are listed alongside the commits
+	g.filter = QueryFilter{Paths: []string{"a"}}
+	got, err := g.GetCommits(context.Background(), "", "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	hashes := []string{}
+	for _, c := range got {
+		hashes = append(hashes, c.Hash)
+	}
+	if !reflect.DeepEqual(hashes, []string{"ccc", "aaa"}) {
+		t.Errorf("Expected commits [ccc aaa], got %v", hashes)
+	}
+	if requested["a#1"] != 1 {
+		t.Errorf("Expected the path history to be listed once, got %v", requested)
+	}
+}
+
+func TestForEachCommitMerges(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/skuid/changelog/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"sha": "eee", "commit": {"message": "Merge pull request #12 from skuid/b"}, "parents": [{"sha": "ccc"}, {"sha": "ddd"}]},
+			{"sha": "ddd", "commit": {"message": "fix(b): on the branch"}, "parents": [{"sha": "bbb"}]},
+			{"sha": "ccc", "commit": {"message": "feat(a): on master"}, "parents": [{"sha": "bbb"}]},
+			{"sha": "bbb", "commit": {"message": "feat(a): first"}, "parents": []}
+		]`)
+	})
+	g, closer := newTestGithubQuerier(t, mux)
+	defer closer()
+
+	cases := []struct {
+		merges MergePolicy
+		want   []string
+	}{
+		{IncludeMerges, []string{"eee", "ddd", "ccc", "bbb"}},
+		{ExcludeMerges, []string{"ddd", "ccc", "bbb"}},
+		{OnlyMerges, []string{"eee"}},
+		{FirstParent, []string{"eee", "ccc", "bbb"}},
+	}
+	for _, c := range cases {
+		g.filter = QueryFilter{Merges: c.merges}
+		got, err := g.GetCommits(context.Background(), "", "HEAD")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		hashes := []string{}
+		for _, commit := range got {
+			hashes = append(hashes, commit.Hash)
+		}
+		if !reflect.DeepEqual(hashes, c.want) {
+			t.Errorf("Expected %q merges to return %v, got %v", c.merges, c.want, hashes)
+		}
+	}
+}
+
+func TestGithubQuerierTimeout(t *testing.T) {
+	mux := http.NewServeMux()
+	release := make(chan struct{})
+	mux.HandleFunc("/repos/skuid/changelog/tags", func(w http.ResponseWriter, r *http.Request) {
+		// Hang until the test is over
+		<-release
+	})
+
+	g, closer := newTestGithubQuerier(t, mux)
+	defer closer()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := g.GetTags(ctx); err == nil {
+		t.Error("Expected an error when the deadline passes")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the request to be abandoned at the deadline, took %s", elapsed)
+	}
+}
+
+func TestGithubQuerierHTTPCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changelog-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var conditional []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/skuid/changelog/tags", func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"tags"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"tags"`)
+		fmt.Fprint(w, `[{"name": "v1.0.0", "commit": {"sha": "aaa"}}]`)
+	})
+
+	g, closer := newTestGithubQuerier(t, mux)
+	defer closer()
+	q := NewCachedQuerier(g, dir, "")
+
+	for i := 0; i < 2; i++ {
+		tags, err := q.GetTags(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(tags) != 1 || tags[0].Commit != "aaa" {
+			t.Errorf("Expected the v1.0.0 tag, got %+v", tags)
+		}
+	}
+	if !reflect.DeepEqual(conditional, []string{"", `"tags"`}) {
+		t.Errorf("Expected the second request to be revalidated, got %q", conditional)
+	}
+}
@@ -1,22 +1,28 @@
 package changelog
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/remote"
 )
 
 type localQuerier struct {
 	GitDir      string `toml:"git_dir"`
 	GitWorkTree string `toml:"git_work_tree"`
 	Format      string
+	Filter      QueryFilter
 }
 
 func (l localQuerier) getWorkdir() string {
@@ -30,14 +36,32 @@ func (l localQuerier) getWorkdir() string {
 }
 
 // NewLocalQuerier returns a querier that queries off of a local git repostiroy
-func NewLocalQuerier(gitDir, workTree string) Querier {
+func NewLocalQuerier(gitDir, workTree string, filter QueryFilter) Querier {
 	return localQuerier{
 		gitDir,
 		workTree,
-		`%H%n%s%n%b%n==END==`,
+		`%H%n%an%n%ae%n%s%n%b`,
+		filter,
 	}
 }
 
+// pathspecs returns the arguments limiting `git log` to the filtered paths.
+// Paths are relative to the root of the work tree rather than the current
+// directory.
+func (l localQuerier) pathspecs() []string {
+	if len(l.Filter.Paths) == 0 {
+		return nil
+	}
+	pathspecs := []string{"--"}
+	for _, path := range l.Filter.Paths {
+		if !strings.HasPrefix(path, ":") {
+			path = fmt.Sprintf(":(top)%s", path)
+		}
+		pathspecs = append(pathspecs, path)
+	}
+	return pathspecs
+}
+
 func (l *localQuerier) getGitWorkTree() string {
 	// Check if user supplied a local git dir and working tree
 	if l.GitDir != "" && l.GitWorkTree != "" {
@@ -58,7 +82,8 @@ func (l *localQuerier) getGitDir() string {
 	return fmt.Sprintf("--git-dir=%s", filepath.Join(l.GitWorkTree, ".git"))
 }
 
-func (l localQuerier) gitCommandFactory(args ...string) *exec.Cmd {
+// gitCommandFactory returns a git command that is killed when ctx is done
+func (l localQuerier) gitCommandFactory(ctx context.Context, args ...string) *exec.Cmd {
 	args = append([]string{l.getGitDir(), l.getGitWorkTree()}, args...)
 	realArgs := []string{}
 	for _, argument := range args {
@@ -67,16 +92,16 @@ func (l localQuerier) gitCommandFactory(args ...string) *exec.Cmd {
 		}
 	}
 	// fmt.Println(realArgs)
-	return exec.Command("git", realArgs...)
+	return exec.CommandContext(ctx, "git", realArgs...)
 }
 
-func (l localQuerier) GetOrigin() (string, error) {
+func (l localQuerier) GetOrigin(ctx context.Context) (string, error) {
 	args := []string{
 		"remote",
 		"get-url",
 		"origin",
 	}
-	cmd := l.gitCommandFactory(args...)
+	cmd := l.gitCommandFactory(ctx, args...)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	err := cmd.Run()
@@ -84,20 +109,17 @@ func (l localQuerier) GetOrigin() (string, error) {
 		return "", errors.WithStack(err)
 	}
 
-	origin := strings.TrimSpace(out.String())
-	if strings.HasPrefix(origin, "git@") {
-		origin = fmt.Sprintf("https://%s", strings.Replace(strings.TrimSuffix(origin[4:], ".git"), ":", "/", -1))
-	}
-	return origin, nil
+	return remote.WebURL(out.String()), nil
 }
 
 // GetLatestCommit returns the latest commit
-func (l localQuerier) GetLatestCommit() (string, error) {
+func (l localQuerier) GetLatestCommit(ctx context.Context) (string, error) {
 	args := []string{
 		"rev-list",
+		"--max-count=1",
 		"HEAD",
 	}
-	cmd := l.gitCommandFactory(args...)
+	cmd := l.gitCommandFactory(ctx, args...)
 
 	var out bytes.Buffer
 	cmd.Stdout = &out
@@ -105,139 +127,295 @@ func (l localQuerier) GetLatestCommit() (string, error) {
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
-	return out.String(), nil
+	return strings.TrimSpace(out.String()), nil
 }
 
-// GetLatestTag returns the latest tag
-func (l localQuerier) GetLatestTag() (string, error) {
-	args := []string{
-		"rev-list",
-		"--tags",
-		"--max-count=1",
+// PatchIDs returns the stable patch ID of each commit, from
+// `git diff-tree -p | git patch-id`. Merges and commits that don't change any
+// files have no patch ID.
+func (l localQuerier) PatchIDs(ctx context.Context, hashes []string) (map[string]string, error) {
+	diff := l.gitCommandFactory(ctx, "diff-tree", "--stdin", "-p")
+	diff.Stdin = strings.NewReader(strings.Join(hashes, "\n") + "\n")
+	patches, err := diff.StdoutPipe()
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
-	cmd := l.gitCommandFactory(args...)
+
+	patchID := l.gitCommandFactory(ctx, "patch-id", "--stable")
+	patchID.Stdin = patches
+	var out bytes.Buffer
+	patchID.Stdout = &out
+
+	if err := diff.Start(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := patchID.Run(); err != nil {
+		diff.Wait()
+		return nil, errors.WithStack(err)
+	}
+	if err := diff.Wait(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ids := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			ids[fields[1]] = fields[0]
+		}
+	}
+	return ids, nil
+}
+
+// ChangedFiles returns the files each commit changes, from
+// `git diff-tree -r --name-only`. Merges have no changed files.
+func (l localQuerier) ChangedFiles(ctx context.Context, hashes []string) (map[string][]string, error) {
+	cmd := l.gitCommandFactory(ctx, "diff-tree", "--stdin", "-r", "--root", "--name-only", "-z")
+	cmd.Stdin = strings.NewReader(strings.Join(hashes, "\n") + "\n")
 	var out bytes.Buffer
 	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
-		return "", errors.WithStack(err)
+	if err := cmd.Run(); err != nil {
+		return nil, errors.WithStack(err)
 	}
-	return strings.TrimSpace(out.String()), nil
+
+	requested := map[string]bool{}
+	for _, hash := range hashes {
+		requested[hash] = true
+	}
+	// Each commit's hash is followed by the files it changes
+	files := map[string][]string{}
+	var hash string
+	for _, field := range strings.Split(strings.TrimSuffix(out.String(), "\x00"), "\x00") {
+		switch {
+		case requested[field]:
+			hash = field
+		case hash != "" && field != "":
+			files[hash] = append(files[hash], field)
+		}
+	}
+	return files, nil
 }
 
-// GetLatestTagVersion returns the latest tag version
-func (l localQuerier) GetLatestTagVersion() (string, error) {
+// GetTags returns every tag in the repository
+func (l localQuerier) GetTags(ctx context.Context) ([]Tag, error) {
 	args := []string{
-		"describe",
-		"--tags",
-		"--abbrev=0",
+		"for-each-ref",
+		"--format=%(refname:short)%09%(objectname)%09%(*objectname)%09%(creatordate:unix)",
+		"refs/tags",
 	}
-	cmd := l.gitCommandFactory(args...)
+	cmd := l.gitCommandFactory(ctx, args...)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	err := cmd.Run()
 	if err != nil {
-		return "", errors.WithStack(err)
+		return nil, errors.WithStack(err)
+	}
+
+	tags := []Tag{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 4 {
+			continue
+		}
+		tag := Tag{Name: fields[0], Commit: fields[1]}
+		if fields[2] != "" {
+			// Annotated tags point at a tag object, which points at the commit
+			tag.Commit = fields[2]
+		}
+		if seconds, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+			tag.Date = time.Unix(seconds, 0)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// IsAncestor reports whether commit is part of the history of `to`
+func (l localQuerier) IsAncestor(ctx context.Context, commit, to string) (bool, error) {
+	cmd := l.gitCommandFactory(ctx, "merge-base", "--is-ancestor", commit, to)
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		// An exit status of 1 means it isn't an ancestor, anything else failed
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 1 {
+			return false, nil
+		}
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
 	}
-	return out.String(), nil
+	return true, nil
+}
+
+// GetLatestTag returns the commit of the latest tag reachable from `to`
+func (l localQuerier) GetLatestTag(ctx context.Context, to string) (string, error) {
+	tag, err := LatestTag(ctx, l, l.Filter, to)
+	return tag.Commit, err
 }
 
-func (l localQuerier) parseRawCommit(repo, commitStr string) *Commit {
+// GetLatestTagVersion returns the name of the latest tag reachable from `to`
+func (l localQuerier) GetLatestTagVersion(ctx context.Context, to string) (string, error) {
+	tag, err := LatestTag(ctx, l, l.Filter, to)
+	return tag.Name, err
+}
+
+func (l localQuerier) parseRawCommit(commitStr string) *Commit {
 	lines := strings.Split(commitStr, "\n")
-	if len(lines) < 2 {
+	if len(lines) < 4 {
 		return nil
 	}
-	return NewCommit(lines[0], strings.Join(lines[1:], "\n"))
+	commit := NewCommit(lines[0], strings.Join(lines[3:], "\n"))
+	if commit != nil {
+		commit.Author = Person{Name: lines[1], Email: lines[2]}
+	}
+	return commit
 
 }
 
 // GetCommits returns a slice of commits
-func (l localQuerier) GetCommits(from, to string) (Commits, error) {
-	repo, err := l.GetOrigin()
-	if err != nil {
-		return nil, err
+func (l localQuerier) GetCommits(ctx context.Context, from, to string) (Commits, error) {
+	return collectCommits(ctx, l, CommitRange{From: from, To: to})
+}
+
+// GetCommits returns a slice of commits
+func (l localQuerier) GetCommitRange(ctx context.Context, since, until time.Time) (Commits, error) {
+	return collectCommits(ctx, l, CommitRange{Since: since, Until: until})
+}
+
+// mergeArgs returns the `git log` arguments for the merge policy
+func (l localQuerier) mergeArgs() []string {
+	switch l.Filter.Merges {
+	case ExcludeMerges:
+		return []string{"--no-merges"}
+	case OnlyMerges:
+		return []string{"--merges"}
+	case FirstParent:
+		return []string{"--first-parent"}
 	}
+	return nil
+}
 
-	if from != "" {
-		from = fmt.Sprintf("%s..", from)
+// revisionArgs returns the `git log` arguments selecting the range
+func (l localQuerier) revisionArgs(r CommitRange) []string {
+	if r.byDate() {
+		args := []string{}
+		if !r.Since.IsZero() {
+			args = append(args, fmt.Sprintf("--since=%s", r.Since.Format(time.RFC3339)))
+		}
+		if !r.Until.IsZero() {
+			args = append(args, fmt.Sprintf("--until=%s", r.Until.Format(time.RFC3339)))
+		}
+		return args
+	}
+	if r.From != "" {
+		return []string{fmt.Sprintf("%s..%s", r.From, r.to())}
 	}
+	return []string{r.to()}
+}
 
+// ForEachCommit streams the output of `git log -z`, so only one commit is held
+// in memory at a time. The git process is killed if fn stops the iteration or
+// the context is cancelled.
+func (l localQuerier) ForEachCommit(ctx context.Context, r CommitRange, fn CommitFunc) error {
 	args := []string{
 		"log",
+		"-z",
 		"-E",
 		fmt.Sprintf(`--format=%s`, l.Format),
-		fmt.Sprintf("%s%s", from, to),
 	}
-	cmd := l.gitCommandFactory(args...)
+	args = append(args, l.mergeArgs()...)
+	args = append(args, l.revisionArgs(r)...)
+	args = append(args, l.pathspecs()...)
 
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err = cmd.Run()
+	// Cancelling kills git, which unblocks the reads below
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := l.gitCommandFactory(ctx, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return errors.WithStack(err)
+	}
+	if err := cmd.Start(); err != nil {
+		return errors.WithStack(err)
 	}
 
-	commitGroups := strings.Split(out.String(), "\n==END==\n")
-
-	var commits Commits
-	for _, com := range commitGroups {
-		if len(com) == 0 {
-			continue
+	reader := bufio.NewReader(stdout)
+	for {
+		record, readErr := reader.ReadString(0)
+		record = strings.TrimSuffix(record, "\x00")
+		if commit := l.parseRawCommit(record); commit != nil {
+			if err := fn(*commit); err != nil {
+				cancel()
+				cmd.Wait()
+				if err == ErrStopIteration {
+					return nil
+				}
+				return err
+			}
 		}
-		commit := l.parseRawCommit(repo, com)
-		if commit == nil {
-			continue
+		if readErr == io.EOF {
+			break
 		}
-		commits = append(commits, *commit)
+		if readErr != nil {
+			cancel()
+			cmd.Wait()
+			return errors.WithStack(readErr)
+		}
+	}
 
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return errors.WithStack(ctx.Err())
+		}
+		return errors.Wrap(err, strings.TrimSpace(stderr.String()))
 	}
-	return commits, nil
+	return nil
 }
 
-// GetCommits returns a slice of commits
-func (l localQuerier) GetCommitRange(since, until time.Time) (Commits, error) {
-	repo, err := l.GetOrigin()
-	if err != nil {
-		return nil, err
+// Tag creates or replaces an annotated tag with the given message. A tag that
+// already exists keeps pointing at the same commit, otherwise the tag points
+// at target.
+func (l localQuerier) Tag(ctx context.Context, name, target, message string) error {
+	cmd := l.gitCommandFactory(ctx, "rev-parse", "--verify", "--quiet", fmt.Sprintf("%s^{commit}", name))
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err == nil {
+		target = strings.TrimSpace(out.String())
 	}
 
-	args := []string{
-		"log",
-		"-E",
-		fmt.Sprintf(`--format=%s`, l.Format),
-		fmt.Sprintf("--since=%s", since.Format(time.RFC3339)),
-		fmt.Sprintf("--until=%s", until.Format(time.RFC3339)),
+	cmd = l.gitCommandFactory(ctx, "tag", "--annotate", "--force", "--cleanup=verbatim", "--file=-", name, target)
+	cmd.Stdin = strings.NewReader(message)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrap(err, strings.TrimSpace(string(output)))
 	}
-	cmd := l.gitCommandFactory(args...)
+	return nil
+}
 
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err = cmd.Run()
-	if err != nil {
-		return nil, errors.WithStack(err)
+// PushTag pushes a tag to the origin remote, replacing it if it already exists
+func (l localQuerier) PushTag(ctx context.Context, name string) error {
+	cmd := l.gitCommandFactory(ctx, "push", "--force", "origin", fmt.Sprintf("refs/tags/%s", name))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrap(err, strings.TrimSpace(string(output)))
 	}
+	return nil
+}
 
-	commitGroups := strings.Split(out.String(), "\n==END==\n")
-
-	var commits Commits
-	for _, com := range commitGroups {
-		if len(com) == 0 {
-			continue
-		}
-		commit := l.parseRawCommit(repo, com)
-		if commit == nil {
-			continue
-		}
-		commits = append(commits, *commit)
+// GetPullRequests isn't supported by a local repository, which has no concept
+// of pull requests
+func (l localQuerier) GetPullRequests(ctx context.Context, from, to string) (Commits, error) {
+	return nil, errors.New("pull requests are not supported by the local provider")
+}
 
-	}
-	return commits, nil
+// GetConfig returns the first of the ConfigFiles in the work tree
+func (l localQuerier) GetConfig(ctx context.Context) (io.Reader, error) {
+	return findConfig(ctx, l.GetFile)
 }
 
-// GetConfig returns a reader for the clog config
-func (l localQuerier) GetConfig() (io.Reader, error) {
+// GetFile returns a reader for a file in the work tree
+func (l localQuerier) GetFile(ctx context.Context, path string) (io.Reader, error) {
 	dir := l.getWorkdir()
-	content, err := ioutil.ReadFile(filepath.Join(dir, ".clog.toml"))
+	content, err := ioutil.ReadFile(filepath.Join(dir, path))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,23 @@
+package changelog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathspecs(t *testing.T) {
+	cases := []struct {
+		paths []string
+		want  []string
+	}{
+		{nil, nil},
+		{[]string{"pkg/a"}, []string{"--", ":(top)pkg/a"}},
+		{[]string{"pkg/a", ":(glob)pkg/*/README.md"}, []string{"--", ":(top)pkg/a", ":(glob)pkg/*/README.md"}},
+	}
+	for _, c := range cases {
+		l := NewLocalQuerier("", "", QueryFilter{Paths: c.paths}).(localQuerier)
+		if got := l.pathspecs(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Pathspecs not equal!\nExpected\n\t%v\nGot\n\t%v", c.want, got)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package changelog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/gitrepo"
+	"github.com/skuid/changelog/src/remote"
+)
+
+// nativeQuerier reads a local repository directly, without the git binary
+type nativeQuerier struct {
+	GitDir      string
+	GitWorkTree string
+	Filter      QueryFilter
+
+	repo *gitrepo.Repository
+}
+
+// NewNativeQuerier returns a querier that reads a local git repository's
+// objects and refs in Go rather than shelling out to git. Paths in the filter
+// are matched literally, pathspec magic and globs are not supported. The
+// querier is an io.Closer, close it to release the repository's pack files.
+func NewNativeQuerier(gitDir, workTree string, filter QueryFilter) Querier {
+	return &nativeQuerier{
+		GitDir:      gitDir,
+		GitWorkTree: workTree,
+		Filter:      filter,
+	}
+}
+
+// open opens the repository on first use and keeps it open after that
+func (n *nativeQuerier) open() (*gitrepo.Repository, error) {
+	if n.repo != nil {
+		return n.repo, nil
+	}
+	var repo *gitrepo.Repository
+	var err error
+	switch {
+	case n.GitDir != "":
+		repo, err = gitrepo.Open(n.GitDir)
+	case n.GitWorkTree != "":
+		repo, err = gitrepo.Open(n.GitWorkTree)
+	default:
+		repo, err = gitrepo.Discover(".")
+	}
+	if err != nil {
+		return nil, err
+	}
+	n.repo = repo
+	return repo, nil
+}
+
+// Close closes the repository's pack files. The repository is opened again if
+// the querier is used after that.
+func (n *nativeQuerier) Close() error {
+	if n.repo == nil {
+		return nil
+	}
+	err := n.repo.Close()
+	n.repo = nil
+	return err
+}
+
+func (n *nativeQuerier) getWorkdir() (string, error) {
+	if n.GitWorkTree != "" {
+		return n.GitWorkTree, nil
+	}
+	repo, err := n.open()
+	if err != nil {
+		return "", err
+	}
+	return repo.WorkTree(), nil
+}
+
+func (n *nativeQuerier) GetOrigin(ctx context.Context) (string, error) {
+	repo, err := n.open()
+	if err != nil {
+		return "", err
+	}
+	origin, err := repo.RemoteURL("origin")
+	if err != nil {
+		return "", err
+	}
+	return remote.WebURL(origin), nil
+}
+
+// GetLatestCommit returns the commit HEAD points to
+func (n *nativeQuerier) GetLatestCommit(ctx context.Context) (string, error) {
+	repo, err := n.open()
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.ResolveRevision("HEAD")
+	if err != nil {
+		return "", err
+	}
+	return head.String(), nil
+}
+
+// GetTags returns every tag in the repository
+func (n *nativeQuerier) GetTags(ctx context.Context) ([]Tag, error) {
+	repo, err := n.open()
+	if err != nil {
+		return nil, err
+	}
+	refs, err := repo.Refs("refs/tags/")
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []Tag{}
+	for name, hash := range refs {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		objectType, err := repo.ObjectType(hash)
+		if err != nil {
+			return nil, err
+		}
+		tag := Tag{Name: strings.TrimPrefix(name, "refs/tags/"), Commit: hash.String()}
+		switch objectType {
+		case gitrepo.TagObject:
+			// Annotated tags point at a tag object, which points at the commit
+			annotated, err := repo.Tag(hash)
+			if err != nil {
+				return nil, err
+			}
+			tag.Commit = annotated.Object.String()
+			tag.Date = annotated.Tagger.When
+		case gitrepo.CommitObject:
+			commit, err := repo.Commit(hash)
+			if err != nil {
+				return nil, err
+			}
+			tag.Date = commit.Committer.When
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// IsAncestor reports whether commit is part of the history of `to`
+func (n *nativeQuerier) IsAncestor(ctx context.Context, commit, to string) (bool, error) {
+	repo, err := n.open()
+	if err != nil {
+		return false, err
+	}
+	ancestor, err := repo.ResolveRevision(commit)
+	if err != nil {
+		return false, err
+	}
+	descendant, err := repo.ResolveRevision(to)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	err = repo.Walk([]gitrepo.Hash{descendant}, nil, func(c *gitrepo.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		if c.Hash == ancestor {
+			found = true
+			return gitrepo.ErrStopWalk
+		}
+		return nil
+	})
+	return found, err
+}
+
+// GetLatestTag returns the commit of the latest tag reachable from `to`
+func (n *nativeQuerier) GetLatestTag(ctx context.Context, to string) (string, error) {
+	tag, err := LatestTag(ctx, n, n.Filter, to)
+	return tag.Commit, err
+}
+
+// GetLatestTagVersion returns the name of the latest tag reachable from `to`
+func (n *nativeQuerier) GetLatestTagVersion(ctx context.Context, to string) (string, error) {
+	tag, err := LatestTag(ctx, n, n.Filter, to)
+	return tag.Name, err
+}
+
+// GetCommits returns the commits reachable from `to` but not from `from`
+func (n *nativeQuerier) GetCommits(ctx context.Context, from, to string) (Commits, error) {
+	return collectCommits(ctx, n, CommitRange{From: from, To: to})
+}
+
+// GetCommitRange returns the commits reachable from HEAD committed between
+// since and until
+func (n *nativeQuerier) GetCommitRange(ctx context.Context, since, until time.Time) (Commits, error) {
+	return collectCommits(ctx, n, CommitRange{Since: since, Until: until})
+}
+
+// ForEachCommit walks the commit graph, reading each commit from the object
+// store only when it is reached
+func (n *nativeQuerier) ForEachCommit(ctx context.Context, r CommitRange, fn CommitFunc) error {
+	repo, err := n.open()
+	if err != nil {
+		return err
+	}
+
+	to := r.to()
+	if r.byDate() {
+		to = "HEAD"
+	}
+	include, err := repo.ResolveRevision(to)
+	if err != nil {
+		return err
+	}
+	exclude := []gitrepo.Hash{}
+	if r.From != "" && !r.byDate() {
+		hash, err := repo.ResolveRevision(r.From)
+		if err != nil {
+			return err
+		}
+		exclude = append(exclude, hash)
+	}
+
+	merges := &mergeFilter{policy: n.Filter.Merges}
+	err = repo.Walk([]gitrepo.Hash{include}, exclude, func(c *gitrepo.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		parents := make([]string, len(c.Parents))
+		for i := range c.Parents {
+			parents[i] = c.Parents[i].String()
+		}
+		if !merges.keep(c.Hash.String(), parents) {
+			return nil
+		}
+		when := c.Committer.When
+		if (!r.Since.IsZero() && when.Before(r.Since)) || (!r.Until.IsZero() && when.After(r.Until)) {
+			return nil
+		}
+		// Following first parents, a merge is only compared with the
+		// first, like `git log --first-parent`
+		compared := c.Parents
+		if n.Filter.Merges == FirstParent && len(compared) > 1 {
+			compared = compared[:1]
+		}
+		changed, err := n.changesPaths(repo, c, compared)
+		if err != nil || !changed {
+			return err
+		}
+		commit := NewCommit(c.Hash.String(), c.Subject()+"\n"+c.Body())
+		if commit == nil {
+			return nil
+		}
+		commit.Author = Person{Name: c.Author.Name, Email: c.Author.Email}
+		if err := fn(*commit); err != nil {
+			if err == ErrStopIteration {
+				return gitrepo.ErrStopWalk
+			}
+			return err
+		}
+		return nil
+	})
+	return err
+}
+
+// changesPaths reports whether a commit changes any of the filtered paths
+// compared with the given parents. Like `git log -- <path>`, a merge only
+// counts if it differs from every one of them.
+func (n *nativeQuerier) changesPaths(repo *gitrepo.Repository, c *gitrepo.Commit, parents []gitrepo.Hash) (bool, error) {
+	if len(n.Filter.Paths) == 0 {
+		return true, nil
+	}
+	current, err := n.pathEntries(repo, c.Tree)
+	if err != nil {
+		return false, err
+	}
+	if len(parents) == 0 {
+		for _, entry := range current {
+			if entry != "" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	for _, parentHash := range parents {
+		parent, err := repo.Commit(parentHash)
+		if err != nil {
+			return false, err
+		}
+		previous, err := n.pathEntries(repo, parent.Tree)
+		if err != nil {
+			return false, err
+		}
+		if strings.Join(current, " ") == strings.Join(previous, " ") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// pathEntries returns the object name of each filtered path in a tree, or an
+// empty string for paths that don't exist
+func (n *nativeQuerier) pathEntries(repo *gitrepo.Repository, tree gitrepo.Hash) ([]string, error) {
+	entries := make([]string, len(n.Filter.Paths))
+	for i, path := range n.Filter.Paths {
+		path = strings.TrimPrefix(filepath.ToSlash(path), "./")
+		entry, ok, err := repo.TreeEntry(tree, path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries[i] = entry.Hash.String()
+		}
+	}
+	return entries, nil
+}
+
+// GetPullRequests isn't supported by a local repository, which has no concept
+// of pull requests
+func (n *nativeQuerier) GetPullRequests(ctx context.Context, from, to string) (Commits, error) {
+	return nil, errors.New("pull requests are not supported by the local-native provider")
+}
+
+// GetConfig returns the first of the ConfigFiles in the work tree
+func (n *nativeQuerier) GetConfig(ctx context.Context) (io.Reader, error) {
+	return findConfig(ctx, n.GetFile)
+}
+
+// GetFile returns a reader for a file in the work tree
+func (n *nativeQuerier) GetFile(ctx context.Context, path string) (io.Reader, error) {
+	dir, err := n.getWorkdir()
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(content), nil
+}
@@ -0,0 +1,251 @@
+package changelog_test
+
+import (
+	"context"
+
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/changelog"
+)
+
+// fixtureRepo builds a small repository with branches, a merge, multi-line
+// messages, lightweight and annotated tags, and commits in subdirectories
+func fixtureRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "changelog-native")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC)
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		stamp := fmt.Sprintf("%d +0000", date.Unix())
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com",
+			"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com",
+			"GIT_AUTHOR_DATE="+stamp, "GIT_COMMITTER_DATE="+stamp,
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	commit := func(path, content, message string) {
+		date = date.Add(time.Hour)
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", path)
+		git("commit", "-q", "-m", message)
+	}
+
+	git("init", "-q")
+	git("checkout", "-q", "-b", "master")
+	git("remote", "add", "origin", "git@github.com:skuid/changelog.git")
+	commit("README.md", "# changelog\n", "feat(core): initial commit")
+	git("tag", "v1.0.0")
+	commit("pkg/a/main.go", "package a\n", "fix(a): handle empty input\n\nLonger explanation\nof the fix.\n\nCloses #3")
+	git("checkout", "-q", "-b", "feature")
+	commit("pkg/b/main.go", "package b\n", "feat(b): add package b\n\nBREAKING CHANGE: b replaces c")
+	git("checkout", "-q", "master")
+	commit("pkg/a/main.go", "package a\n\nfunc A() {}\n", "perf(a): speed up a")
+	date = date.Add(time.Hour)
+	git("tag", "-a", "-m", "Release 1.1.0", "v1.1.0")
+	git("merge", "-q", "--no-ff", "-m", "Merge branch 'feature'", "feature")
+	commit("README.md", "# changelog\n\nMore docs\n", "docs(readme): a subject that\nwraps onto two lines\n\nand a body")
+	git("tag", "-a", "-m", "Release 2.0.0-rc.1", "v2.0.0-rc.1")
+	return dir
+}
+
+func compareQueriers(t *testing.T, dir string) {
+	ctx := context.Background()
+	filters := []changelog.QueryFilter{}
+	for _, paths := range [][]string{nil, {"pkg/a"}, {"pkg/b/main.go", "README.md"}} {
+		for _, merges := range append([]changelog.MergePolicy{changelog.IncludeMerges}, changelog.MergePolicies...) {
+			filters = append(filters, changelog.QueryFilter{Paths: paths, Merges: merges})
+		}
+	}
+	for _, filter := range filters {
+		local := changelog.NewLocalQuerier(filepath.Join(dir, ".git"), "", filter)
+		native := changelog.NewNativeQuerier(filepath.Join(dir, ".git"), "", filter)
+
+		for _, r := range [][2]string{{"", "HEAD"}, {"v1.0.0", "HEAD"}, {"v1.1.0", "v2.0.0-rc.1"}, {"", "feature"}, {"HEAD~2", "HEAD^"}} {
+			want, err := local.GetCommits(ctx, r[0], r[1])
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			got, err := native.GetCommits(ctx, r[0], r[1])
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(want, got) {
+				errorDiff(t, fmt.Sprintf("Commits %s..%s for %+v not equal!", r[0], r[1], filter), fmt.Sprintf("%+v", want), fmt.Sprintf("%+v", got))
+			}
+		}
+
+		since := time.Date(2017, 8, 1, 14, 0, 0, 0, time.UTC)
+		until := time.Date(2017, 8, 1, 17, 0, 0, 0, time.UTC)
+		want, err := local.GetCommitRange(ctx, since, until)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		got, err := native.GetCommitRange(ctx, since, until)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			errorDiff(t, fmt.Sprintf("Commit range for %+v not equal!", filter), fmt.Sprintf("%+v", want), fmt.Sprintf("%+v", got))
+		}
+	}
+
+	local := changelog.NewLocalQuerier(filepath.Join(dir, ".git"), "", changelog.QueryFilter{})
+	native := changelog.NewNativeQuerier(filepath.Join(dir, ".git"), "", changelog.QueryFilter{})
+
+	wantTags, err := local.GetTags(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	gotTags, err := native.GetTags(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	sortTags := func(tags []changelog.Tag) {
+		sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+		for i := range tags {
+			tags[i].Date = tags[i].Date.UTC()
+		}
+	}
+	sortTags(wantTags)
+	sortTags(gotTags)
+	if !reflect.DeepEqual(wantTags, gotTags) {
+		errorDiff(t, "Tags not equal!", fmt.Sprintf("%+v", wantTags), fmt.Sprintf("%+v", gotTags))
+	}
+
+	for _, to := range []string{"HEAD", "feature", "v1.1.0"} {
+		want, err := local.GetLatestTagVersion(ctx, to)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		got, err := native.GetLatestTagVersion(ctx, to)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if want != got {
+			errorDiff(t, fmt.Sprintf("Latest tag from %s not equal!", to), fmt.Sprintf("%+v", want), fmt.Sprintf("%+v", got))
+		}
+	}
+
+	for _, pair := range [][2]string{{"v1.0.0", "HEAD"}, {"feature", "HEAD"}, {"HEAD", "feature"}, {"feature", "v1.1.0"}} {
+		want, err := local.IsAncestor(ctx, pair[0], pair[1])
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		got, err := native.IsAncestor(ctx, pair[0], pair[1])
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if want != got {
+			errorDiff(t, fmt.Sprintf("Ancestry of %s in %s not equal!", pair[0], pair[1]), fmt.Sprintf("%+v", want), fmt.Sprintf("%+v", got))
+		}
+	}
+
+	wantOrigin, err := local.GetOrigin(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	gotOrigin, err := native.GetOrigin(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if wantOrigin != gotOrigin {
+		errorDiff(t, "Origin not equal!", wantOrigin, gotOrigin)
+	}
+}
+
+func TestNativeQuerierLooseObjects(t *testing.T) {
+	dir := fixtureRepo(t)
+	defer os.RemoveAll(dir)
+	compareQueriers(t, dir)
+}
+
+func TestNativeQuerierPackfiles(t *testing.T) {
+	dir := fixtureRepo(t)
+	defer os.RemoveAll(dir)
+
+	// Pack every object with deltas and move the refs into packed-refs
+	cmd := exec.Command("git", "gc", "-q", "--aggressive", "--prune=now")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git gc: %s\n%s", err, out)
+	}
+	if loose, _ := filepath.Glob(filepath.Join(dir, ".git", "refs", "tags", "*")); len(loose) > 0 {
+		t.Fatalf("Expected packed refs, found %v", loose)
+	}
+	compareQueriers(t, dir)
+}
+
+func TestForEachCommitStopsEarly(t *testing.T) {
+	dir := fixtureRepo(t)
+	defer os.RemoveAll(dir)
+
+	queriers := map[string]changelog.Querier{
+		"local":        changelog.NewLocalQuerier(filepath.Join(dir, ".git"), "", changelog.QueryFilter{}),
+		"local-native": changelog.NewNativeQuerier(filepath.Join(dir, ".git"), "", changelog.QueryFilter{}),
+	}
+	for name, querier := range queriers {
+		all, err := querier.GetCommits(context.Background(), "", "HEAD")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		seen := changelog.Commits{}
+		err = querier.ForEachCommit(context.Background(), changelog.CommitRange{}, func(c changelog.Commit) error {
+			seen = append(seen, c)
+			if len(seen) == 2 {
+				return changelog.ErrStopIteration
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", name, err)
+		}
+		if !reflect.DeepEqual(seen, all[:2]) {
+			errorDiff(t, name+": Streamed commits not equal", fmt.Sprintf("%+v", all[:2]), fmt.Sprintf("%+v", seen))
+		}
+
+		failure := errors.New("failed")
+		err = querier.ForEachCommit(context.Background(), changelog.CommitRange{}, func(c changelog.Commit) error {
+			return failure
+		})
+		if err != failure {
+			t.Errorf("%s: Expected the callback's error, got %v", name, err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = querier.ForEachCommit(ctx, changelog.CommitRange{}, func(c changelog.Commit) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf("%s: Expected an error for a cancelled context", name)
+		}
+	}
+}
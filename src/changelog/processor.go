@@ -0,0 +1,376 @@
+package changelog
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// Processor transforms the commits of a changelog before they are sorted into
+// sections, like dropping commits or rewriting their subjects
+type Processor interface {
+	Process(ctx context.Context, querier Querier, commits Commits) (Commits, error)
+}
+
+// ProcessorFunc is a function used as a Processor
+type ProcessorFunc func(ctx context.Context, querier Querier, commits Commits) (Commits, error)
+
+// Process calls the function
+func (f ProcessorFunc) Process(ctx context.Context, querier Querier, commits Commits) (Commits, error) {
+	return f(ctx, querier, commits)
+}
+
+// Pipeline is a list of processors run in order, each one given the commits
+// the one before it returned
+type Pipeline []Processor
+
+// Process runs each processor of the pipeline
+func (p Pipeline) Process(ctx context.Context, querier Querier, commits Commits) (Commits, error) {
+	for _, processor := range p {
+		var err error
+		if commits, err = processor.Process(ctx, querier, commits); err != nil {
+			return nil, err
+		}
+	}
+	return commits, nil
+}
+
+// ProcessorFactory builds a processor from its options in the configuration
+// file, which are every key of its `[[processors]]` table but `type`
+type ProcessorFactory func(options map[string]interface{}) (Processor, error)
+
+// processorsMu guards processors, which may be registered while pipelines are
+// built on other goroutines
+var processorsMu sync.RWMutex
+
+var processors = map[string]ProcessorFactory{
+	"author":     newAuthorProcessor,
+	"path":       newPathProcessor,
+	"regex":      newRegexProcessor,
+	"rewrite":    newRewriteProcessor,
+	"components": newComponentsProcessor,
+	"drop-bots":  newDropBotsProcessor,
+	"redact":     newRedactProcessor,
+}
+
+// RegisterProcessor adds a processor type that can be used in the
+// configuration file, or replaces the built-in processor of the same name. It
+// is safe to call concurrently with NewProcessor.
+func RegisterProcessor(name string, factory ProcessorFactory) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+	processors[name] = factory
+}
+
+// NewProcessor builds a processor of the registered type
+func NewProcessor(name string, options map[string]interface{}) (Processor, error) {
+	processorsMu.RLock()
+	factory, ok := processors[name]
+	processorsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Processor %s not found! Must be one of %s", name, SupportedProcessors())
+	}
+	return factory(options)
+}
+
+// SupportedProcessors returns a printable string of registered processor types
+func SupportedProcessors() string {
+	processorsMu.RLock()
+	names := []string{}
+	for name := range processors {
+		names = append(names, name)
+	}
+	processorsMu.RUnlock()
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// decodeOptions reads a processor's options into v, rejecting unknown keys so
+// typos aren't silently ignored
+func decodeOptions(name string, options map[string]interface{}, v interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused: true,
+		Result:      v,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = decoder.Decode(options)
+	if merr, ok := err.(*mapstructure.Error); ok {
+		return fmt.Errorf("Invalid options for processor %s: %s", name, strings.Join(merr.Errors, "; "))
+	}
+	return errors.Wrapf(err, "Invalid options for processor %s", name)
+}
+
+// compilePatterns compiles the regular expressions of a processor
+func compilePatterns(name string, patterns ...string) ([]*regexp.Regexp, error) {
+	regexes := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid pattern for processor %s", name)
+		}
+		regexes = append(regexes, regex)
+	}
+	return regexes, nil
+}
+
+// filterProcessor keeps the commits matching a condition, or drops them if
+// exclude is set
+type filterProcessor struct {
+	matches func(Commit) bool
+	exclude bool
+}
+
+func (f filterProcessor) Process(ctx context.Context, querier Querier, commits Commits) (Commits, error) {
+	response := Commits{}
+	for _, commit := range commits {
+		if f.matches(commit) != f.exclude {
+			response = append(response, commit)
+		}
+	}
+	return response, nil
+}
+
+type patternOptions struct {
+	Pattern string `mapstructure:"pattern"`
+	Exclude bool   `mapstructure:"exclude"`
+}
+
+// newPatternFilter returns a filter matching the pattern against the text of
+// each commit
+func newPatternFilter(name string, options map[string]interface{}, text func(Commit) string) (Processor, error) {
+	opts := patternOptions{}
+	if err := decodeOptions(name, options, &opts); err != nil {
+		return nil, err
+	}
+	if opts.Pattern == "" {
+		return nil, fmt.Errorf("Processor %s requires a pattern", name)
+	}
+	regexes, err := compilePatterns(name, opts.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	return filterProcessor{
+		matches: func(c Commit) bool { return regexes[0].MatchString(text(c)) },
+		exclude: opts.Exclude,
+	}, nil
+}
+
+// author returns the commit's author like `Name <email>`
+func author(c Commit) string {
+	return fmt.Sprintf("%s <%s>", c.Author.Name, c.Author.Email)
+}
+
+// newAuthorProcessor keeps the commits whose author, like `Name <email>`,
+// matches a pattern
+func newAuthorProcessor(options map[string]interface{}) (Processor, error) {
+	return newPatternFilter("author", options, author)
+}
+
+// newRegexProcessor keeps the commits whose header matches a pattern
+func newRegexProcessor(options map[string]interface{}) (Processor, error) {
+	return newPatternFilter("regex", options, func(c Commit) string { return c.header })
+}
+
+// FileLister is an interface for queriers that can list the files commits
+// change, for the path processor
+type FileLister interface {
+	// ChangedFiles returns the paths each commit changes, keyed by hash
+	ChangedFiles(ctx context.Context, hashes []string) (map[string][]string, error)
+}
+
+// pathProcessor keeps the commits changing any of the paths
+type pathProcessor struct {
+	Paths   []string `mapstructure:"paths"`
+	Exclude bool     `mapstructure:"exclude"`
+}
+
+func newPathProcessor(options map[string]interface{}) (Processor, error) {
+	p := pathProcessor{}
+	if err := decodeOptions("path", options, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Paths) == 0 {
+		return nil, errors.New("Processor path requires paths")
+	}
+	return p, nil
+}
+
+func (p pathProcessor) Process(ctx context.Context, querier Querier, commits Commits) (Commits, error) {
+	lister, ok := querier.(FileLister)
+	if !ok {
+		return nil, errors.New("Processor path is not supported by this provider")
+	}
+	hashes := make([]string, len(commits))
+	for i := range commits {
+		hashes[i] = commits[i].Hash
+	}
+	files, err := lister.ChangedFiles(ctx, hashes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list changed files")
+	}
+	return filterProcessor{
+		matches: func(c Commit) bool { return p.changes(files[c.Hash]) },
+		exclude: p.Exclude,
+	}.Process(ctx, querier, commits)
+}
+
+// changes reports whether any of the files are one of the paths, or inside it
+func (p pathProcessor) changes(files []string) bool {
+	for _, path := range p.Paths {
+		path = strings.Trim(path, "/")
+		for _, file := range files {
+			if path == "" || path == "." || file == path || strings.HasPrefix(file, path+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rewriteProcessor replaces the matches of a pattern in each subject.
+// Replacements may refer to capture groups, like `$1`.
+type rewriteProcessor struct {
+	regex       *regexp.Regexp
+	replacement string
+}
+
+func newRewriteProcessor(options map[string]interface{}) (Processor, error) {
+	opts := struct {
+		Pattern     string `mapstructure:"pattern"`
+		Replacement string `mapstructure:"replacement"`
+	}{}
+	if err := decodeOptions("rewrite", options, &opts); err != nil {
+		return nil, err
+	}
+	if opts.Pattern == "" {
+		return nil, errors.New("Processor rewrite requires a pattern")
+	}
+	regexes, err := compilePatterns("rewrite", opts.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	return rewriteProcessor{regexes[0], opts.Replacement}, nil
+}
+
+func (r rewriteProcessor) Process(ctx context.Context, querier Querier, commits Commits) (Commits, error) {
+	for i := range commits {
+		commits[i].Subject = r.regex.ReplaceAllString(commits[i].Subject, r.replacement)
+	}
+	return commits, nil
+}
+
+// componentsProcessor renames components, like `ui` to `web`. Components are
+// matched in any case, as configuration keys may be lowercased. Renaming to
+// an empty string removes the component.
+type componentsProcessor map[string]string
+
+func newComponentsProcessor(options map[string]interface{}) (Processor, error) {
+	opts := struct {
+		Rename map[string]string `mapstructure:"rename"`
+	}{}
+	if err := decodeOptions("components", options, &opts); err != nil {
+		return nil, err
+	}
+	p := componentsProcessor{}
+	for from, to := range opts.Rename {
+		p[strings.ToLower(from)] = to
+	}
+	return p, nil
+}
+
+func (p componentsProcessor) Process(ctx context.Context, querier Querier, commits Commits) (Commits, error) {
+	for i := range commits {
+		if to, ok := p[strings.ToLower(commits[i].Component)]; ok {
+			commits[i].Component = to
+		}
+	}
+	return commits, nil
+}
+
+// botRegex matches the authors of Github Apps, like `dependabot[bot]`
+var botRegex = regexp.MustCompile(`\[bot\](?:@| <)`)
+
+// newDropBotsProcessor drops the commits of bots, and of any authors matching
+// one of its patterns
+func newDropBotsProcessor(options map[string]interface{}) (Processor, error) {
+	opts := struct {
+		Authors []string `mapstructure:"authors"`
+	}{}
+	if err := decodeOptions("drop-bots", options, &opts); err != nil {
+		return nil, err
+	}
+	regexes, err := compilePatterns("drop-bots", opts.Authors...)
+	if err != nil {
+		return nil, err
+	}
+	regexes = append(regexes, botRegex)
+	return filterProcessor{
+		matches: func(c Commit) bool {
+			for _, regex := range regexes {
+				if regex.MatchString(author(c)) {
+					return true
+				}
+			}
+			return false
+		},
+		exclude: true,
+	}, nil
+}
+
+// redactProcessor replaces the matches of its patterns in each header and
+// subject, like internal hostnames or customer names
+type redactProcessor struct {
+	regexes     []*regexp.Regexp
+	replacement string
+}
+
+func newRedactProcessor(options map[string]interface{}) (Processor, error) {
+	opts := struct {
+		Patterns    []string `mapstructure:"patterns"`
+		Replacement string   `mapstructure:"replacement"`
+	}{Replacement: "[redacted]"}
+	if err := decodeOptions("redact", options, &opts); err != nil {
+		return nil, err
+	}
+	if len(opts.Patterns) == 0 {
+		return nil, errors.New("Processor redact requires patterns")
+	}
+	regexes, err := compilePatterns("redact", opts.Patterns...)
+	if err != nil {
+		return nil, err
+	}
+	return redactProcessor{regexes, opts.Replacement}, nil
+}
+
+func (r redactProcessor) Process(ctx context.Context, querier Querier, commits Commits) (Commits, error) {
+	for i := range commits {
+		for _, regex := range r.regexes {
+			commits[i].header = regex.ReplaceAllString(commits[i].header, r.replacement)
+			commits[i].Subject = regex.ReplaceAllString(commits[i].Subject, r.replacement)
+		}
+	}
+	return commits, nil
+}
+
+// sectionFormatter sets the section of each commit from the section aliases.
+// With includeAll, commits of unknown types get a section named after their
+// type instead of Unknown.
+type sectionFormatter struct {
+	sections   SectionAliasMap
+	includeAll bool
+}
+
+func (s sectionFormatter) Process(ctx context.Context, querier Querier, commits Commits) (Commits, error) {
+	if s.includeAll {
+		return TitleCommitType(commits, s.sections), nil
+	}
+	return FormatCommits(commits, s.sections), nil
+}
@@ -0,0 +1,197 @@
+package changelog_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/skuid/changelog/src/changelog"
+)
+
+func newCommit(message, name, email string) changelog.Commit {
+	commit := changelog.NewCommit(strings.Repeat("a", 40), message)
+	commit.Author = changelog.Person{Name: name, Email: email}
+	return *commit
+}
+
+// entries summarizes commits like `component: subject`
+func entries(commits changelog.Commits) []string {
+	got := []string{}
+	for _, c := range commits {
+		got = append(got, c.Component+": "+c.Subject)
+	}
+	return got
+}
+
+func TestProcessors(t *testing.T) {
+	commits := func() changelog.Commits {
+		return changelog.Commits{
+			newCommit("feat(ui): add a page on db.internal.example.com", "Jane Doe", "jane@example.com"),
+			newCommit("fix(deps): bump foo", "dependabot[bot]", "49699333+dependabot[bot]@users.noreply.github.com"),
+			newCommit("fix(api): PLAT-12 handle nil", "John Doe", "john@example.com"),
+			newCommit("fix(deps): bump bar", "Renovate Bot", "bot@renovateapp.com"),
+			newCommit("feat(UI): wip button", "Jane Doe", "jane@example.com"),
+		}
+	}
+
+	cases := []struct {
+		name    string
+		options map[string]interface{}
+		want    []string
+	}{
+		{
+			"author", map[string]interface{}{"pattern": "^Jane"},
+			[]string{"ui: add a page on db.internal.example.com", "UI: wip button"},
+		},
+		{
+			"author", map[string]interface{}{"pattern": "@example.com>$", "exclude": true},
+			[]string{"deps: bump foo", "deps: bump bar"},
+		},
+		{
+			"regex", map[string]interface{}{"pattern": `\bwip\b`, "exclude": true},
+			[]string{"ui: add a page on db.internal.example.com", "deps: bump foo", "api: PLAT-12 handle nil", "deps: bump bar"},
+		},
+		{
+			"drop-bots", map[string]interface{}{},
+			[]string{"ui: add a page on db.internal.example.com", "api: PLAT-12 handle nil", "deps: bump bar", "UI: wip button"},
+		},
+		{
+			"drop-bots", map[string]interface{}{"authors": []interface{}{"^Renovate"}},
+			[]string{"ui: add a page on db.internal.example.com", "api: PLAT-12 handle nil", "UI: wip button"},
+		},
+		{
+			"rewrite", map[string]interface{}{"pattern": `^PLAT-(\d+) (.*)`, "replacement": "$2 (PLAT-$1)"},
+			[]string{"ui: add a page on db.internal.example.com", "deps: bump foo", "api: handle nil (PLAT-12)", "deps: bump bar", "UI: wip button"},
+		},
+		{
+			"components", map[string]interface{}{"rename": map[string]interface{}{"ui": "web", "deps": ""}},
+			[]string{"web: add a page on db.internal.example.com", ": bump foo", "api: PLAT-12 handle nil", ": bump bar", "web: wip button"},
+		},
+		{
+			"redact", map[string]interface{}{"patterns": []interface{}{`[a-z.]+\.internal\.example\.com`, `PLAT-\d+`}},
+			[]string{"ui: add a page on [redacted]", "deps: bump foo", "api: [redacted] handle nil", "deps: bump bar", "UI: wip button"},
+		},
+	}
+
+	for _, c := range cases {
+		processor, err := changelog.NewProcessor(c.name, c.options)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		got, err := processor.Process(context.Background(), nil, commits())
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(entries(got), c.want) {
+			t.Errorf("%s: expected\n\t%q\ngot\n\t%q", c.name, c.want, entries(got))
+		}
+	}
+}
+
+func TestNewProcessorErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		options map[string]interface{}
+		err     string
+	}{
+		{"nope", nil, "Processor nope not found! Must be one of"},
+		{"author", map[string]interface{}{}, "Processor author requires a pattern"},
+		{"regex", map[string]interface{}{"pattern": "("}, "Invalid pattern for processor regex"},
+		{"redact", map[string]interface{}{"pattern": "x"}, "Invalid options for processor redact"},
+		{"path", map[string]interface{}{"exclude": true}, "Processor path requires paths"},
+	}
+
+	for _, c := range cases {
+		_, err := changelog.NewProcessor(c.name, c.options)
+		if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestRegisterProcessor(t *testing.T) {
+	changelog.RegisterProcessor("upper", func(options map[string]interface{}) (changelog.Processor, error) {
+		return changelog.ProcessorFunc(func(ctx context.Context, querier changelog.Querier, commits changelog.Commits) (changelog.Commits, error) {
+			for i := range commits {
+				commits[i].Subject = strings.ToUpper(commits[i].Subject)
+			}
+			return commits, nil
+		}), nil
+	})
+	upper, err := changelog.NewProcessor("upper", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	dropBots, _ := changelog.NewProcessor("drop-bots", nil)
+
+	pipeline := changelog.Pipeline{dropBots, upper}
+	got, err := pipeline.Process(context.Background(), nil, changelog.Commits{
+		newCommit("feat: a thing", "Jane Doe", "jane@example.com"),
+		newCommit("fix(deps): bump foo", "dependabot[bot]", "49699333+dependabot[bot]@users.noreply.github.com"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if want := []string{": A THING"}; !reflect.DeepEqual(entries(got), want) {
+		t.Errorf("Expected %q, got %q", want, entries(got))
+	}
+}
+
+func TestRegisterProcessorConcurrently(t *testing.T) {
+	factory := func(options map[string]interface{}) (changelog.Processor, error) {
+		return changelog.Pipeline{}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			changelog.RegisterProcessor(fmt.Sprintf("noop-%d", i), factory)
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := changelog.NewProcessor("drop-bots", nil); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			changelog.SupportedProcessors()
+		}()
+	}
+	wg.Wait()
+	if !strings.Contains(changelog.SupportedProcessors(), "noop-9") {
+		t.Errorf("Expected the registered processors, got %s", changelog.SupportedProcessors())
+	}
+}
+
+func TestPathProcessor(t *testing.T) {
+	dir := fixtureRepo(t)
+	defer os.RemoveAll(dir)
+
+	processor, err := changelog.NewProcessor("path", map[string]interface{}{"paths": []interface{}{"pkg/a/"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	release, err := changelog.Generate(context.Background(), changelog.Options{
+		Querier:    changelog.NewLocalQuerier(filepath.Join(dir, ".git"), dir, changelog.QueryFilter{}),
+		From:       "v1.0.0",
+		Processors: []changelog.Processor{processor},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if got := release.Sections.Order(); !reflect.DeepEqual(got, []string{"Bug Fixes", "Performance", "Unknown"}) {
+		t.Errorf("Expected only the commits changing pkg/a, got sections %v", got)
+	}
+
+	// Queriers that can't list changed files can't filter by path
+	_, err = processor.Process(context.Background(), newFakeQuerier(), changelog.Commits{})
+	if err == nil || err.Error() != "Processor path is not supported by this provider" {
+		t.Errorf("Expected the path processor to be unsupported, got %v", err)
+	}
+}
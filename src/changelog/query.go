@@ -1,18 +1,144 @@
 package changelog
 
 import (
+	"context"
 	"io"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Querier is an interface for the functions needed to generate a changelog
-// from a git repository
+// from a git repository. Every call stops, killing any git process or API
+// request, when its context is done.
 type Querier interface {
-	GetCommits(from, to string) (Commits, error)
-	GetCommitRange(from, to time.Time) (Commits, error)
-	GetOrigin() (string, error)
-	GetLatestCommit() (string, error)
-	GetLatestTag() (string, error)
-	GetLatestTagVersion() (string, error)
-	GetConfig() (io.Reader, error)
+	GetCommits(ctx context.Context, from, to string) (Commits, error)
+	GetCommitRange(ctx context.Context, from, to time.Time) (Commits, error)
+	ForEachCommit(ctx context.Context, r CommitRange, fn CommitFunc) error
+	GetPullRequests(ctx context.Context, from, to string) (Commits, error)
+	GetOrigin(ctx context.Context) (string, error)
+	GetLatestCommit(ctx context.Context) (string, error)
+	GetLatestTag(ctx context.Context, to string) (string, error)
+	GetLatestTagVersion(ctx context.Context, to string) (string, error)
+	TagLister
+	GetConfig(ctx context.Context) (io.Reader, error)
+	GetFile(ctx context.Context, path string) (io.Reader, error)
+}
+
+// QueryFilter limits the commits and tags a Querier returns
+type QueryFilter struct {
+	// Paths only includes commits that change at least one of the paths
+	Paths []string
+	// TagPrefix only considers tags starting with the prefix, like `pkg-a/`
+	TagPrefix string
+	// TagPattern only considers tags matching the glob, like `v[0-9]*`
+	TagPattern string
+	// IgnorePrereleases skips tags with semver pre-release versions
+	IgnorePrereleases bool
+	// Merges decides which merge commits are returned
+	Merges MergePolicy
+}
+
+// MergePolicy decides which merge commits a Querier returns
+type MergePolicy string
+
+const (
+	// IncludeMerges returns merge commits along with every other commit
+	IncludeMerges MergePolicy = ""
+	// ExcludeMerges leaves out merge commits, like `git log --no-merges`
+	ExcludeMerges MergePolicy = "exclude"
+	// OnlyMerges only returns merge commits, like `git log --merges`
+	OnlyMerges MergePolicy = "only"
+	// FirstParent only follows the first parent of merge commits, like
+	// `git log --first-parent`, leaving out the commits of merged branches
+	FirstParent MergePolicy = "first-parent"
+)
+
+// MergePolicies are the valid values of QueryFilter.Merges, besides the
+// default of including every merge
+var MergePolicies = []MergePolicy{ExcludeMerges, OnlyMerges, FirstParent}
+
+// mergeFilter applies a MergePolicy to commits listed newest first, for
+// providers that can't filter merges themselves
+type mergeFilter struct {
+	policy MergePolicy
+	// next is the first parent of the last commit kept when following first
+	// parents
+	next    string
+	started bool
+}
+
+// keep reports whether a commit with the given parents passes the policy
+func (f *mergeFilter) keep(hash string, parents []string) bool {
+	switch f.policy {
+	case ExcludeMerges:
+		return len(parents) < 2
+	case OnlyMerges:
+		return len(parents) > 1
+	case FirstParent:
+		if f.started && hash != f.next {
+			return false
+		}
+		f.started = true
+		f.next = ""
+		if len(parents) > 0 {
+			f.next = parents[0]
+		}
+	}
+	return true
+}
+
+// Tagger is an interface for queriers that can create and publish annotated
+// tags
+type Tagger interface {
+	Tag(ctx context.Context, name, target, message string) error
+	PushTag(ctx context.Context, name string) error
+}
+
+// CommitRange selects the commits to iterate over, either by revision or by
+// date. Since and Until take precedence over From and To when either is set.
+type CommitRange struct {
+	// From excludes the commit and its history. Empty starts at the beginning
+	// of the repository history
+	From string
+	// To is the last commit. Empty means HEAD
+	To string
+	// Since excludes commits older than the time
+	Since time.Time
+	// Until excludes commits newer than the time
+	Until time.Time
+}
+
+// byDate reports whether the range is selected by date rather than revision
+func (r CommitRange) byDate() bool {
+	return !r.Since.IsZero() || !r.Until.IsZero()
+}
+
+// to returns the last commit of the range, defaulting to HEAD
+func (r CommitRange) to() string {
+	if r.To == "" {
+		return "HEAD"
+	}
+	return r.To
+}
+
+// CommitFunc is called with each commit, newest first. Returning
+// ErrStopIteration ends the iteration early without an error.
+type CommitFunc func(c Commit) error
+
+// ErrStopIteration is returned from a CommitFunc to stop iterating
+var ErrStopIteration = errors.New("stop iteration")
+
+// collectCommits gathers every commit in range into a slice, for the queriers'
+// GetCommits and GetCommitRange
+func collectCommits(ctx context.Context, q Querier, r CommitRange) (Commits, error) {
+	var commits Commits
+	err := q.ForEachCommit(ctx, r, func(c Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commits, nil
 }
@@ -0,0 +1,108 @@
+package changelog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SemverRegex is used to parse semantic versions, with an optional leading `v`
+// and optional minor and patch versions
+var SemverRegex = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+([0-9A-Za-z.-]+))?$`)
+
+// Version is a semantic version
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease []string
+	Build      string
+}
+
+// ParseVersion parses a semantic version like `v1.2.3-rc.1+build.5`
+func ParseVersion(version string) (Version, error) {
+	match := SemverRegex.FindStringSubmatch(version)
+	if match == nil {
+		return Version{}, errors.Errorf("%s is not a semantic version", version)
+	}
+
+	v := Version{Build: match[5]}
+	for i, part := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if match[i+1] == "" {
+			continue
+		}
+		number, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return Version{}, errors.WithStack(err)
+		}
+		*part = number
+	}
+	if match[4] != "" {
+		v.Prerelease = strings.Split(match[4], ".")
+	}
+	return v, nil
+}
+
+// IsPrerelease reports whether the version has pre-release identifiers
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Compare returns -1, 0 or 1 if the version has lower, equal or higher
+// precedence than other. Build metadata is ignored.
+func (v Version) Compare(other Version) int {
+	if c := compareInts(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareInts(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareInts(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+
+	// A release has higher precedence than any of its pre-releases
+	switch {
+	case !v.IsPrerelease() && !other.IsPrerelease():
+		return 0
+	case !v.IsPrerelease():
+		return 1
+	case !other.IsPrerelease():
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if c := compareIdentifiers(v.Prerelease[i], other.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(v.Prerelease), len(other.Prerelease))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifiers compares pre-release identifiers. Numeric identifiers are
+// compared numerically, and have lower precedence than alphanumeric ones.
+func compareIdentifiers(a, b string) int {
+	aNumber, aErr := strconv.Atoi(a)
+	bNumber, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareInts(aNumber, bNumber)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
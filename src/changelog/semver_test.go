@@ -0,0 +1,64 @@
+package changelog_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/skuid/changelog/src/changelog"
+)
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		version string
+		want    changelog.Version
+		err     bool
+	}{
+		{"1.2.3", changelog.Version{Major: 1, Minor: 2, Patch: 3}, false},
+		{"v1.2.3", changelog.Version{Major: 1, Minor: 2, Patch: 3}, false},
+		{"v1.2", changelog.Version{Major: 1, Minor: 2}, false},
+		{"1.2.3-rc.1+build.5", changelog.Version{Major: 1, Minor: 2, Patch: 3, Prerelease: []string{"rc", "1"}, Build: "build.5"}, false},
+		{"release-1", changelog.Version{}, true},
+		{"1.2.3.4", changelog.Version{}, true},
+	}
+	for _, c := range cases {
+		got, err := changelog.ParseVersion(c.version)
+		if (err != nil) != c.err {
+			t.Errorf("Unexpected error for %s: %v", c.version, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			errorDiff(t, "Versions not equal!", fmt.Sprintf("%+v", c.want), fmt.Sprintf("%+v", got))
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// Each version has lower precedence than the next
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		lower, _ := changelog.ParseVersion(ordered[i])
+		higher, _ := changelog.ParseVersion(ordered[i+1])
+		if lower.Compare(higher) != -1 || higher.Compare(lower) != 1 {
+			t.Errorf("Expected %s to have lower precedence than %s", ordered[i], ordered[i+1])
+		}
+	}
+
+	a, _ := changelog.ParseVersion("v1.0.0+build.1")
+	b, _ := changelog.ParseVersion("1.0.0+build.2")
+	if a.Compare(b) != 0 {
+		t.Errorf("Expected build metadata to be ignored")
+	}
+}
@@ -0,0 +1,123 @@
+package changelog
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tag is a git tag and the commit it points to
+type Tag struct {
+	Name   string
+	Commit string
+	// Date is when the tag was created, if the provider knows
+	Date time.Time
+}
+
+// TagLister is an interface for listing tags and checking which ones are part
+// of a commit's history
+type TagLister interface {
+	GetTags(ctx context.Context) ([]Tag, error)
+	IsAncestor(ctx context.Context, commit, to string) (bool, error)
+}
+
+// matches reports whether the tag is allowed by the filter, returning the tag
+// name without the prefix
+func (f QueryFilter) matches(tag string) (string, bool) {
+	if !strings.HasPrefix(tag, f.TagPrefix) {
+		return "", false
+	}
+	if f.TagPattern != "" {
+		if ok, err := path.Match(f.TagPattern, tag); err != nil || !ok {
+			return "", false
+		}
+	}
+	return strings.TrimPrefix(tag, f.TagPrefix), true
+}
+
+// NoMatchingTagError is returned when no tag matching a filter is reachable
+// from a revision, like before a repository or package's first release
+type NoMatchingTagError struct {
+	Filter QueryFilter
+	To     string
+}
+
+func (e *NoMatchingTagError) Error() string {
+	message := "No tag"
+	if e.Filter.TagPrefix != "" {
+		message += fmt.Sprintf(" with prefix %s", e.Filter.TagPrefix)
+	}
+	if e.Filter.TagPattern != "" {
+		message += fmt.Sprintf(" matching %s", e.Filter.TagPattern)
+	}
+	return message + fmt.Sprintf(" is reachable from %s", e.To)
+}
+
+// IsNoMatchingTag reports whether the cause of an error is a
+// NoMatchingTagError
+func IsNoMatchingTag(err error) bool {
+	_, ok := errors.Cause(err).(*NoMatchingTagError)
+	return ok
+}
+
+type versionedTag struct {
+	Tag
+	version Version
+}
+
+// LatestTag returns the tag with the highest semantic version that matches
+// the filter and is reachable from `to`. If none of the matching tags are
+// semantic versions, the most recently created reachable tag is used instead.
+// A NoMatchingTagError is returned if no tags match.
+func LatestTag(ctx context.Context, lister TagLister, filter QueryFilter, to string) (Tag, error) {
+	tags, err := lister.GetTags(ctx)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	versioned := []versionedTag{}
+	other := []versionedTag{}
+	for _, tag := range tags {
+		name, ok := filter.matches(tag.Name)
+		if !ok {
+			continue
+		}
+		version, err := ParseVersion(name)
+		if err != nil {
+			other = append(other, versionedTag{Tag: tag})
+			continue
+		}
+		if filter.IgnorePrereleases && version.IsPrerelease() {
+			continue
+		}
+		versioned = append(versioned, versionedTag{tag, version})
+	}
+
+	candidates := versioned
+	if len(versioned) > 0 {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].version.Compare(candidates[j].version) > 0
+		})
+	} else {
+		candidates = other
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Date.After(candidates[j].Date)
+		})
+	}
+
+	for _, candidate := range candidates {
+		reachable, err := lister.IsAncestor(ctx, candidate.Commit, to)
+		if err != nil {
+			return Tag{}, err
+		}
+		if reachable {
+			return candidate.Tag, nil
+		}
+	}
+	return Tag{}, &NoMatchingTagError{filter, to}
+}
@@ -0,0 +1,97 @@
+package changelog_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skuid/changelog/src/changelog"
+)
+
+type fakeTagLister struct {
+	tags []changelog.Tag
+	// unreachable commits aren't ancestors of anything
+	unreachable map[string]bool
+}
+
+func (f fakeTagLister) GetTags(ctx context.Context) ([]changelog.Tag, error) {
+	return f.tags, nil
+}
+
+func (f fakeTagLister) IsAncestor(ctx context.Context, commit, to string) (bool, error) {
+	return !f.unreachable[commit], nil
+}
+
+func TestLatestTag(t *testing.T) {
+	lister := fakeTagLister{
+		tags: []changelog.Tag{
+			{Name: "v1.2.0", Commit: "a"},
+			{Name: "v1.10.0", Commit: "b"},
+			{Name: "v1.11.0-rc.1", Commit: "c"},
+			{Name: "v2.0.0", Commit: "d"},
+			{Name: "pkg-a/v3.0.0", Commit: "e"},
+			{Name: "pkg-a/v3.1.0", Commit: "f"},
+			{Name: "nightly", Commit: "g"},
+		},
+		unreachable: map[string]bool{"d": true},
+	}
+
+	cases := []struct {
+		filter changelog.QueryFilter
+		want   string
+	}{
+		{changelog.QueryFilter{}, "v1.11.0-rc.1"},
+		{changelog.QueryFilter{TagPattern: "v*"}, "v1.11.0-rc.1"},
+		{changelog.QueryFilter{TagPattern: "v*", IgnorePrereleases: true}, "v1.10.0"},
+		{changelog.QueryFilter{TagPrefix: "pkg-a/"}, "pkg-a/v3.1.0"},
+	}
+	for _, c := range cases {
+		got, err := changelog.LatestTag(context.Background(), lister, c.filter, "HEAD")
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+		if got.Name != c.want {
+			errorDiff(t, "Latest tag not equal!", c.want, got.Name)
+		}
+	}
+}
+
+func TestLatestTagNoMatch(t *testing.T) {
+	lister := fakeTagLister{
+		tags: []changelog.Tag{
+			{Name: "pkg-a/v3.0.0", Commit: "a"},
+			{Name: "v2.0.0", Commit: "b"},
+		},
+		unreachable: map[string]bool{"b": true},
+	}
+
+	for _, filter := range []changelog.QueryFilter{{TagPrefix: "pkg-b/"}, {TagPattern: "v*"}} {
+		_, err := changelog.LatestTag(context.Background(), lister, filter, "HEAD")
+		if !changelog.IsNoMatchingTag(err) {
+			t.Errorf("Expected a NoMatchingTagError for %+v, got %v", filter, err)
+		}
+	}
+	_, err := changelog.LatestTag(context.Background(), lister, changelog.QueryFilter{TagPrefix: "pkg-b/"}, "HEAD")
+	if err == nil || err.Error() != "No tag with prefix pkg-b/ is reachable from HEAD" {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+}
+
+func TestLatestTagWithoutSemver(t *testing.T) {
+	now := time.Now()
+	lister := fakeTagLister{
+		tags: []changelog.Tag{
+			{Name: "release-a", Commit: "a", Date: now.Add(-2 * time.Hour)},
+			{Name: "release-c", Commit: "c", Date: now},
+			{Name: "release-b", Commit: "b", Date: now.Add(-time.Hour)},
+		},
+		unreachable: map[string]bool{"c": true},
+	}
+	got, err := changelog.LatestTag(context.Background(), lister, changelog.QueryFilter{}, "HEAD")
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if got.Name != "release-b" {
+		errorDiff(t, "Latest tag not equal!", "release-b", got.Name)
+	}
+}
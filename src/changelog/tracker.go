@@ -0,0 +1,108 @@
+package changelog
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Tracker is an external issue tracker, like Jira, whose keys are linked in
+// the changelog
+type Tracker struct {
+	Name string
+	// Pattern matches a key, like `\b[A-Z][A-Z0-9]+-\d+\b`. If it has a
+	// capture group, the first group is the key.
+	Pattern *regexp.Regexp
+	// URL is the link to an issue, with `{key}` replaced by its key
+	URL string
+}
+
+// BoardsTracker is the name of the tracker that links Azure Boards work items
+// closed or broken by commits, like `Fixes AB#12`. Its key is the work item's
+// number.
+const BoardsTracker = "boards"
+
+// boardsPrefix starts references to Azure Boards work items
+const boardsPrefix = "AB#"
+
+// NewTracker returns a tracker matching keys with the pattern
+func NewTracker(name, pattern, url string) (Tracker, error) {
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return Tracker{}, errors.Wrapf(err, "Invalid pattern for tracker %s", name)
+	}
+	if !strings.Contains(url, "{key}") {
+		return Tracker{}, errors.Errorf("URL for tracker %s must contain {key}", name)
+	}
+	return Tracker{Name: name, Pattern: regex, URL: url}, nil
+}
+
+// Link returns the URL of the issue with the key
+func (t Tracker) Link(key string) string {
+	return strings.Replace(t.URL, "{key}", key, -1)
+}
+
+// Reference is an issue in an external tracker referenced by a commit
+type Reference struct {
+	Tracker string
+	Key     string
+	URL     string
+}
+
+// findReferences returns each key of the trackers in a commit message, in the
+// order they first appear
+func findReferences(trackers []Tracker, message string) []Reference {
+	type found struct {
+		Reference
+		offset int
+	}
+	matches := []found{}
+	for _, tracker := range trackers {
+		for _, match := range tracker.Pattern.FindAllStringSubmatchIndex(message, -1) {
+			start, end := match[0], match[1]
+			if len(match) > 3 {
+				start, end = match[2], match[3]
+			}
+			if start < 0 || start == end {
+				continue
+			}
+			key := message[start:end]
+			matches = append(matches, found{Reference{Tracker: tracker.Name, Key: key, URL: tracker.Link(key)}, start})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].offset < matches[j].offset })
+
+	var refs []Reference
+	seen := map[Reference]bool{}
+	for _, match := range matches {
+		if !seen[match.Reference] {
+			seen[match.Reference] = true
+			refs = append(refs, match.Reference)
+		}
+	}
+	return refs
+}
+
+// mergeReferences combines the references of several commits, sorted by
+// tracker and key
+func mergeReferences(first []Reference, successive ...[]Reference) []Reference {
+	seen := map[Reference]bool{}
+	merged := []Reference{}
+	for _, refs := range append([][]Reference{first}, successive...) {
+		for _, ref := range refs {
+			if !seen[ref] {
+				seen[ref] = true
+				merged = append(merged, ref)
+			}
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Tracker != merged[j].Tracker {
+			return merged[i].Tracker < merged[j].Tracker
+		}
+		return merged[i].Key < merged[j].Key
+	})
+	return merged
+}
@@ -0,0 +1,85 @@
+package changelog_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/linkStyle"
+)
+
+func TestNewTracker(t *testing.T) {
+	if _, err := changelog.NewTracker("jira", `[A-Z`, "https://jira.example.com/browse/{key}"); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+	if _, err := changelog.NewTracker("jira", `[A-Z]+-\d+`, "https://jira.example.com/browse/"); err == nil {
+		t.Error("Expected an error for a URL without {key}")
+	}
+}
+
+func TestTrackerReferences(t *testing.T) {
+	jira, err := changelog.NewTracker("jira", `\b[A-Z][A-Z0-9]+-\d+\b`, "https://jira.example.com/browse/{key}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	redmine, err := changelog.NewTracker("redmine", `refs RM(\d+)`, "https://redmine.example.com/issues/{key}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	parser := changelog.NewParser(changelog.Keywords{}, []changelog.Tracker{jira, redmine})
+
+	commit := parser.Parse(
+		"029aafdc7579af19b3ce6acf0ce245a230633953",
+		"fix(api): PLAT-12 handle empty input\n\nAlso touches PLAT-7, refs RM42 and PLAT-12.\n\nJira: OPS-3",
+	)
+	want := []changelog.Reference{
+		{Tracker: "jira", Key: "PLAT-12", URL: "https://jira.example.com/browse/PLAT-12"},
+		{Tracker: "jira", Key: "PLAT-7", URL: "https://jira.example.com/browse/PLAT-7"},
+		{Tracker: "redmine", Key: "42", URL: "https://redmine.example.com/issues/42"},
+		{Tracker: "jira", Key: "OPS-3", URL: "https://jira.example.com/browse/OPS-3"},
+	}
+	if !reflect.DeepEqual(commit.References, want) {
+		errorDiff(t, "References not equal!", fmt.Sprintf("%+v", want), fmt.Sprintf("%+v", commit.References))
+	}
+
+	commit.References = commit.References[:2]
+	got := commit.Summary("https://github.com/skuid/changelog", templates(linkStyle.Github))
+	summary := "PLAT-12 handle empty input ([029aafdc](https://github.com/skuid/changelog/commit/029aafdc7579af19b3ce6acf0ce245a230633953)), refs [PLAT-12](https://jira.example.com/browse/PLAT-12) [PLAT-7](https://jira.example.com/browse/PLAT-7)"
+	if got != summary {
+		errorDiff(t, "Commit summary failed", summary, got)
+	}
+}
+
+func TestBoardsTracker(t *testing.T) {
+	commit := changelog.NewCommit(
+		"029aafdc7579af19b3ce6acf0ce245a230633953",
+		"fix(api): handle empty input\n\nFixes AB#12 and #3, see AB#13",
+	)
+	if !reflect.DeepEqual(commit.Closes, []string{"AB#12", "3"}) {
+		t.Errorf("Expected closes [AB#12 3], got %v", commit.Closes)
+	}
+
+	hash := "[029aafdc](https://dev.azure.com/org/project/_git/repo/commit/029aafdc7579af19b3ce6acf0ce245a230633953)"
+	got := commit.Summary("https://dev.azure.com/org/project/_git/repo", templates(linkStyle.AzureDevOps))
+	summary := "handle empty input (" + hash + "), closes [AB#12](https://dev.azure.com/org/project/_workitems/edit/12) [#3](https://dev.azure.com/org/project/_workitems/edit/3)"
+	if got != summary {
+		errorDiff(t, "Commit summary failed", summary, got)
+	}
+	got = commit.Summary("https://github.com/skuid/changelog", templates(linkStyle.Github))
+	summary = "handle empty input ([029aafdc](https://github.com/skuid/changelog/commit/029aafdc7579af19b3ce6acf0ce245a230633953)), closes AB#12 [#3](https://github.com/skuid/changelog/issues/3)"
+	if got != summary {
+		errorDiff(t, "Commit summary failed", summary, got)
+	}
+
+	boards, err := changelog.NewTracker(changelog.BoardsTracker, `\bAB#(\d+)`, "https://dev.azure.com/org/project/_workitems/edit/{key}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	commit = changelog.NewParser(changelog.Keywords{}, []changelog.Tracker{boards}).Parse(commit.Hash, "fix(api): handle empty input\n\nFixes AB#12 and #3, see AB#13")
+	got = commit.Summary("https://github.com/skuid/changelog", templates(linkStyle.Github))
+	summary = "handle empty input ([029aafdc](https://github.com/skuid/changelog/commit/029aafdc7579af19b3ce6acf0ce245a230633953)), closes [AB#12](https://dev.azure.com/org/project/_workitems/edit/12) [#3](https://github.com/skuid/changelog/issues/3), refs [13](https://dev.azure.com/org/project/_workitems/edit/13)"
+	if got != summary {
+		errorDiff(t, "Commit summary failed", summary, got)
+	}
+}
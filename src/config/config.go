@@ -0,0 +1,125 @@
+// Package config describes the configuration of changelog, and validates
+// configuration files.
+package config
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/linkStyle"
+)
+
+// Config is the configuration read from flags, `CHANGELOG_` environment
+// variables and the repository's `.clog.toml`. Any flag may also be set in the
+// file.
+type Config struct {
+	Provider string `mapstructure:"provider"`
+	Repo     string `mapstructure:"repo"`
+	Token    string `mapstructure:"token"`
+	CacheDir string `mapstructure:"cache-dir"`
+	GitDir   string `mapstructure:"git-dir"`
+	WorkTree string `mapstructure:"work-tree"`
+
+	Version   string `mapstructure:"version"`
+	Subtitle  string `mapstructure:"subtitle"`
+	Changelog string `mapstructure:"changelog"`
+
+	From              string        `mapstructure:"from"`
+	To                string        `mapstructure:"to"`
+	FromLatestTag     bool          `mapstructure:"from-latest-tag"`
+	TagPrefix         string        `mapstructure:"tag-prefix"`
+	TagPattern        string        `mapstructure:"tag-pattern"`
+	IgnorePrereleases bool          `mapstructure:"ignore-prereleases"`
+	Since             string        `mapstructure:"since"`
+	Until             string        `mapstructure:"until"`
+	Timeout           time.Duration `mapstructure:"timeout"`
+	Path              []string      `mapstructure:"path"`
+	Package           string        `mapstructure:"package"`
+
+	IncludeAll     bool   `mapstructure:"include-all"`
+	Contributors   bool   `mapstructure:"contributors"`
+	LinkStyle      string `mapstructure:"link-style"`
+	Merges         string `mapstructure:"merges"`
+	MergeCloses    bool   `mapstructure:"merge-closes"`
+	KeepDuplicates bool   `mapstructure:"keep-duplicates"`
+	GroupBy        string `mapstructure:"group-by"`
+
+	// Settings of `changelog release`
+	Tag        string   `mapstructure:"tag"`
+	Draft      bool     `mapstructure:"draft"`
+	Prerelease bool     `mapstructure:"prerelease"`
+	PublishTo  string   `mapstructure:"publish-to"`
+	Push       bool     `mapstructure:"push"`
+	Asset      []string `mapstructure:"asset"`
+
+	// Settings of `changelog serve`
+	Secret         string        `mapstructure:"secret"`
+	Port           int           `mapstructure:"port"`
+	RequestTimeout time.Duration `mapstructure:"request-timeout"`
+
+	// Extends names the configuration files this one is merged over
+	Extends []string `mapstructure:"extends"`
+
+	// Sections and Labels map section titles to commit prefixes and pull
+	// request labels. Titles are lowercased when read, so they must be
+	// lowercase in the file.
+	Sections   map[string][]string            `mapstructure:"sections" config:"lowercase"`
+	Labels     map[string][]string            `mapstructure:"labels" config:"lowercase"`
+	Order      []string                       `mapstructure:"order"`
+	Keywords   Keywords                       `mapstructure:"keywords"`
+	Trackers   map[string]Tracker             `mapstructure:"trackers"`
+	Packages   map[string]Package             `mapstructure:"packages"`
+	LinkStyles map[string]linkStyle.Templates `mapstructure:"link-styles"`
+	Hosts      map[string]string              `mapstructure:"hosts"`
+	Processors []map[string]interface{}       `mapstructure:"processors"`
+}
+
+// Keywords replace the keywords of issue references
+type Keywords struct {
+	Closes []string `mapstructure:"closes"`
+	Breaks []string `mapstructure:"breaks"`
+}
+
+// Tracker is an external issue tracker, configured in the `trackers` table
+type Tracker struct {
+	Pattern string `mapstructure:"pattern"`
+	URL     string `mapstructure:"url"`
+}
+
+// Package is a package of a monorepo, configured in the `packages` table
+type Package struct {
+	Paths     []string `mapstructure:"paths"`
+	TagPrefix string   `mapstructure:"tag-prefix"`
+	Changelog string   `mapstructure:"changelog"`
+	Version   string   `mapstructure:"version"`
+}
+
+// Keys returns the top-level keys of the configuration, in the order of the
+// fields of Config
+func Keys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, t.NumField())
+	for i := range keys {
+		keys[i] = t.Field(i).Tag.Get("mapstructure")
+	}
+	return keys
+}
+
+// Decode reads settings, keyed like the file, into a Config
+func Decode(settings map[string]interface{}) (*Config, error) {
+	c := &Config{}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           c,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := decoder.Decode(settings); err != nil {
+		return nil, errors.Wrap(err, "Could not read configuration")
+	}
+	return c, nil
+}
@@ -0,0 +1,299 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/spf13/viper"
+)
+
+// Extender reads configuration files over the files their `extends` setting
+// names, so settings shared by many repositories can be changed in one
+// place. Each reference in `extends` is one of
+//
+//   - an HTTP URL of a configuration file, like
+//     `https://example.com/changelog/base.toml`
+//   - a local configuration file
+//   - a repository, whose configuration file is read with its Querier's
+//     GetConfig, like `https://github.com/acme/changelog-config` or a
+//     directory for local providers
+//
+// Relative paths of local files are relative to Dir, even in extended files.
+// Extended files may extend others in turn. Fetched files are cached, so a
+// file extended twice is only fetched once.
+type Extender struct {
+	// Client fetches HTTP URLs. URLs are refused if nil.
+	Client *http.Client
+	// Dir is the directory relative paths of local files are read from.
+	// Local files are refused if empty.
+	Dir string
+	// Repository returns the querier of a repository. Repositories are
+	// refused if nil.
+	Repository func(ref string) (changelog.Querier, error)
+	// TTL is how long fetched files are reused. They are kept for the life of
+	// the Extender if zero.
+	TTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedSettings
+}
+
+type cachedSettings struct {
+	settings map[string]interface{}
+	fetched  time.Time
+}
+
+// Read reads a configuration file returned by GetConfig into v, merged over
+// the files it extends
+func (e *Extender) Read(ctx context.Context, v *viper.Viper, r io.Reader) error {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	format := changelog.ConfigType(r)
+
+	settings, err := e.Extend(ctx, bytes.NewReader(contents), format)
+	if err != nil {
+		return err
+	}
+	// Files that extend nothing are read as they are
+	if _, ok := settings["extends"]; !ok {
+		v.SetConfigType(format)
+		return v.ReadConfig(bytes.NewReader(contents))
+	}
+	merged, err := json.Marshal(settings)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	v.SetConfigType("json")
+	return v.ReadConfig(bytes.NewReader(merged))
+}
+
+// Extend reads a configuration file of the format, merged over the files it
+// extends. Later references in `extends` take precedence over earlier ones,
+// and the file's own settings over all of them.
+func (e *Extender) Extend(ctx context.Context, r io.Reader, format string) (map[string]interface{}, error) {
+	return e.extend(ctx, r, format, nil)
+}
+
+// extend reads a file, merged over the files it extends. seen holds the
+// references being read, to catch files that extend themselves.
+func (e *Extender) extend(ctx context.Context, r io.Reader, format string, seen []string) (map[string]interface{}, error) {
+	tree, err := parse(r, format)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not parse configuration")
+	}
+	settings := tree.ToMap()
+
+	refs, err := extendsRefs(settings["extends"])
+	if err != nil {
+		return nil, err
+	}
+	merged := map[string]interface{}{}
+	for _, ref := range refs {
+		base, err := e.fetch(ctx, ref, seen)
+		if err != nil {
+			return nil, err
+		}
+		merged = Merge(merged, base)
+	}
+	return Merge(merged, settings), nil
+}
+
+// fetch returns the settings of an extended file, merged over the files it
+// extends in turn
+func (e *Extender) fetch(ctx context.Context, ref string, seen []string) (map[string]interface{}, error) {
+	for _, s := range seen {
+		if s == ref {
+			return nil, errors.Errorf("Configuration %s extends itself: %s", ref, strings.Join(append(seen, ref), " -> "))
+		}
+	}
+
+	e.mu.Lock()
+	cached, ok := e.cache[ref]
+	e.mu.Unlock()
+	if ok && (e.TTL == 0 || time.Since(cached.fetched) < e.TTL) {
+		return cached.settings, nil
+	}
+
+	file, err := e.open(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not read extended configuration %s", ref)
+	}
+	settings, err := e.extend(ctx, file, file.Type(), append(seen, ref))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not read extended configuration %s", ref)
+	}
+
+	e.mu.Lock()
+	if e.cache == nil {
+		e.cache = map[string]cachedSettings{}
+	}
+	e.cache[ref] = cachedSettings{settings, time.Now()}
+	e.mu.Unlock()
+	return settings, nil
+}
+
+// open returns the configuration file a reference names
+func (e *Extender) open(ctx context.Context, ref string) (*changelog.ConfigFile, error) {
+	if u, err := url.Parse(ref); err == nil && (u.Scheme == "http" || u.Scheme == "https") && isConfigFile(u.Path) {
+		if e.Client == nil {
+			return nil, errors.New("HTTP URLs can't be extended here")
+		}
+		return e.get(ctx, u)
+	}
+
+	if e.Dir != "" {
+		name := ref
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(e.Dir, name)
+		}
+		if info, err := os.Stat(name); err == nil && !info.IsDir() {
+			contents, err := ioutil.ReadFile(name)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			return changelog.NewConfigFile(name, bytes.NewReader(contents))
+		}
+	}
+
+	if e.Repository == nil {
+		return nil, errors.New("repositories can't be extended here")
+	}
+	querier, err := e.Repository(ref)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := querier.(io.Closer); ok {
+		defer closer.Close()
+	}
+	r, err := querier.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return changelog.NewConfigFile(changelog.ConfigPath(r), r)
+}
+
+// get fetches a configuration file over HTTP
+func (e *Extender) get(ctx context.Context, u *url.URL) (*changelog.ConfigFile, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resp, err := e.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s returned %s", u, resp.Status)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return changelog.NewConfigFile(path.Base(u.Path), bytes.NewReader(contents))
+}
+
+// isConfigFile reports whether a path names a file of a configuration format
+func isConfigFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".toml", ".yml", ".yaml", ".json":
+		return true
+	}
+	return false
+}
+
+// extendsRefs returns the references of the `extends` setting, a string or
+// an array of strings
+func extendsRefs(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if value == "" {
+			return nil, nil
+		}
+		return []string{value}, nil
+	case []interface{}:
+		refs := []string{}
+		for _, v := range value {
+			ref, ok := v.(string)
+			if !ok {
+				return nil, errors.Errorf("extends must be a string or an array of strings, got %s", describe(value))
+			}
+			refs = append(refs, ref)
+		}
+		return refs, nil
+	}
+	return nil, errors.Errorf("extends must be a string or an array of strings, got %s", describe(value))
+}
+
+// Merge returns the settings of a file merged over the settings of a file it
+// extends. Tables are merged key by key, and the aliases of sections and
+// labels are added to the aliases of the sections they extend, like
+// changelog.MergeSectionAliasMaps. Other values, including arrays like
+// `order` and `processors`, replace the values they extend.
+func Merge(base, settings map[string]interface{}) map[string]interface{} {
+	return mergeTables(base, settings, "")
+}
+
+func mergeTables(base, settings map[string]interface{}, path string) map[string]interface{} {
+	aliases := path == "sections" || path == "labels"
+	merged := map[string]interface{}{}
+	for k, v := range base {
+		if aliases {
+			k = strings.ToLower(k)
+		}
+		merged[k] = v
+	}
+	for k, v := range settings {
+		if aliases {
+			k = strings.ToLower(k)
+		}
+		existing, ok := merged[k]
+		if !ok {
+			merged[k] = v
+			continue
+		}
+		baseTable, baseIsTable := existing.(map[string]interface{})
+		table, isTable := v.(map[string]interface{})
+		baseList, baseIsList := existing.([]interface{})
+		list, isList := v.([]interface{})
+		switch {
+		case baseIsTable && isTable:
+			merged[k] = mergeTables(baseTable, table, join(path, k))
+		case aliases && baseIsList && isList && isStrings(baseList) && isStrings(list):
+			merged[k] = union(baseList, list)
+		default:
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// union returns the values of both arrays, without duplicates
+func union(first, second []interface{}) []interface{} {
+	values := []interface{}{}
+	seen := map[interface{}]bool{}
+	for _, v := range append(append([]interface{}{}, first...), second...) {
+		if !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,142 @@
+package config_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/config"
+	"github.com/spf13/viper"
+)
+
+// repoQuerier is a repository holding only a configuration file
+type repoQuerier struct {
+	changelog.Querier
+	path, contents string
+}
+
+func (q repoQuerier) GetConfig(ctx context.Context) (io.Reader, error) {
+	return &changelog.ConfigFile{Reader: strings.NewReader(q.contents), Path: q.path}, nil
+}
+
+func TestMerge(t *testing.T) {
+	base := map[string]interface{}{
+		"from-latest-tag": true,
+		"order":           []interface{}{"Features", "Documentation"},
+		"sections": map[string]interface{}{
+			"documentation": []interface{}{"docs"},
+			"cleanup":       []interface{}{"clean"},
+		},
+		"trackers": map[string]interface{}{
+			"jira": map[string]interface{}{"pattern": "PLAT-\\d+", "url": "https://example.com/{key}"},
+		},
+	}
+	settings := map[string]interface{}{
+		"order": []interface{}{"Documentation"},
+		"sections": map[string]interface{}{
+			"Documentation": []interface{}{"doc", "docs"},
+		},
+		"trackers": map[string]interface{}{
+			"jira": map[string]interface{}{"url": "https://jira.example.com/{key}"},
+		},
+	}
+	want := map[string]interface{}{
+		"from-latest-tag": true,
+		"order":           []interface{}{"Documentation"},
+		"sections": map[string]interface{}{
+			"documentation": []interface{}{"docs", "doc"},
+			"cleanup":       []interface{}{"clean"},
+		},
+		"trackers": map[string]interface{}{
+			"jira": map[string]interface{}{"pattern": "PLAT-\\d+", "url": "https://jira.example.com/{key}"},
+		},
+	}
+	if got := config.Merge(base, settings); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestExtender(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/org.yml":
+			fmt.Fprint(w, "sections:\n  documentation: [docs]\ncontributors: true\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "extends")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	team := fmt.Sprintf("extends = %q\n[sections]\ncleanup = [\"clean\"]\n", server.URL+"/org.yml")
+	if err := ioutil.WriteFile(filepath.Join(dir, "team.toml"), []byte(team), 0644); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	e := &config.Extender{
+		Client: server.Client(),
+		Dir:    dir,
+		Repository: func(ref string) (changelog.Querier, error) {
+			switch ref {
+			case "https://git.example.com/acme/policy":
+				return repoQuerier{path: ".changelog.json", contents: `{"extends": "team.toml", "from-latest-tag": true}`}, nil
+			case "https://git.example.com/acme/loop":
+				return repoQuerier{path: ".clog.toml", contents: `extends = "https://git.example.com/acme/loop"`}, nil
+			}
+			return nil, fmt.Errorf("repository %s not found", ref)
+		},
+	}
+
+	file := &changelog.ConfigFile{
+		Reader: strings.NewReader("extends = [\"https://git.example.com/acme/policy\", \"team.toml\"]\ncontributors = false\n[sections]\nDocumentation = [\"doc\"]\n"),
+		Path:   ".clog.toml",
+	}
+	v := viper.New()
+	if err := e.Read(context.Background(), v, file); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !v.GetBool("from-latest-tag") || v.GetBool("contributors") {
+		t.Errorf("Expected from-latest-tag from the policy repository, and the file's own contributors, got %v", v.AllSettings())
+	}
+	sections := v.GetStringMapStringSlice("sections")
+	if !reflect.DeepEqual(sections["documentation"], []string{"docs", "doc"}) || !reflect.DeepEqual(sections["cleanup"], []string{"clean"}) {
+		t.Errorf("Expected the sections to be merged, got %v", sections)
+	}
+	if requests != 1 {
+		t.Errorf("Expected the file extended twice to be fetched once, got %d requests", requests)
+	}
+
+	errorCases := []struct {
+		extends string
+		want    string
+	}{
+		{"https://git.example.com/acme/loop", "Configuration https://git.example.com/acme/loop extends itself"},
+		{server.URL + "/missing.toml", "404 Not Found"},
+		{"https://git.example.com/acme/missing", "repository https://git.example.com/acme/missing not found"},
+	}
+	for _, c := range errorCases {
+		_, err := e.Extend(context.Background(), strings.NewReader(fmt.Sprintf("extends = %q", c.extends)), "toml")
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Expected an error containing %q, got %v", c.want, err)
+		}
+	}
+
+	if _, err := (&config.Extender{}).Extend(context.Background(), strings.NewReader(`extends = "team.toml"`), "toml"); err == nil {
+		t.Error("Expected an error extending a file without a way to read it")
+	}
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// parse reads a configuration file of the format into a TOML tree, so files
+// of every format are validated alike. Only TOML files have positions.
+func parse(r io.Reader, format string) (*toml.Tree, error) {
+	var value interface{}
+	switch format {
+	case "toml":
+		return toml.LoadReader(r)
+	case "yaml", "yml":
+		contents, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := yaml.Unmarshal(contents, &value); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	case "json":
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	default:
+		return nil, errors.Errorf("Unsupported configuration format %s, must be one of toml, yaml, json", format)
+	}
+
+	// An empty YAML file is an empty table
+	if value == nil {
+		value = map[string]interface{}{}
+	}
+	tree, ok := toTree(value).(*toml.Tree)
+	if !ok {
+		return nil, errors.Errorf("expected a table, got %s", describe(value))
+	}
+	return tree, nil
+}
+
+// toTree converts a value decoded from YAML or JSON into the values the TOML
+// parser returns: tables are trees, arrays of tables are slices of trees, and
+// integers are int64s
+func toTree(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		tree, _ := toml.TreeFromMap(map[string]interface{}{})
+		for k, v := range value {
+			tree.SetPath([]string{k}, toTree(v))
+		}
+		return tree
+	case map[interface{}]interface{}:
+		tree, _ := toml.TreeFromMap(map[string]interface{}{})
+		for k, v := range value {
+			tree.SetPath([]string{fmt.Sprint(k)}, toTree(v))
+		}
+		return tree
+	case []interface{}:
+		tables := []*toml.Tree{}
+		values := make([]interface{}, len(value))
+		for i, v := range value {
+			values[i] = toTree(v)
+			if table, ok := values[i].(*toml.Tree); ok {
+				tables = append(tables, table)
+			}
+		}
+		if len(value) > 0 && len(tables) == len(value) {
+			return tables
+		}
+		return values
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case int:
+		return int64(value)
+	}
+	return value
+}
@@ -0,0 +1,47 @@
+package config
+
+// Starter is a commented configuration file for `changelog config init`
+const Starter = `# Configuration for changelog, https://github.com/skuid/changelog
+#
+# Any flag may also be set here, like provider = "github". Flags and
+# CHANGELOG_ environment variables take precedence over this file. Run
+# "changelog config validate" to check it for typos.
+
+# Sections of the changelog, mapped to the commit types listed in them. Section
+# names must be lowercase; they are title cased in the changelog. These are
+# merged into the defaults:
+#
+#   features = ["ft", "feat"]
+#   "bug fixes" = ["fix", "fx"]
+#   performance = ["perf"]
+#   "breaking changes" = ["breaks"]
+#   unknown = ["unk"]
+[sections]
+# documentation = ["docs"]
+
+# The order of the sections. Unlisted sections follow alphabetically, and
+# "Unknown" is always last.
+# order = ["Features", "Bug Fixes", "Documentation"]
+
+# Start from the latest tag, and list who contributed.
+# from-latest-tag = true
+# contributors = true
+
+# Keywords for issues closed and broken by a commit, replacing the defaults.
+# [keywords]
+# closes = ["closes", "fixes", "resolves"]
+# breaks = ["breaks"]
+
+# Link keys of external issue trackers, like PLAT-1234.
+# [trackers.jira]
+# pattern = '\b[A-Z][A-Z0-9]+-\d+\b'
+# url = "https://example.atlassian.net/browse/{key}"
+
+# Link style of a self-hosted provider.
+# [hosts]
+# "git.example.com" = "gitlab"
+
+# Processors filter and rewrite commits, in order.
+# [[processors]]
+# type = "drop-bots"
+`
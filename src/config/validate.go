@@ -0,0 +1,355 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/linkStyle"
+)
+
+// Problem is a setting of a configuration file that is invalid, or has no
+// effect
+type Problem struct {
+	Line   int
+	Column int
+	// Key is the dotted path of the setting, like `trackers.jira.url`
+	Key     string
+	Message string
+	// Ignored is set for settings that have no effect, like unknown keys,
+	// rather than for invalid values
+	Ignored bool
+}
+
+// String describes the problem, like `3:1: section: unknown key`. Problems
+// of YAML and JSON files have no position.
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.Key, p.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", p.Line, p.Column, p.Key, p.Message)
+}
+
+// Check validates the value of a setting. Tables are passed as maps, and
+// arrays of tables as slices of maps.
+type Check func(key string, value interface{}) error
+
+// Checks validate settings by key. The keys of tables with names of their
+// own, like `trackers.jira`, and the elements of arrays of tables are `*`, so
+// `trackers.*` checks each tracker.
+type Checks map[string]Check
+
+// Validate reads a configuration file of the format, one of toml, yaml or
+// json, reporting unknown keys, values of the wrong type, and values the
+// checks reject. Besides the given checks, the values of merges, since,
+// until, link styles, trackers and processors are checked.
+func Validate(r io.Reader, format string, checks Checks) ([]Problem, error) {
+	tree, err := parse(r, format)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not parse configuration")
+	}
+
+	v := &validator{checks: defaultChecks(tree)}
+	for key, check := range checks {
+		v.checks[key] = check
+	}
+	v.walkStruct(tree, "", "", reflect.TypeOf(Config{}))
+
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		if v.problems[i].Line != v.problems[j].Line {
+			return v.problems[i].Line < v.problems[j].Line
+		}
+		return v.problems[i].Column < v.problems[j].Column
+	})
+	return v.problems, nil
+}
+
+// defaultChecks returns the checks of values this package knows about. Link
+// styles may be defined in the file's own `link-styles` table.
+func defaultChecks(tree *toml.Tree) Checks {
+	styles, _ := tree.Get("link-styles").(*toml.Tree)
+	checkStyle := func(key string, value interface{}) error {
+		name, _ := value.(string)
+		if _, ok := linkStyle.Lookup(linkStyle.Style(name)); ok {
+			return nil
+		}
+		if styles != nil && styles.HasPath([]string{name}) {
+			return nil
+		}
+		return fmt.Errorf("link style %s not found, must be one of %s or a style from the link-styles table", name, linkStyle.SupportedStyles())
+	}
+	checkTime := func(key string, value interface{}) error {
+		if _, err := time.Parse(time.RFC3339, value.(string)); err != nil {
+			return fmt.Errorf("%q is not an RFC3339 time, like '2017-08-01T00:00:00Z'", value)
+		}
+		return nil
+	}
+
+	return Checks{
+		"merges": func(key string, value interface{}) error {
+			for _, policy := range changelog.MergePolicies {
+				if value == string(policy) {
+					return nil
+				}
+			}
+			policies := []string{}
+			for _, policy := range changelog.MergePolicies {
+				policies = append(policies, string(policy))
+			}
+			return fmt.Errorf("merge policy %s not found, must be one of %s", value, strings.Join(policies, ", "))
+		},
+		"since":      checkTime,
+		"until":      checkTime,
+		"link-style": checkStyle,
+		"hosts.*":    checkStyle,
+		"trackers.*": func(key string, value interface{}) error {
+			tracker := value.(map[string]interface{})
+			pattern, _ := tracker["pattern"].(string)
+			url, _ := tracker["url"].(string)
+			_, err := changelog.NewTracker(key[strings.LastIndex(key, ".")+1:], pattern, url)
+			return err
+		},
+		"processors.*": func(key string, value interface{}) error {
+			options := map[string]interface{}{}
+			for k, v := range value.(map[string]interface{}) {
+				options[k] = v
+			}
+			name, _ := options["type"].(string)
+			if name == "" {
+				return fmt.Errorf("processor has no type, must be one of %s", changelog.SupportedProcessors())
+			}
+			delete(options, "type")
+			_, err := changelog.NewProcessor(name, options)
+			return err
+		},
+	}
+}
+
+type validator struct {
+	checks   Checks
+	problems []Problem
+}
+
+func (v *validator) report(pos toml.Position, key string, ignored bool, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{
+		Line:    pos.Line,
+		Column:  pos.Col,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+		Ignored: ignored,
+	})
+}
+
+// walkStruct validates each key of a table against the fields of a struct.
+// path is the dotted path of the table, and pattern the key of its checks.
+func (v *validator) walkStruct(tree *toml.Tree, path, pattern string, t reflect.Type) {
+	fields := map[string]reflect.StructField{}
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("mapstructure")
+		fields[name] = t.Field(i)
+		names = append(names, name)
+	}
+
+	for _, key := range sortedKeys(tree) {
+		field, ok := fields[key]
+		if !ok {
+			message := "unknown key"
+			if suggestion := suggest(key, names); suggestion != "" {
+				message += fmt.Sprintf(", did you mean %s?", suggestion)
+			}
+			v.report(tree.GetPositionPath([]string{key}), join(path, key), true, "%s", message)
+			continue
+		}
+		v.walkValue(tree, key, join(path, key), join(pattern, key), field.Type, field.Tag.Get("config"))
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// walkValue validates the value of a key of a table against the type of the
+// field it is read into
+func (v *validator) walkValue(parent *toml.Tree, key, path, pattern string, t reflect.Type, options string) {
+	value := parent.GetPath([]string{key})
+	pos := parent.GetPositionPath([]string{key})
+	mismatch := func(expected string) {
+		v.report(pos, path, false, "expected %s, got %s", expected, describe(value))
+	}
+
+	switch {
+	case t == durationType:
+		switch d := value.(type) {
+		case int64:
+		case string:
+			if _, err := time.ParseDuration(d); err != nil {
+				v.report(pos, path, false, "%q is not a duration, like '30s' or '5m'", d)
+				return
+			}
+		default:
+			mismatch("a duration")
+			return
+		}
+	case t.Kind() == reflect.String:
+		if _, ok := value.(string); !ok {
+			mismatch("a string")
+			return
+		}
+	case t.Kind() == reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			mismatch("true or false")
+			return
+		}
+	case t.Kind() == reflect.Int:
+		if _, ok := value.(int64); !ok {
+			mismatch("an integer")
+			return
+		}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		if !isStrings(value) {
+			mismatch("an array of strings")
+			return
+		}
+	case t.Kind() == reflect.Slice:
+		elements, ok := value.([]*toml.Tree)
+		if !ok {
+			mismatch("an array of tables")
+			return
+		}
+		for i, element := range elements {
+			if check, ok := v.checks[pattern+".*"]; ok {
+				if err := check(fmt.Sprintf("%s.%d", path, i), element.ToMap()); err != nil {
+					v.report(element.Position(), fmt.Sprintf("%s[%d]", path, i), false, "%s", err)
+				}
+			}
+		}
+		return
+	case t.Kind() == reflect.Map:
+		table, ok := value.(*toml.Tree)
+		if !ok {
+			mismatch("a table")
+			return
+		}
+		for _, k := range sortedKeys(table) {
+			if options == "lowercase" && k != strings.ToLower(k) {
+				v.report(table.GetPositionPath([]string{k}), join(path, k), true, "is read as %q, write it in lowercase", strings.ToLower(k))
+			}
+			v.walkValue(table, k, join(path, k), join(pattern, "*"), t.Elem(), "")
+		}
+	case t.Kind() == reflect.Struct:
+		table, ok := value.(*toml.Tree)
+		if !ok {
+			mismatch("a table")
+			return
+		}
+		v.walkStruct(table, path, pattern, t)
+	}
+
+	// Empty strings leave settings unset
+	if value == "" {
+		return
+	}
+	if check, ok := v.checks[pattern]; ok {
+		if tree, ok := value.(*toml.Tree); ok {
+			value = tree.ToMap()
+		}
+		if err := check(path, value); err != nil {
+			v.report(pos, path, false, "%s", err)
+		}
+	}
+}
+
+// sortedKeys returns the keys of a table in order, so problems without a
+// position are reported in the same order every time
+func sortedKeys(tree *toml.Tree) []string {
+	keys := tree.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// isStrings reports whether the value is a string or an array of strings.
+// Strings are split on whitespace where arrays are expected.
+func isStrings(value interface{}) bool {
+	switch values := value.(type) {
+	case string:
+		return true
+	case []interface{}:
+		for _, v := range values {
+			if _, ok := v.(string); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// describe names the type of a value parsed from the file
+func describe(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", value)
+	case *toml.Tree:
+		return "a table"
+	case []*toml.Tree:
+		return "an array of tables"
+	case []interface{}:
+		return "an array"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// suggest returns the name closest to the unknown key, if any is close enough
+// to be a typo
+func suggest(key string, names []string) string {
+	best, bestDistance := "", 3
+	for _, name := range names {
+		if d := distance(strings.ToLower(key), name); d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance between two strings
+func distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
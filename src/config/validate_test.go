@@ -0,0 +1,181 @@
+package config_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skuid/changelog/src/config"
+)
+
+const invalid = `provider = "gitlub"
+from-latest-tag = "yes"
+timeout = "3 minutes"
+since = ""
+
+[section]
+docs = ["docs"]
+
+[sections]
+Documentation = ["docs"]
+cleanup = "clean"
+
+[trackers.jira]
+pattern = '('
+url = "https://example.atlassian.net/browse/{key}"
+uri = "x"
+
+[hosts]
+"git.example.com" = "gitlub"
+"cgit.example.com" = "mine"
+
+[link-styles.mine]
+commit = "{repo}/commit/?id={hash}"
+
+[[processors]]
+type = "drop-bot"
+
+[[processors]]
+type = "redact"
+patterns = ["secret"]
+`
+
+func TestValidate(t *testing.T) {
+	checks := config.Checks{
+		"provider": func(key string, value interface{}) error {
+			if value != "github" {
+				return errors.New("not github")
+			}
+			return nil
+		},
+	}
+	problems, err := config.Validate(strings.NewReader(invalid), "toml", checks)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	got := []string{}
+	for _, problem := range problems {
+		got = append(got, problem.String())
+	}
+	want := []string{
+		"1:1: provider: not github",
+		`2:1: from-latest-tag: expected true or false, got "yes"`,
+		`3:1: timeout: "3 minutes" is not a duration, like '30s' or '5m'`,
+		"6:1: section: unknown key, did you mean sections?",
+		`10:1: sections.Documentation: is read as "documentation", write it in lowercase`,
+		"13:1: trackers.jira: Invalid pattern for tracker jira: error parsing regexp: missing closing ): `(`",
+		"16:1: trackers.jira.uri: unknown key, did you mean url?",
+		"19:1: hosts.git.example.com: link style gitlub not found, must be one of azure-devops, bitbucket, bitbucket-server, cgit, forgejo, gitea, github, gitlab, sourcehut, stash or a style from the link-styles table",
+		"25:1: processors[0]: Processor drop-bot not found! Must be one of author, components, drop-bots, path, redact, regex, rewrite",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected problems\n\t%s\ngot\n\t%s", strings.Join(want, "\n\t"), strings.Join(got, "\n\t"))
+	}
+
+	for _, problem := range problems {
+		ignored := problem.Key == "section" || problem.Key == "trackers.jira.uri" || problem.Key == "sections.Documentation"
+		if problem.Ignored != ignored {
+			t.Errorf("%s: expected ignored to be %t", problem, ignored)
+		}
+	}
+}
+
+func TestValidateSyntax(t *testing.T) {
+	_, err := config.Validate(strings.NewReader("[sections\n"), "toml", nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "Could not parse configuration") {
+		t.Errorf("Expected a parse error, got %v", err)
+	}
+}
+
+func TestValidateFormats(t *testing.T) {
+	cases := []struct {
+		format   string
+		contents string
+	}{
+		{"yaml", `
+from-latest-tag: yes
+port: 8080
+section:
+  docs: [docs]
+sections:
+  Documentation: [docs]
+processors:
+  - type: redact
+    patterns: [secret]
+  - type: drop-bot
+`},
+		{"json", `{
+  "from-latest-tag": true,
+  "port": 8080,
+  "section": {"docs": ["docs"]},
+  "sections": {"Documentation": ["docs"]},
+  "processors": [
+    {"type": "redact", "patterns": ["secret"]},
+    {"type": "drop-bot"}
+  ]
+}`},
+	}
+	want := []string{
+		`processors[1]: Processor drop-bot not found! Must be one of author, components, drop-bots, path, redact, regex, rewrite`,
+		"section: unknown key, did you mean sections?",
+		`sections.Documentation: is read as "documentation", write it in lowercase`,
+	}
+	for _, c := range cases {
+		problems, err := config.Validate(strings.NewReader(c.contents), c.format, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", c.format, err)
+		}
+		got := []string{}
+		for _, problem := range problems {
+			got = append(got, problem.String())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected problems\n\t%s\ngot\n\t%s", c.format, strings.Join(want, "\n\t"), strings.Join(got, "\n\t"))
+		}
+	}
+
+	if _, err := config.Validate(strings.NewReader("[1, 2]"), "json", nil); err == nil {
+		t.Error("Expected an error for a configuration that isn't a table")
+	}
+}
+
+func TestStarter(t *testing.T) {
+	problems, err := config.Validate(strings.NewReader(config.Starter), "toml", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("Expected the starter file to be valid, got %v", problems)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	c, err := config.Decode(map[string]interface{}{
+		"provider": "github",
+		"timeout":  "30s",
+		"path":     []interface{}{"docs"},
+		"sections": map[string]interface{}{"documentation": []interface{}{"docs"}},
+		"trackers": map[string]interface{}{
+			"jira": map[string]interface{}{"pattern": "PLAT-\\d+", "url": "https://example.com/{key}"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	want := &config.Config{
+		Provider: "github",
+		Timeout:  30 * time.Second,
+		Path:     []string{"docs"},
+		Sections: map[string][]string{"documentation": {"docs"}},
+		Trackers: map[string]config.Tracker{"jira": {Pattern: "PLAT-\\d+", URL: "https://example.com/{key}"}},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Expected %+v, got %+v", want, c)
+	}
+	if keys := config.Keys(); keys[0] != "provider" || keys[len(keys)-1] != "processors" {
+		t.Errorf("Expected the keys in the order of Config's fields, got %v", keys)
+	}
+}
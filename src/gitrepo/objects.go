@@ -0,0 +1,257 @@
+package gitrepo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Hash is the SHA-1 name of a git object
+type Hash [20]byte
+
+// NewHash parses a 40 character hexadecimal object name
+func NewHash(s string) (Hash, error) {
+	var h Hash
+	if len(s) != 40 {
+		return h, errors.Errorf("invalid object name %q", s)
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return h, errors.Wrapf(err, "invalid object name %q", s)
+	}
+	return h, nil
+}
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// ObjectType is the type of a git object
+type ObjectType int
+
+// Object types, numbered the same as in packfiles
+const (
+	CommitObject ObjectType = 1
+	TreeObject   ObjectType = 2
+	BlobObject   ObjectType = 3
+	TagObject    ObjectType = 4
+)
+
+var objectTypeNames = map[ObjectType]string{
+	CommitObject: "commit",
+	TreeObject:   "tree",
+	BlobObject:   "blob",
+	TagObject:    "tag",
+}
+
+func (t ObjectType) String() string {
+	return objectTypeNames[t]
+}
+
+func parseObjectType(name string) (ObjectType, error) {
+	for t, typeName := range objectTypeNames {
+		if typeName == name {
+			return t, nil
+		}
+	}
+	return 0, errors.Errorf("unknown object type %q", name)
+}
+
+// Signature is the author, committer or tagger of an object
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// parseSignature parses `Name <email> 1500000000 -0700`
+func parseSignature(line string) Signature {
+	var sig Signature
+	open := strings.Index(line, "<")
+	close := strings.LastIndex(line, ">")
+	if open < 0 || close < open {
+		sig.Name = strings.TrimSpace(line)
+		return sig
+	}
+	sig.Name = strings.TrimSpace(line[:open])
+	sig.Email = line[open+1 : close]
+
+	fields := strings.Fields(line[close+1:])
+	if len(fields) == 0 {
+		return sig
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return sig
+	}
+	location := time.UTC
+	if len(fields) > 1 && len(fields[1]) == 5 {
+		hours, _ := strconv.Atoi(fields[1][1:3])
+		minutes, _ := strconv.Atoi(fields[1][3:5])
+		offset := hours*3600 + minutes*60
+		if fields[1][0] == '-' {
+			offset = -offset
+		}
+		location = time.FixedZone(fields[1], offset)
+	}
+	sig.When = time.Unix(seconds, 0).In(location)
+	return sig
+}
+
+// splitHeaders splits a commit or tag into its header lines and message
+func splitHeaders(data []byte) ([]string, string) {
+	end := bytes.Index(data, []byte("\n\n"))
+	if end < 0 {
+		return strings.Split(strings.TrimRight(string(data), "\n"), "\n"), ""
+	}
+	return strings.Split(string(data[:end]), "\n"), string(data[end+2:])
+}
+
+// Commit is a parsed commit object
+type Commit struct {
+	Hash      Hash
+	Tree      Hash
+	Parents   []Hash
+	Author    Signature
+	Committer Signature
+	Message   string
+}
+
+// ParseCommit parses the contents of a commit object
+func ParseCommit(hash Hash, data []byte) (*Commit, error) {
+	headers, message := splitHeaders(data)
+	c := &Commit{Hash: hash, Message: message}
+	for _, header := range headers {
+		if strings.HasPrefix(header, " ") {
+			// continuation of a multi-line header like gpgsig
+			continue
+		}
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		switch parts[0] {
+		case "tree":
+			tree, err := NewHash(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			c.Tree = tree
+		case "parent":
+			parent, err := NewHash(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			c.Parents = append(c.Parents, parent)
+		case "author":
+			c.Author = parseSignature(parts[1])
+		case "committer":
+			c.Committer = parseSignature(parts[1])
+		}
+	}
+	return c, nil
+}
+
+// Subject returns the first paragraph of the message joined into one line,
+// the same as `git log --format=%s`
+func (c *Commit) Subject() string {
+	subject, _ := c.split()
+	return subject
+}
+
+// Body returns the message after the subject, the same as
+// `git log --format=%b`
+func (c *Commit) Body() string {
+	_, body := c.split()
+	return body
+}
+
+func (c *Commit) split() (string, string) {
+	message := strings.TrimLeft(c.Message, "\n")
+	paragraphs := strings.SplitN(message, "\n\n", 2)
+	subject := strings.Join(strings.Fields(strings.Replace(paragraphs[0], "\n", " ", -1)), " ")
+	if len(paragraphs) < 2 {
+		return subject, ""
+	}
+	return subject, strings.TrimLeft(paragraphs[1], "\n")
+}
+
+// Tag is a parsed annotated tag object
+type Tag struct {
+	Hash       Hash
+	Object     Hash
+	ObjectType ObjectType
+	Name       string
+	Tagger     Signature
+	Message    string
+}
+
+// ParseTag parses the contents of an annotated tag object
+func ParseTag(hash Hash, data []byte) (*Tag, error) {
+	headers, message := splitHeaders(data)
+	t := &Tag{Hash: hash, Message: message}
+	for _, header := range headers {
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		switch parts[0] {
+		case "object":
+			object, err := NewHash(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			t.Object = object
+		case "type":
+			objectType, err := parseObjectType(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			t.ObjectType = objectType
+		case "tag":
+			t.Name = parts[1]
+		case "tagger":
+			t.Tagger = parseSignature(parts[1])
+		}
+	}
+	return t, nil
+}
+
+// TreeEntry is a single file or directory in a tree
+type TreeEntry struct {
+	Mode string
+	Name string
+	Hash Hash
+}
+
+// IsTree reports whether the entry is a directory
+func (e TreeEntry) IsTree() bool {
+	return e.Mode == "40000"
+}
+
+// ParseTree parses the contents of a tree object
+func ParseTree(data []byte) ([]TreeEntry, error) {
+	entries := []TreeEntry{}
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		if space < 0 {
+			return nil, errors.New("malformed tree entry mode")
+		}
+		null := bytes.IndexByte(data[space:], 0)
+		if null < 0 || space+null+21 > len(data) {
+			return nil, errors.New("malformed tree entry name")
+		}
+		null += space
+		entry := TreeEntry{
+			Mode: string(data[:space]),
+			Name: string(data[space+1 : null]),
+		}
+		copy(entry.Hash[:], data[null+1:null+21])
+		entries = append(entries, entry)
+		data = data[null+21:]
+	}
+	return entries, nil
+}
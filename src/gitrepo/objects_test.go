@@ -0,0 +1,80 @@
+package gitrepo
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseCommit(t *testing.T) {
+	data := []byte("tree 9c4a7bbf0f4a8ca3d8e4a1a3e0d3cf1d2a0a2b3c\n" +
+		"parent 1111111111111111111111111111111111111111\n" +
+		"parent 2222222222222222222222222222222222222222\n" +
+		"author Jane Doe <jane@example.com> 1501592400 -0700\n" +
+		"committer John Doe <john@example.com> 1501596000 +0130\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n" +
+		" abc\n" +
+		" -----END PGP SIGNATURE-----\n" +
+		"\n" +
+		"feat(core): a subject\nthat wraps\n\nThe body\n\nCloses #3\n")
+
+	c, err := ParseCommit(Hash{}, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(c.Parents) != 2 || c.Parents[1].String() != "2222222222222222222222222222222222222222" {
+		t.Errorf("Unexpected parents %v", c.Parents)
+	}
+	if c.Author.Name != "Jane Doe" || c.Author.Email != "jane@example.com" {
+		t.Errorf("Unexpected author %+v", c.Author)
+	}
+	if !c.Author.When.Equal(time.Unix(1501592400, 0)) {
+		t.Errorf("Unexpected author date %s", c.Author.When)
+	}
+	if _, offset := c.Committer.When.Zone(); offset != 90*60 {
+		t.Errorf("Unexpected committer zone offset %d", offset)
+	}
+	if got := c.Subject(); got != "feat(core): a subject that wraps" {
+		t.Errorf("Unexpected subject %q", got)
+	}
+	if got := c.Body(); got != "The body\n\nCloses #3\n" {
+		t.Errorf("Unexpected body %q", got)
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	var data bytes.Buffer
+	data.WriteString("100644 README.md\x00")
+	data.Write(bytes.Repeat([]byte{0xab}, 20))
+	data.WriteString("40000 src\x00")
+	data.Write(bytes.Repeat([]byte{0xcd}, 20))
+
+	entries, err := ParseTree(data.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "README.md" || entries[0].IsTree() || !entries[1].IsTree() {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+	if _, err := ParseTree(data.Bytes()[:30]); err == nil {
+		t.Error("Expected an error for a truncated tree")
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("hello, world")
+	delta := []byte{
+		12,         // base size
+		13,         // result size
+		0x91, 0, 5, // copy 5 bytes from offset 0
+		3, ' ', 'a', 'n', // insert " an"
+		0x91, 5, 5, // copy 5 bytes from offset 5
+	}
+	got, err := applyDelta(base, delta)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if string(got) != "hello an, wor" {
+		t.Errorf("Unexpected result %q", got)
+	}
+}
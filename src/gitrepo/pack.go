@@ -0,0 +1,274 @@
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ofsDeltaObject = 6
+	refDeltaObject = 7
+)
+
+// pack is a packfile along with its version 2 index
+type pack struct {
+	path    string
+	file    *os.File
+	hashes  []Hash
+	offsets []int64
+
+	// cache holds recently resolved objects by offset so long delta chains
+	// don't get inflated over and over
+	cache map[int64]cachedObject
+}
+
+type cachedObject struct {
+	objectType ObjectType
+	data       []byte
+}
+
+const maxCachedObjects = 256
+
+// openPack reads the index for a `.pack` file. The index is held in memory,
+// objects are read from the pack on demand.
+func openPack(path string) (*pack, error) {
+	idx, err := ioutil.ReadFile(strings.TrimSuffix(path, ".pack") + ".idx")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading pack index")
+	}
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) {
+		return nil, errors.Errorf("unsupported pack index for %s", path)
+	}
+	if version := binary.BigEndian.Uint32(idx[4:8]); version != 2 {
+		return nil, errors.Errorf("unsupported pack index version %d for %s", version, path)
+	}
+
+	count := int(binary.BigEndian.Uint32(idx[8+255*4:]))
+	hashStart := 8 + 256*4
+	offsetStart := hashStart + count*20 + count*4
+	largeStart := offsetStart + count*4
+	if len(idx) < largeStart {
+		return nil, errors.Errorf("truncated pack index for %s", path)
+	}
+
+	p := &pack{
+		path:    path,
+		hashes:  make([]Hash, count),
+		offsets: make([]int64, count),
+		cache:   map[int64]cachedObject{},
+	}
+	for i := 0; i < count; i++ {
+		copy(p.hashes[i][:], idx[hashStart+i*20:])
+		offset := binary.BigEndian.Uint32(idx[offsetStart+i*4:])
+		if offset&0x80000000 != 0 {
+			large := largeStart + int(offset&0x7fffffff)*8
+			if len(idx) < large+8 {
+				return nil, errors.Errorf("truncated pack index for %s", path)
+			}
+			p.offsets[i] = int64(binary.BigEndian.Uint64(idx[large:]))
+		} else {
+			p.offsets[i] = int64(offset)
+		}
+	}
+
+	p.file, err = os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error opening pack")
+	}
+	return p, nil
+}
+
+// find returns the offset of an object in the pack
+func (p *pack) find(hash Hash) (int64, bool) {
+	i := sort.Search(len(p.hashes), func(i int) bool {
+		return bytes.Compare(p.hashes[i][:], hash[:]) >= 0
+	})
+	if i < len(p.hashes) && p.hashes[i] == hash {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// withPrefix returns every object in the pack whose name starts with prefix
+func (p *pack) withPrefix(prefix string) []Hash {
+	i := sort.Search(len(p.hashes), func(i int) bool {
+		return p.hashes[i].String() >= prefix
+	})
+	matches := []Hash{}
+	for ; i < len(p.hashes) && strings.HasPrefix(p.hashes[i].String(), prefix); i++ {
+		matches = append(matches, p.hashes[i])
+	}
+	return matches
+}
+
+// read returns the fully resolved type and contents of the object at offset.
+// Delta bases in other packs or loose objects are looked up through repo.
+func (p *pack) read(repo *Repository, offset int64) (ObjectType, []byte, error) {
+	if cached, ok := p.cache[offset]; ok {
+		return cached.objectType, cached.data, nil
+	}
+	objectType, data, err := p.readUncached(repo, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(p.cache) >= maxCachedObjects {
+		p.cache = map[int64]cachedObject{}
+	}
+	p.cache[offset] = cachedObject{objectType, data}
+	return objectType, data, nil
+}
+
+func (p *pack) readUncached(repo *Repository, offset int64) (ObjectType, []byte, error) {
+	r := bufio.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "Error reading pack object header")
+	}
+	objectType := ObjectType((b >> 4) & 7)
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, nil, errors.Wrap(err, "Error reading pack object header")
+		}
+	}
+
+	var baseType ObjectType
+	var base []byte
+	switch objectType {
+	case ofsDeltaObject:
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "Error reading delta offset")
+		}
+		distance := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = r.ReadByte(); err != nil {
+				return 0, nil, errors.Wrap(err, "Error reading delta offset")
+			}
+			distance = ((distance + 1) << 7) | int64(b&0x7f)
+		}
+		baseType, base, err = p.read(repo, offset-distance)
+		if err != nil {
+			return 0, nil, err
+		}
+	case refDeltaObject:
+		var baseHash Hash
+		if _, err := io.ReadFull(r, baseHash[:]); err != nil {
+			return 0, nil, errors.Wrap(err, "Error reading delta base")
+		}
+		baseType, base, err = repo.readObject(baseHash)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	z, err := zlib.NewReader(r)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "Error inflating pack object")
+	}
+	data, err := ioutil.ReadAll(z)
+	z.Close()
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "Error inflating pack object")
+	}
+
+	if base == nil {
+		return objectType, data, nil
+	}
+	data, err = applyDelta(base, data)
+	return baseType, data, err
+}
+
+func (p *pack) Close() error {
+	return p.file.Close()
+}
+
+// readVarint reads the little-endian size encoding used in delta headers
+func readVarint(delta []byte) (int, []byte, error) {
+	size, shift := 0, uint(0)
+	for {
+		if len(delta) == 0 {
+			return 0, nil, errors.New("truncated delta header")
+		}
+		b := delta[0]
+		delta = delta[1:]
+		size |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return size, delta, nil
+		}
+	}
+}
+
+// applyDelta rebuilds an object from its base and a packfile delta
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, delta, err := readVarint(delta)
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, errors.New("delta base size mismatch")
+	}
+	resultSize, delta, err := readVarint(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		if op&0x80 == 0 {
+			// insert the next op bytes of the delta
+			n := int(op)
+			if n == 0 || n > len(delta) {
+				return nil, errors.New("invalid delta insert")
+			}
+			result = append(result, delta[:n]...)
+			delta = delta[n:]
+			continue
+		}
+
+		// copy a range of the base
+		var offset, size int
+		for i := uint(0); i < 4; i++ {
+			if op&(1<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta copy")
+				}
+				offset |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		for i := uint(0); i < 3; i++ {
+			if op&(0x10<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, errors.New("truncated delta copy")
+				}
+				size |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > len(base) {
+			return nil, errors.New("delta copy out of range")
+		}
+		result = append(result, base[offset:offset+size]...)
+	}
+
+	if len(result) != resultSize {
+		return nil, errors.New("delta result size mismatch")
+	}
+	return result, nil
+}
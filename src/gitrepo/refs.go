@@ -0,0 +1,256 @@
+package gitrepo
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxSymrefDepth guards against symbolic ref loops
+const maxSymrefDepth = 5
+
+// Refs lists every ref below prefix, e.g. `refs/tags/`, with the object it
+// points to. Loose refs take precedence over packed-refs.
+func (r *Repository) Refs(prefix string) (map[string]Hash, error) {
+	refs, err := r.packedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for name := range refs {
+		if !strings.HasPrefix(name, prefix) {
+			delete(refs, name)
+		}
+	}
+
+	for _, dir := range r.refDirs() {
+		root := filepath.Join(dir, filepath.FromSlash(prefix))
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			if !strings.HasPrefix(name, prefix) {
+				// a prefix like refs/tags/v matches files, not a directory
+				return nil
+			}
+			hash, err := r.Ref(name)
+			if err != nil {
+				return nil
+			}
+			refs[name] = hash
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error listing refs")
+		}
+	}
+	return refs, nil
+}
+
+// refDirs lists the directories loose refs live in
+func (r *Repository) refDirs() []string {
+	if r.CommonDir == r.GitDir {
+		return []string{r.GitDir}
+	}
+	return []string{r.CommonDir, r.GitDir}
+}
+
+func (r *Repository) packedRefs() (map[string]Hash, error) {
+	refs := map[string]Hash{}
+	f, err := os.Open(filepath.Join(r.CommonDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading packed-refs")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		hash, err := NewHash(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		refs[parts[1]] = hash
+	}
+	return refs, errors.Wrap(scanner.Err(), "Error reading packed-refs")
+}
+
+// Ref resolves a fully qualified ref name like HEAD or refs/heads/master,
+// following symbolic refs
+func (r *Repository) Ref(name string) (Hash, error) {
+	for depth := 0; depth < maxSymrefDepth; depth++ {
+		contents, err := r.readLooseRef(name)
+		if os.IsNotExist(err) {
+			packed, err := r.packedRefs()
+			if err != nil {
+				return Hash{}, err
+			}
+			if hash, ok := packed[name]; ok {
+				return hash, nil
+			}
+			return Hash{}, errors.Wrapf(ErrNotFound, "ref %s", name)
+		}
+		if err != nil {
+			return Hash{}, errors.Wrapf(err, "Error reading ref %s", name)
+		}
+		if strings.HasPrefix(contents, "ref: ") {
+			name = strings.TrimPrefix(contents, "ref: ")
+			continue
+		}
+		return NewHash(contents)
+	}
+	return Hash{}, errors.Errorf("too many levels of symbolic refs for %s", name)
+}
+
+func (r *Repository) readLooseRef(name string) (string, error) {
+	dirs := r.refDirs()
+	// HEAD and other pseudo refs belong to the worktree, not the common dir
+	if !strings.HasPrefix(name, "refs/") {
+		dirs = []string{r.GitDir}
+	}
+	var lastErr error
+	for i := len(dirs) - 1; i >= 0; i-- {
+		contents, err := ioutil.ReadFile(filepath.Join(dirs[i], filepath.FromSlash(name)))
+		if err == nil {
+			return strings.TrimSpace(string(contents)), nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+// Head resolves HEAD to a commit
+func (r *Repository) Head() (Hash, error) {
+	return r.Ref("HEAD")
+}
+
+var (
+	hexRegex    = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+	suffixRegex = regexp.MustCompile(`(\^\{\w*\}|\^[0-9]*|~[0-9]*)$`)
+)
+
+// ResolveRevision resolves a revision to a commit the way `git rev-parse`
+// does for the common forms: full or abbreviated object names, HEAD, branch,
+// tag and remote names, and the `^`, `^N`, `~N` and `^{}` suffixes.
+func (r *Repository) ResolveRevision(rev string) (Hash, error) {
+	if suffix := suffixRegex.FindString(rev); suffix != "" && suffix != rev {
+		base, err := r.ResolveRevision(strings.TrimSuffix(rev, suffix))
+		if err != nil {
+			return Hash{}, err
+		}
+		return r.applySuffix(base, suffix)
+	}
+
+	hash, err := r.resolveName(rev)
+	if err != nil {
+		return Hash{}, err
+	}
+	return r.Peel(hash)
+}
+
+func (r *Repository) resolveName(rev string) (Hash, error) {
+	for _, candidate := range []string{
+		rev,
+		"refs/" + rev,
+		"refs/tags/" + rev,
+		"refs/heads/" + rev,
+		"refs/remotes/" + rev,
+		"refs/remotes/" + rev + "/HEAD",
+	} {
+		if candidate == rev && !strings.HasPrefix(rev, "refs/") && strings.ToUpper(rev) != rev {
+			// only HEAD-like pseudo refs resolve without a refs/ prefix
+			continue
+		}
+		hash, err := r.Ref(candidate)
+		if err == nil {
+			return hash, nil
+		}
+		if errors.Cause(err) != ErrNotFound {
+			return Hash{}, err
+		}
+	}
+
+	if hexRegex.MatchString(rev) {
+		if len(rev) == 40 {
+			return NewHash(rev)
+		}
+		matches, err := r.withPrefix(rev)
+		if err != nil {
+			return Hash{}, err
+		}
+		switch len(matches) {
+		case 0:
+		case 1:
+			return matches[0], nil
+		default:
+			return Hash{}, errors.Errorf("short object name %s is ambiguous", rev)
+		}
+	}
+	return Hash{}, errors.Wrapf(ErrNotFound, "revision %s", rev)
+}
+
+func (r *Repository) applySuffix(hash Hash, suffix string) (Hash, error) {
+	switch {
+	case strings.HasPrefix(suffix, "^{"):
+		// the base is already peeled to a commit
+		return hash, nil
+	case strings.HasPrefix(suffix, "^"):
+		n := 1
+		if len(suffix) > 1 {
+			n, _ = strconv.Atoi(suffix[1:])
+		}
+		if n == 0 {
+			return hash, nil
+		}
+		commit, err := r.Commit(hash)
+		if err != nil {
+			return Hash{}, err
+		}
+		if n > len(commit.Parents) {
+			return Hash{}, errors.Errorf("commit %s has no parent %d", hash, n)
+		}
+		return commit.Parents[n-1], nil
+	default:
+		n := 1
+		if len(suffix) > 1 {
+			n, _ = strconv.Atoi(suffix[1:])
+		}
+		for i := 0; i < n; i++ {
+			commit, err := r.Commit(hash)
+			if err != nil {
+				return Hash{}, err
+			}
+			if len(commit.Parents) == 0 {
+				return Hash{}, errors.Errorf("commit %s has no parent", hash)
+			}
+			hash = commit.Parents[0]
+		}
+		return hash, nil
+	}
+}
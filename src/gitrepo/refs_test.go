@@ -0,0 +1,89 @@
+package gitrepo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gitrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com",
+			"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com",
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	git("init", "-q")
+	git("checkout", "-q", "-b", "master")
+	for i := 0; i < 3; i++ {
+		if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte(fmt.Sprint(i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "file")
+		git("commit", "-q", "-m", fmt.Sprintf("commit %d", i))
+	}
+	git("tag", "-a", "-m", "annotated", "v1.0.0")
+	git("tag", "-a", "-m", "nested", "nested", "v1.0.0")
+	git("branch", "other", "HEAD~1")
+	git("update-ref", "refs/remotes/origin/master", "HEAD~2")
+	git("pack-refs", "--all")
+	git("tag", "loose", "HEAD^")
+
+	head := git("rev-parse", "HEAD")
+	revs := []string{
+		"HEAD", "master", "refs/heads/master", "heads/master", "other",
+		"v1.0.0", "nested", "refs/tags/v1.0.0", "v1.0.0^{}", "loose",
+		"origin/master", "HEAD~2", "HEAD^", "HEAD^^", "master~1^0", head, head[:8],
+	}
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer repo.Close()
+	for _, rev := range revs {
+		want := git("rev-parse", rev+"^{commit}")
+		got, err := repo.ResolveRevision(rev)
+		if err != nil {
+			t.Errorf("Unexpected error resolving %s: %s", rev, err)
+			continue
+		}
+		if got.String() != want {
+			t.Errorf("Revision %s not equal!\nExpected\n\t%s\nGot\n\t%s", rev, want, got)
+		}
+	}
+
+	if _, err := repo.ResolveRevision("missing"); err == nil {
+		t.Error("Expected an error for a missing revision")
+	}
+
+	tags, err := repo.Refs("refs/tags/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(tags) != 3 {
+		t.Errorf("Expected 3 tags, got %v", tags)
+	}
+}
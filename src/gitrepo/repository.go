@@ -0,0 +1,347 @@
+// Package gitrepo reads commits, trees, tags and refs straight out of a `.git`
+// directory without shelling out to the git binary. It understands loose
+// objects, version 2 packfiles with offset and reference deltas, loose and
+// packed refs, and annotated tags.
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when an object or ref does not exist
+var ErrNotFound = errors.New("not found")
+
+// Repository is an opened `.git` directory
+type Repository struct {
+	// GitDir is the `.git` directory
+	GitDir string
+	// CommonDir holds objects and shared refs. It differs from GitDir for
+	// linked worktrees.
+	CommonDir string
+
+	packs []*pack
+}
+
+// Open opens a repository from either its work tree or its `.git` directory
+func Open(path string) (*Repository, error) {
+	gitDir, err := findGitDir(path)
+	if err != nil {
+		return nil, err
+	}
+	repo := &Repository{GitDir: gitDir, CommonDir: gitDir}
+
+	if common, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		dir := strings.TrimSpace(string(common))
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(gitDir, dir)
+		}
+		repo.CommonDir = dir
+	}
+
+	packFiles, err := filepath.Glob(filepath.Join(repo.CommonDir, "objects", "pack", "*.pack"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing packs")
+	}
+	for _, packFile := range packFiles {
+		p, err := openPack(packFile)
+		if err != nil {
+			repo.Close()
+			return nil, err
+		}
+		repo.packs = append(repo.packs, p)
+	}
+	return repo, nil
+}
+
+// Discover opens the repository containing path, looking in each parent
+// directory in turn like git does
+func Discover(path string) (*Repository, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return Open(dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return Open(path)
+		}
+		dir = parent
+	}
+}
+
+// WorkTree returns the directory checked out for the repository, or the
+// directory holding the repository if it is bare
+func (r *Repository) WorkTree() string {
+	if filepath.Base(r.GitDir) == ".git" {
+		return filepath.Dir(r.GitDir)
+	}
+	return r.GitDir
+}
+
+// findGitDir resolves a work tree, a `.git` file pointing elsewhere, or a bare
+// repository to the directory holding HEAD
+func findGitDir(path string) (string, error) {
+	dotGit := filepath.Join(path, ".git")
+	info, err := os.Stat(dotGit)
+	switch {
+	case err == nil && info.IsDir():
+		return dotGit, nil
+	case err == nil:
+		contents, err := ioutil.ReadFile(dotGit)
+		if err != nil {
+			return "", errors.Wrap(err, "Error reading .git file")
+		}
+		line := strings.TrimSpace(string(contents))
+		if !strings.HasPrefix(line, "gitdir: ") {
+			return "", errors.Errorf("invalid .git file in %s", path)
+		}
+		dir := strings.TrimPrefix(line, "gitdir: ")
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(path, dir)
+		}
+		return dir, nil
+	}
+	if _, err := os.Stat(filepath.Join(path, "HEAD")); err != nil {
+		return "", errors.Errorf("%s is not a git repository", path)
+	}
+	return path, nil
+}
+
+// Close releases the open packfiles
+func (r *Repository) Close() error {
+	var firstErr error
+	for _, p := range r.packs {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	r.packs = nil
+	return firstErr
+}
+
+// readObject returns the type and contents of any object
+func (r *Repository) readObject(hash Hash) (ObjectType, []byte, error) {
+	for _, p := range r.packs {
+		if offset, ok := p.find(hash); ok {
+			return p.read(r, offset)
+		}
+	}
+	return r.readLooseObject(hash)
+}
+
+func (r *Repository) looseObjectPath(hash Hash) string {
+	name := hash.String()
+	return filepath.Join(r.CommonDir, "objects", name[:2], name[2:])
+}
+
+func (r *Repository) readLooseObject(hash Hash) (ObjectType, []byte, error) {
+	f, err := os.Open(r.looseObjectPath(hash))
+	if os.IsNotExist(err) {
+		return 0, nil, errors.Wrapf(ErrNotFound, "object %s", hash)
+	}
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "Error opening object")
+	}
+	defer f.Close()
+
+	z, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "Error inflating object %s", hash)
+	}
+	defer z.Close()
+	raw, err := ioutil.ReadAll(z)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "Error inflating object %s", hash)
+	}
+
+	null := bytes.IndexByte(raw, 0)
+	if null < 0 {
+		return 0, nil, errors.Errorf("malformed object %s", hash)
+	}
+	header := strings.SplitN(string(raw[:null]), " ", 2)
+	objectType, err := parseObjectType(header[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return objectType, raw[null+1:], nil
+}
+
+// readTyped reads an object and checks it has the expected type
+func (r *Repository) readTyped(hash Hash, expected ObjectType) ([]byte, error) {
+	objectType, data, err := r.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != expected {
+		return nil, errors.Errorf("object %s is a %s, not a %s", hash, objectType, expected)
+	}
+	return data, nil
+}
+
+// Commit reads a commit object
+func (r *Repository) Commit(hash Hash) (*Commit, error) {
+	data, err := r.readTyped(hash, CommitObject)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCommit(hash, data)
+}
+
+// Tag reads an annotated tag object
+func (r *Repository) Tag(hash Hash) (*Tag, error) {
+	data, err := r.readTyped(hash, TagObject)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTag(hash, data)
+}
+
+// Tree reads a tree object
+func (r *Repository) Tree(hash Hash) ([]TreeEntry, error) {
+	data, err := r.readTyped(hash, TreeObject)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTree(data)
+}
+
+// Blob reads a blob object
+func (r *Repository) Blob(hash Hash) ([]byte, error) {
+	return r.readTyped(hash, BlobObject)
+}
+
+// TreeEntry finds the entry for a slash separated path below a tree. The
+// second return value is false when the path does not exist.
+func (r *Repository) TreeEntry(tree Hash, path string) (TreeEntry, bool, error) {
+	entry := TreeEntry{Mode: "40000", Hash: tree}
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		if !entry.IsTree() {
+			return TreeEntry{}, false, nil
+		}
+		entries, err := r.Tree(entry.Hash)
+		if err != nil {
+			return TreeEntry{}, false, err
+		}
+		found := false
+		for _, e := range entries {
+			if e.Name == name {
+				entry, found = e, true
+				break
+			}
+		}
+		if !found {
+			return TreeEntry{}, false, nil
+		}
+	}
+	return entry, true, nil
+}
+
+// Peel follows annotated tags until it reaches a commit
+func (r *Repository) Peel(hash Hash) (Hash, error) {
+	for {
+		objectType, data, err := r.readObject(hash)
+		if err != nil {
+			return hash, err
+		}
+		if objectType == CommitObject {
+			return hash, nil
+		}
+		if objectType != TagObject {
+			return hash, errors.Errorf("object %s is a %s, not a commit", hash, objectType)
+		}
+		tag, err := ParseTag(hash, data)
+		if err != nil {
+			return hash, err
+		}
+		hash = tag.Object
+	}
+}
+
+// ObjectType returns the type of an object without parsing it
+func (r *Repository) ObjectType(hash Hash) (ObjectType, error) {
+	objectType, _, err := r.readObject(hash)
+	return objectType, err
+}
+
+// withPrefix returns every object whose name starts with the hex prefix
+func (r *Repository) withPrefix(prefix string) ([]Hash, error) {
+	seen := map[Hash]bool{}
+	matches := []Hash{}
+	for _, p := range r.packs {
+		for _, h := range p.withPrefix(prefix) {
+			if !seen[h] {
+				seen[h] = true
+				matches = append(matches, h)
+			}
+		}
+	}
+	files, err := ioutil.ReadDir(filepath.Join(r.CommonDir, "objects", prefix[:2]))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "Error listing objects")
+	}
+	for _, f := range files {
+		name := prefix[:2] + f.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		h, err := NewHash(name)
+		if err != nil {
+			continue
+		}
+		if !seen[h] {
+			seen[h] = true
+			matches = append(matches, h)
+		}
+	}
+	return matches, nil
+}
+
+// RemoteURL reads the url of a remote from the repository config
+func (r *Repository) RemoteURL(remote string) (string, error) {
+	f, err := os.Open(filepath.Join(r.CommonDir, "config"))
+	if err != nil {
+		return "", errors.Wrap(err, "Error reading git config")
+	}
+	defer f.Close()
+
+	section := `[remote "` + remote + `"]`
+	inSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inSection = strings.Replace(line, "\t", " ", -1) == section
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == "url" {
+			value := strings.TrimSpace(parts[1])
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			return value, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", errors.Wrap(err, "Error reading git config")
+	}
+	return "", errors.Wrapf(ErrNotFound, "remote %s", remote)
+}
@@ -0,0 +1,239 @@
+package gitrepo
+
+import (
+	"container/heap"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStopWalk can be returned from a WalkFunc to end a walk early without
+// failing it
+var ErrStopWalk = errors.New("stop walk")
+
+// WalkFunc is called for each commit visited by Walk
+type WalkFunc func(c *Commit) error
+
+// Walk visits every commit reachable from include but not from exclude, newest
+// committer date first, the same order as a plain `git log`
+func (r *Repository) Walk(include, exclude []Hash, fn WalkFunc) error {
+	if len(exclude) == 0 {
+		return r.walkAll(include, fn)
+	}
+	commits, err := r.limit(include, exclude)
+	if err != nil {
+		return err
+	}
+	for _, commit := range commits {
+		if err := fn(commit); err != nil {
+			if err == ErrStopWalk {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// walkAll visits every commit reachable from include as it's read
+func (r *Repository) walkAll(include []Hash, fn WalkFunc) error {
+	queue := &commitQueue{}
+	seen := map[Hash]bool{}
+	push := func(hash Hash) error {
+		if seen[hash] {
+			return nil
+		}
+		seen[hash] = true
+		commit, err := r.Commit(hash)
+		if err != nil {
+			return err
+		}
+		queue.push(&walkNode{Commit: commit})
+		return nil
+	}
+
+	for _, hash := range include {
+		if err := push(hash); err != nil {
+			return err
+		}
+	}
+	for queue.Len() > 0 {
+		commit := heap.Pop(queue).(*walkNode).Commit
+		if err := fn(commit); err != nil {
+			if err == ErrStopWalk {
+				return nil
+			}
+			return err
+		}
+		for _, parent := range commit.Parents {
+			if err := push(parent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkSlop is how many commits are read after every queued commit is hidden,
+// to catch commits whose committer dates are older than their parents'. git
+// uses the same allowance.
+const walkSlop = 5
+
+// limit returns the commits reachable from include but not from exclude,
+// newest first. Like git, commits from both sides share one queue ordered by
+// committer date, and commits reached from exclude hide their parents in
+// turn. The walk stops once every queued commit is hidden, so only the
+// history down to where the two sides meet is read.
+func (r *Repository) limit(include, exclude []Hash) ([]*Commit, error) {
+	queue := &commitQueue{}
+	nodes := map[Hash]*walkNode{}
+	interesting := 0
+
+	// hide marks a commit hidden, and the parents of hidden commits that have
+	// already been walked
+	var push func(hash Hash, hidden bool) error
+	hide := func(node *walkNode) error {
+		stack := []*walkNode{node}
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if node.hidden {
+				continue
+			}
+			node.hidden = true
+			if !node.walked {
+				interesting--
+				continue
+			}
+			for _, parent := range node.Parents {
+				if existing, ok := nodes[parent]; ok {
+					stack = append(stack, existing)
+				} else if err := push(parent, true); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	push = func(hash Hash, hidden bool) error {
+		if node, ok := nodes[hash]; ok {
+			if hidden {
+				return hide(node)
+			}
+			return nil
+		}
+		commit, err := r.Commit(hash)
+		if err != nil {
+			return err
+		}
+		node := &walkNode{Commit: commit, hidden: hidden}
+		nodes[hash] = node
+		if !hidden {
+			interesting++
+		}
+		queue.push(node)
+		return nil
+	}
+
+	for _, hash := range exclude {
+		if err := push(hash, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, hash := range include {
+		if err := push(hash, false); err != nil {
+			return nil, err
+		}
+	}
+
+	walked := []*walkNode{}
+	slop := walkSlop
+	for queue.Len() > 0 {
+		if interesting == 0 {
+			if slop == 0 {
+				break
+			}
+			slop--
+		}
+		node := heap.Pop(queue).(*walkNode)
+		node.walked = true
+		if !node.hidden {
+			interesting--
+			walked = append(walked, node)
+		}
+		for _, parent := range node.Parents {
+			if err := push(parent, node.hidden); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Commits walked before the hidden side caught up with them are dropped
+	commits := []*Commit{}
+	for _, node := range walked {
+		if !node.hidden {
+			commits = append(commits, node.Commit)
+		}
+	}
+	return commits, nil
+}
+
+// IsAncestor reports whether ancestor is reachable from commit. Only the
+// history between the two is read, by walking from commit with the parents of
+// ancestor hidden.
+func (r *Repository) IsAncestor(ancestor, commit Hash) (bool, error) {
+	if ancestor == commit {
+		return true, nil
+	}
+	a, err := r.Commit(ancestor)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	err = r.Walk([]Hash{commit}, a.Parents, func(c *Commit) error {
+		if c.Hash == ancestor {
+			found = true
+			return ErrStopWalk
+		}
+		return nil
+	})
+	return found, err
+}
+
+// walkNode is a commit queued by a walk
+type walkNode struct {
+	*Commit
+	seq int
+	// hidden is set for commits reachable from the excluded commits
+	hidden bool
+	// walked is set once the commit's parents have been queued
+	walked bool
+}
+
+// commitQueue orders commits by committer date, newest first. Commits with
+// the same date come out in the order they went in, as they do in git.
+type commitQueue struct {
+	items  []*walkNode
+	pushed int
+}
+
+func (q *commitQueue) push(node *walkNode) {
+	node.seq = q.pushed
+	q.pushed++
+	heap.Push(q, node)
+}
+
+func (q *commitQueue) Len() int { return len(q.items) }
+func (q *commitQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if !a.Committer.When.Equal(b.Committer.When) {
+		return a.Committer.When.After(b.Committer.When)
+	}
+	return a.seq < b.seq
+}
+func (q *commitQueue) Swap(i, j int)      { q.items[i], q.items[j] = q.items[j], q.items[i] }
+func (q *commitQueue) Push(x interface{}) { q.items = append(q.items, x.(*walkNode)) }
+func (q *commitQueue) Pop() interface{} {
+	c := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return c
+}
@@ -0,0 +1,136 @@
+package gitrepo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWalk(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gitrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	date := time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC)
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		stamp := fmt.Sprintf("%d +0000", date.Unix())
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com",
+			"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com",
+			"GIT_AUTHOR_DATE="+stamp, "GIT_COMMITTER_DATE="+stamp,
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(message string) {
+		date = date.Add(time.Hour)
+		name := strings.Fields(message)[0] + ".txt"
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(message), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", name)
+		git("commit", "-q", "-m", message)
+	}
+
+	git("init", "-q")
+	git("checkout", "-q", "-b", "master")
+	for i := 0; i < 5; i++ {
+		commit(fmt.Sprintf("master %d", i))
+	}
+	git("tag", "v1", "HEAD~2")
+	git("checkout", "-q", "-b", "feature", "HEAD~3")
+	commit("feature 1")
+	// A commit dated before its parent, like one from a skewed clock
+	date = date.Add(-48 * time.Hour)
+	commit("feature 2")
+	date = date.Add(48 * time.Hour)
+	git("checkout", "-q", "master")
+	git("merge", "-q", "--no-ff", "-m", "merge feature", "feature")
+	commit("master 5")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer repo.Close()
+
+	resolve := func(rev string) Hash {
+		hash, err := repo.ResolveRevision(rev)
+		if err != nil {
+			t.Fatalf("Unexpected error resolving %s: %s", rev, err)
+		}
+		return hash
+	}
+	ranges := [][2]string{
+		{"master", ""},
+		{"master", "v1"},
+		{"master", "feature"},
+		{"feature", "v1"},
+		{"v1", "feature"},
+		{"master", "master"},
+	}
+	for _, r := range ranges {
+		args := []string{"rev-list", r[0]}
+		include := []Hash{resolve(r[0])}
+		exclude := []Hash{}
+		if r[1] != "" {
+			args = append(args, "^"+r[1])
+			exclude = append(exclude, resolve(r[1]))
+		}
+		want := []string{}
+		if out := git(args...); out != "" {
+			want = strings.Split(out, "\n")
+		}
+
+		got := []string{}
+		err := repo.Walk(include, exclude, func(c *Commit) error {
+			got = append(got, c.Hash.String())
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s ^%s: Unexpected error: %s", r[0], r[1], err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s ^%s: Commits not equal!\nExpected\n\t%v\nGot\n\t%v", r[0], r[1], want, got)
+		}
+	}
+
+	ancestors := []struct {
+		ancestor, commit string
+		want             bool
+	}{
+		{"v1", "master", true},
+		{"feature", "master", true},
+		{"feature~1", "feature", true},
+		{"master", "master", true},
+		{"v1", "feature", false},
+		{"feature", "v1", false},
+		{"master", "v1", false},
+	}
+	for _, c := range ancestors {
+		got, err := repo.IsAncestor(resolve(c.ancestor), resolve(c.commit))
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+		if got != c.want {
+			t.Errorf("Expected %s to be an ancestor of %s to be %t", c.ancestor, c.commit, c.want)
+		}
+	}
+}
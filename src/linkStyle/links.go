@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+
+	"github.com/skuid/changelog/src/remote"
 )
 
 // Style is type for generating issue and commit links
@@ -16,65 +18,275 @@ const (
 	Gitlab Style = "gitlab"
 	// Stash is for stash links
 	Stash Style = "stash"
+	// BitbucketServer is for Bitbucket Server links, the new name of Stash
+	BitbucketServer Style = "bitbucket-server"
 	// Bitbucket is for bitbucket links
 	Bitbucket Style = "bitbucket"
 	// Cgit is for cgit links
 	Cgit Style = "cgit"
+	// Gitea is for gitea and forgejo links
+	Gitea Style = "gitea"
+	// Forgejo is for forgejo links, the same as Gitea's
+	Forgejo Style = "forgejo"
+	// Sourcehut is for sourcehut links
+	Sourcehut Style = "sourcehut"
+	// AzureDevOps is for azure devops links
+	AzureDevOps Style = "azure-devops"
 )
 
-// InferStyle tries to guess which style to use based on a repository URL
+// Templates are the URL templates of a style. In each template `{repo}` is
+// replaced with the repository URL, `{host}` with its scheme and host, and
+// `{owner}` and `{name}` with the rest of its path, like `skuid` and
+// `changelog`. The other placeholders are:
+//
+// * Commit: `{hash}`
+// * Issue: `{issue}`
+// * PullRequest: `{number}`
+// * Compare: `{from}` and `{to}`
+// * Tag: `{tag}`
+// * WorkItem: `{id}`, for Azure Boards work items like `AB#12`
+//
+// An empty template means the provider has no such page.
+type Templates struct {
+	Commit      string `mapstructure:"commit"`
+	Issue       string `mapstructure:"issue"`
+	PullRequest string `mapstructure:"pull-request"`
+	Compare     string `mapstructure:"compare"`
+	Tag         string `mapstructure:"tag"`
+	WorkItem    string `mapstructure:"work-item"`
+}
+
+var styles = map[Style]Templates{
+	Github: {
+		Commit:      "{repo}/commit/{hash}",
+		Issue:       "{repo}/issues/{issue}",
+		PullRequest: "{repo}/pull/{number}",
+		Compare:     "{repo}/compare/{from}...{to}",
+		Tag:         "{repo}/releases/tag/{tag}",
+	},
+	Gitlab: {
+		Commit:      "{repo}/commit/{hash}",
+		Issue:       "{repo}/issues/{issue}",
+		PullRequest: "{repo}/merge_requests/{number}",
+		Compare:     "{repo}/compare/{from}...{to}",
+		Tag:         "{repo}/tags/{tag}",
+	},
+	Bitbucket: {
+		Commit:      "{repo}/commits/{hash}",
+		Issue:       "{repo}/issues/{issue}",
+		PullRequest: "{repo}/pull-requests/{number}",
+		Compare:     "{repo}/branches/compare/{to}%0D{from}",
+		Tag:         "{repo}/src/{tag}",
+	},
+	BitbucketServer: {
+		Commit:      "{repo}/commits/{hash}",
+		PullRequest: "{repo}/pull-requests/{number}",
+		Compare:     "{repo}/compare/commits?sourceBranch={to}&targetBranch={from}",
+		Tag:         "{repo}/browse?at=refs%2Ftags%2F{tag}",
+	},
+	Cgit: {
+		Commit:  "{repo}/commit/?id={hash}",
+		Compare: "{repo}/diff/?id={to}&id2={from}",
+		Tag:     "{repo}/tag/?h={tag}",
+	},
+	Gitea: {
+		Commit:      "{repo}/commit/{hash}",
+		Issue:       "{repo}/issues/{issue}",
+		PullRequest: "{repo}/pulls/{number}",
+		Compare:     "{repo}/compare/{from}...{to}",
+		Tag:         "{repo}/releases/tag/{tag}",
+	},
+	Sourcehut: {
+		Commit: "{repo}/commit/{hash}",
+		Issue:  "https://todo.sr.ht/{owner}/{name}/{issue}",
+		Tag:    "{repo}/refs/{tag}",
+	},
+	AzureDevOps: {
+		Commit:      "{repo}/commit/{hash}",
+		Issue:       "{host}/{owner}/_workitems/edit/{issue}",
+		PullRequest: "{repo}/pullrequest/{number}",
+		Compare:     "{repo}/branchCompare?baseVersion=GT{from}&targetVersion=GT{to}",
+		Tag:         "{repo}?version=GT{tag}",
+		WorkItem:    "{host}/{owner}/_workitems/edit/{id}",
+	},
+}
+
+func init() {
+	// Stash is the old name of Bitbucket Server
+	styles[Stash] = styles[BitbucketServer]
+	// Forgejo is a fork of Gitea
+	styles[Forgejo] = styles[Gitea]
+}
+
+// Lookup returns the templates of a built-in style, and whether the style
+// exists
+func Lookup(name Style) (Templates, bool) {
+	return Styles(nil).Lookup(name)
+}
+
+// Styles are styles added to the built-in ones, or replacing them, by name
+type Styles map[Style]Templates
+
+// Lookup returns the templates of a style, and whether the style exists
+func (s Styles) Lookup(name Style) (Templates, bool) {
+	if templates, ok := s[name]; ok {
+		return templates, true
+	}
+	templates, ok := styles[name]
+	return templates, ok
+}
+
+// Supported returns a printable string of the built-in and added styles
+func (s Styles) Supported() string {
+	names := []string{}
+	for name := range styles {
+		names = append(names, string(name))
+	}
+	for name := range s {
+		if _, ok := styles[name]; !ok {
+			names = append(names, string(name))
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Parse returns the style with the name, or an error if there is no such
+// style
+func (s Styles) Parse(name string) (Style, error) {
+	if _, ok := s.Lookup(Style(name)); !ok {
+		return "", fmt.Errorf("Link style %s not found! Must be one of %s", name, s.Supported())
+	}
+	return Style(name), nil
+}
+
+// hosts maps the hosts of public providers to their styles
+var hosts = map[string]Style{
+	"github.com":    Github,
+	"gitlab.com":    Gitlab,
+	"bitbucket.org": Bitbucket,
+	"codeberg.org":  Gitea,
+	"git.sr.ht":     Sourcehut,
+	"dev.azure.com": AzureDevOps,
+}
+
+// InferStyle tries to guess which style to use based on a repository URL,
+// defaulting to Github
 func InferStyle(repoURL string) Style {
-	switch {
-	case strings.Contains("github.com", repoURL):
-		return Github
-	case strings.Contains("gitlab.com", repoURL):
-		return Gitlab
-	case strings.Contains("bitbucket.org", repoURL):
-		return Stash
-	default:
-		return Github
+	return Hosts(nil).Infer(repoURL)
+}
+
+// HostStyle returns the style of a repository URL's host, and whether the host
+// is known
+func HostStyle(repoURL string) (Style, bool) {
+	return Hosts(nil).Style(repoURL)
+}
+
+// Hosts map the hosts of self-hosted instances, like a Gitlab at
+// `git.example.com`, to their styles. A host may include a port.
+type Hosts map[string]Style
+
+// Infer tries to guess which style to use based on a repository URL,
+// defaulting to Github
+func (h Hosts) Infer(repoURL string) Style {
+	if style, ok := h.Style(repoURL); ok {
+		return style
 	}
+	return Github
 }
 
-// SupportedStyles returns a printable string of supported styles.
-func SupportedStyles() string {
-	styles := []string{
-		string(Github),
-		string(Gitlab),
-		string(Stash),
-		string(Bitbucket),
-		string(Cgit),
+// Style returns the style of a repository URL's host, and whether the host is
+// known
+func (h Hosts) Style(repoURL string) (Style, bool) {
+	u, err := remote.Parse(repoURL)
+	if err != nil {
+		return "", false
 	}
-	sort.Strings(styles)
-	return strings.Join(styles, ", ")
-}
-
-// IssueLink returns an issue link for a given Style
-func (s Style) IssueLink(issue, repo string) string {
-	var format string
-	switch s {
-	case Github:
-		format = "%s/issues/%s"
-	case Gitlab, Bitbucket:
-		format = "%s/issues/%s"
-	default:
-		format = "%s"
+	host := strings.ToLower(u.HostName())
+	for _, name := range []string{strings.ToLower(u.Host), host} {
+		for key, style := range h {
+			if strings.ToLower(key) == name {
+				return style, true
+			}
+		}
+		if style, ok := hosts[name]; ok {
+			return style, true
+		}
 	}
-	return fmt.Sprintf(format, repo, issue)
-}
-
-// CommitLink returns an issue link for a given Style
-func (s Style) CommitLink(hash, repo string) string {
-	var format string
-	switch s {
-	case Github, Gitlab:
-		format = "%s/commit/%s"
-	case Stash, Bitbucket:
-		format = "%s/commits/%s"
-	case Cgit:
-		format = "%s/commit/?id=%s"
-	default:
-		format = "%s"
+	if strings.HasSuffix(host, ".visualstudio.com") {
+		return AzureDevOps, true
+	}
+	return "", false
+}
+
+// SupportedStyles returns a printable string of the built-in styles.
+func SupportedStyles() string {
+	return Styles(nil).Supported()
+}
+
+// Parse returns the built-in style with the name, or an error if there is no
+// such style
+func Parse(name string) (Style, error) {
+	return Styles(nil).Parse(name)
+}
+
+// IssueLink returns an issue link, or an empty string if the provider has no
+// issues
+func (t Templates) IssueLink(issue, repo string) string {
+	return expand(t.Issue, repo, "{issue}", issue)
+}
+
+// PullRequestLink returns a pull request link, or an empty string if the
+// provider has no pull requests
+func (t Templates) PullRequestLink(number, repo string) string {
+	return expand(t.PullRequest, repo, "{number}", number)
+}
+
+// CommitLink returns a commit link
+func (t Templates) CommitLink(hash, repo string) string {
+	return expand(t.Commit, repo, "{hash}", hash)
+}
+
+// CompareLink returns a link comparing two revisions, or an empty string if
+// the provider can't compare revisions
+func (t Templates) CompareLink(from, to, repo string) string {
+	return expand(t.Compare, repo, "{from}", from, "{to}", to)
+}
+
+// TagLink returns a tag link, or an empty string if the provider has no tag
+// pages
+func (t Templates) TagLink(tag, repo string) string {
+	return expand(t.Tag, repo, "{tag}", tag)
+}
+
+// WorkItemLink returns an Azure Boards work item link, or an empty string if
+// the provider has no work items
+func (t Templates) WorkItemLink(id, repo string) string {
+	return expand(t.WorkItem, repo, "{id}", id)
+}
+
+// expand replaces the repository placeholders and the given placeholder and
+// value pairs in a template
+func expand(template, repo string, values ...string) string {
+	if template == "" {
+		return ""
+	}
+	host, owner, name := splitRepo(repo)
+	pairs := append([]string{
+		"{repo}", repo,
+		"{host}", host,
+		"{owner}", owner,
+		"{name}", name,
+	}, values...)
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// splitRepo splits a repository web URL into its scheme and host, owner and
+// name
+func splitRepo(repo string) (host, owner, name string) {
+	u, err := remote.Parse(repo)
+	if err != nil {
+		return "", "", ""
 	}
-	return fmt.Sprintf(format, repo, hash)
+	return u.Scheme + "://" + u.Host, u.Owner, u.Repo
 }
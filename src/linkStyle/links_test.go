@@ -0,0 +1,115 @@
+package linkStyle
+
+import "testing"
+
+func TestInferStyle(t *testing.T) {
+	hosts := Hosts{"git.example.com": Gitlab, "Code.example.com:8443": Gitea}
+
+	cases := []struct {
+		repo string
+		want Style
+	}{
+		{"https://github.com/skuid/changelog", Github},
+		{"git@github.com:skuid/changelog.git", Github},
+		{"https://gitlab.com/group/subgroup/project", Gitlab},
+		{"ssh://git@gitlab.com/group/project.git", Gitlab},
+		{"https://bitbucket.org/skuid/changelog", Bitbucket},
+		{"https://codeberg.org/skuid/changelog", Gitea},
+		{"https://git.sr.ht/~skuid/changelog", Sourcehut},
+		{"https://dev.azure.com/org/project/_git/repo", AzureDevOps},
+		{"https://org.visualstudio.com/project/_git/repo", AzureDevOps},
+		{"ssh://git@git.example.com:2222/group/project.git", Gitlab},
+		{"https://GIT.example.com/group/project", Gitlab},
+		{"https://code.example.com:8443/skuid/changelog", Gitea},
+		{"https://code.example.com/skuid/changelog", Github},
+		{"https://example.com/github.com/changelog", Github},
+		{"not a url", Github},
+	}
+
+	for _, c := range cases {
+		if got := hosts.Infer(c.repo); got != c.want {
+			t.Errorf("Infer(%q)!\nExpected\n\t%s\nGot\n\t%s", c.repo, c.want, got)
+		}
+	}
+	if style, ok := hosts.Style("https://code.example.com/skuid/changelog"); ok {
+		t.Errorf("Expected an unknown host, got %s", style)
+	}
+	if style, ok := hosts.Style("ssh://git@git.example.com:2222/group/project.git"); !ok || style != Gitlab {
+		t.Errorf("Expected the added host to be gitlab, got %s", style)
+	}
+	if style, ok := HostStyle("https://git.example.com/group/project"); ok {
+		t.Errorf("Expected hosts to only apply where they're passed, got %s", style)
+	}
+}
+
+func TestSplitRepo(t *testing.T) {
+	cases := []struct {
+		repo              string
+		host, owner, name string
+	}{
+		{"https://github.com/skuid/changelog", "https://github.com", "skuid", "changelog"},
+		{"https://gitlab.com/group/subgroup/project/", "https://gitlab.com", "group/subgroup", "project"},
+		{"https://dev.azure.com/org/project/_git/repo", "https://dev.azure.com", "org/project", "repo"},
+		{"http://git.example.com:8080/skuid/changelog", "http://git.example.com:8080", "skuid", "changelog"},
+	}
+
+	for _, c := range cases {
+		host, owner, name := splitRepo(c.repo)
+		if host != c.host || owner != c.owner || name != c.name {
+			t.Errorf("splitRepo(%q)!\nExpected\n\t%s %s %s\nGot\n\t%s %s %s", c.repo, c.host, c.owner, c.name, host, owner, name)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if style, err := Parse("gitea"); err != nil || style != Gitea {
+		t.Errorf("Expected gitea, got %s, %v", style, err)
+	}
+	if _, err := Parse("gitlub"); err == nil {
+		t.Error("Expected an error for a style that doesn't exist")
+	}
+
+	styles := Styles{"gitlub": {Commit: "{repo}/c/{hash}"}}
+	if style, err := styles.Parse("gitlub"); err != nil || style != "gitlub" {
+		t.Errorf("Expected the added style, got %s, %v", style, err)
+	}
+	templates, _ := styles.Lookup("gitlub")
+	if link := templates.CommitLink("abc", "https://example.com/skuid/changelog"); link != "https://example.com/skuid/changelog/c/abc" {
+		t.Errorf("Expected a link from the added style, got %s", link)
+	}
+	if _, ok := Lookup("gitlub"); ok {
+		t.Error("Expected styles to only apply where they're passed")
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	repo := "https://github.com/skuid/changelog"
+	cases := []struct {
+		style Style
+		link  func(Templates) string
+		want  string
+	}{
+		{Github, func(t Templates) string { return t.CommitLink("abc", repo) }, repo + "/commit/abc"},
+		{Github, func(t Templates) string { return t.IssueLink("12", repo) }, repo + "/issues/12"},
+		{Github, func(t Templates) string { return t.PullRequestLink("7", repo) }, repo + "/pull/7"},
+		{Github, func(t Templates) string { return t.CompareLink("v1.0.0", "v1.1.0", repo) }, repo + "/compare/v1.0.0...v1.1.0"},
+		{Github, func(t Templates) string { return t.TagLink("v1.1.0", repo) }, repo + "/releases/tag/v1.1.0"},
+		{Gitlab, func(t Templates) string { return t.TagLink("v1.1.0", repo) }, repo + "/tags/v1.1.0"},
+		{Gitea, func(t Templates) string { return t.TagLink("v1.1.0", repo) }, repo + "/releases/tag/v1.1.0"},
+		{Cgit, func(t Templates) string { return t.TagLink("v1.1.0", repo) }, repo + "/tag/?h=v1.1.0"},
+		{Sourcehut, func(t Templates) string { return t.CompareLink("v1.0.0", "v1.1.0", repo) }, ""},
+		{Sourcehut, func(t Templates) string { return t.TagLink("v1.1.0", repo) }, repo + "/refs/v1.1.0"},
+		{AzureDevOps, func(t Templates) string { return t.TagLink("v1.1.0", repo) }, repo + "?version=GTv1.1.0"},
+		{AzureDevOps, func(t Templates) string { return t.WorkItemLink("12", repo) }, "https://github.com/skuid/_workitems/edit/12"},
+	}
+
+	for _, c := range cases {
+		templates, ok := Lookup(c.style)
+		if !ok {
+			t.Fatalf("Expected style %s to exist", c.style)
+		}
+		if got := c.link(templates); got != c.want {
+			t.Errorf("%s link!\nExpected\n\t%s\nGot\n\t%s", c.style, c.want, got)
+		}
+	}
+}
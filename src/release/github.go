@@ -0,0 +1,114 @@
+package release
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/transport"
+)
+
+type githubPublisher struct {
+	owner  string
+	repo   string
+	client *github.Client
+}
+
+// NewGithubPublisher publishes releases to Github Releases
+func NewGithubPublisher(repo, token string) Publisher {
+	client := github.NewClient(transport.NewTokenClient(token, ""))
+	owner, name := changelog.GithubOwnerRepo(repo)
+	return githubPublisher{owner, name, client}
+}
+
+// findRelease returns the release for a tag, or nil if there isn't one. Draft
+// releases can't be looked up by tag, so every release is listed.
+func (g githubPublisher) findRelease(ctx context.Context, tag string) (*github.RepositoryRelease, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		releases, resp, err := g.client.Repositories.ListReleases(ctx, g.owner, g.repo, opt)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, release := range releases {
+			if release.GetTagName() == tag {
+				return release, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// Publish creates a release for the tag, or updates it if it already exists.
+// Assets replace any existing asset with the same name.
+func (g githubPublisher) Publish(ctx context.Context, r Release) error {
+	if g.owner == "" || g.repo == "" {
+		return errors.New("Releases can only be published to a Github repository")
+	}
+
+	existing, err := g.findRelease(ctx, r.Tag)
+	if err != nil {
+		return err
+	}
+
+	ghRelease := &github.RepositoryRelease{
+		TagName:    github.String(r.Tag),
+		Name:       github.String(r.Name),
+		Body:       github.String(r.Body),
+		Draft:      github.Bool(r.Draft),
+		Prerelease: github.Bool(r.Prerelease),
+	}
+
+	var published *github.RepositoryRelease
+	if existing == nil {
+		published, _, err = g.client.Repositories.CreateRelease(ctx, g.owner, g.repo, ghRelease)
+	} else {
+		published, _, err = g.client.Repositories.EditRelease(ctx, g.owner, g.repo, existing.GetID(), ghRelease)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, asset := range r.Assets {
+		if err := g.uploadAsset(ctx, published, asset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g githubPublisher) uploadAsset(ctx context.Context, release *github.RepositoryRelease, path string) error {
+	name := filepath.Base(path)
+	for _, existing := range release.Assets {
+		if existing.GetName() != name {
+			continue
+		}
+		resp, err := g.client.Repositories.DeleteReleaseAsset(ctx, g.owner, g.repo, existing.GetID())
+		if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+			return errors.WithStack(err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer file.Close()
+
+	_, _, err = g.client.Repositories.UploadReleaseAsset(
+		ctx,
+		g.owner,
+		g.repo,
+		release.GetID(),
+		&github.UploadOptions{Name: name},
+		file,
+	)
+	return errors.WithStack(err)
+}
@@ -0,0 +1,133 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// githubStandIn is a minimal stand-in for the Github releases API
+type githubStandIn struct {
+	releases map[int]map[string]interface{}
+	uploads  []string
+	deletes  []string
+}
+
+func (s *githubStandIn) mux(t *testing.T) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/skuid/changelog/releases", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			releases := []map[string]interface{}{}
+			for _, release := range s.releases {
+				releases = append(releases, release)
+			}
+			json.NewEncoder(w).Encode(releases)
+		case "POST":
+			release := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&release)
+			id := len(s.releases) + 1
+			release["id"] = id
+			s.releases[id] = release
+			json.NewEncoder(w).Encode(release)
+		}
+	})
+	mux.HandleFunc("/repos/skuid/changelog/releases/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" {
+			t.Errorf("Expected PATCH, got %s", r.Method)
+		}
+		edit := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&edit)
+		for k, v := range edit {
+			s.releases[1][k] = v
+		}
+		json.NewEncoder(w).Encode(s.releases[1])
+	})
+	mux.HandleFunc("/repos/skuid/changelog/releases/assets/7", func(w http.ResponseWriter, r *http.Request) {
+		s.deletes = append(s.deletes, r.Method)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/uploads/repos/skuid/changelog/releases/1/assets", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.uploads = append(s.uploads, fmt.Sprintf("%s=%s", r.URL.Query().Get("name"), body))
+		fmt.Fprint(w, `{"id": 8}`)
+	})
+	return mux
+}
+
+func newTestGithubPublisher(t *testing.T, standIn *githubStandIn) (githubPublisher, func()) {
+	t.Helper()
+	server := httptest.NewServer(standIn.mux(t))
+	g := NewGithubPublisher("https://github.com/skuid/changelog", "").(githubPublisher)
+	g.client.BaseURL, _ = url.Parse(server.URL + "/")
+	g.client.UploadURL, _ = url.Parse(server.URL + "/uploads/")
+	return g, server.Close
+}
+
+func TestGithubPublishCreates(t *testing.T) {
+	standIn := &githubStandIn{releases: map[int]map[string]interface{}{}}
+	g, closer := newTestGithubPublisher(t, standIn)
+	defer closer()
+
+	err := g.Publish(context.Background(), NewRelease("1.2.0-rc.1", "v1.2.0-rc.1", "notes"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	created, ok := standIn.releases[1]
+	if !ok {
+		t.Fatal("Expected a release to be created")
+	}
+	if created["tag_name"] != "v1.2.0-rc.1" || created["body"] != "notes" || created["prerelease"] != true {
+		t.Errorf("Release not created properly, got %v", created)
+	}
+}
+
+func TestGithubPublishUpdates(t *testing.T) {
+	standIn := &githubStandIn{releases: map[int]map[string]interface{}{
+		1: {
+			"id":       1,
+			"tag_name": "v1.2.0",
+			"body":     "old notes",
+			"draft":    true,
+			"assets":   []map[string]interface{}{{"id": 7, "name": "asset.txt"}},
+		},
+	}}
+	g, closer := newTestGithubPublisher(t, standIn)
+	defer closer()
+
+	dir, err := ioutil.TempDir("", "changelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	assetPath := filepath.Join(dir, "asset.txt")
+	ioutil.WriteFile(assetPath, []byte("contents"), 0644)
+
+	r := NewRelease("1.2.0", "v1.2.0", "new notes")
+	r.Assets = []string{assetPath}
+	if err := g.Publish(context.Background(), r); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(standIn.releases) != 1 {
+		t.Fatalf("Expected the existing release to be updated, got %d releases", len(standIn.releases))
+	}
+	updated := standIn.releases[1]
+	if updated["body"] != "new notes" || updated["draft"] != false {
+		t.Errorf("Release not updated properly, got %v", updated)
+	}
+	if len(standIn.deletes) != 1 || standIn.deletes[0] != "DELETE" {
+		t.Errorf("Expected the existing asset to be deleted, got %v", standIn.deletes)
+	}
+	if len(standIn.uploads) != 1 || standIn.uploads[0] != "asset.txt=contents" {
+		t.Errorf("Asset not uploaded properly, got %v", standIn.uploads)
+	}
+}
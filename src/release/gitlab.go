@@ -0,0 +1,179 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/transport"
+)
+
+type gitlabPublisher struct {
+	webURL  string
+	apiURL  string
+	project string
+	token   string
+	ref     string
+	client  *http.Client
+}
+
+// NewGitlabPublisher publishes releases to Gitlab Releases. Tags that don't
+// exist yet are created from ref.
+func NewGitlabPublisher(repo, token, ref string) Publisher {
+	g := gitlabPublisher{token: token, ref: ref, client: transport.NewClient()}
+	if u, err := url.Parse(strings.TrimSuffix(repo, ".git")); err == nil && u.Host != "" {
+		g.webURL = fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, strings.Trim(u.Path, "/"))
+		g.apiURL = fmt.Sprintf("%s://%s/api/v4", u.Scheme, u.Host)
+		g.project = strings.Trim(u.Path, "/")
+	}
+	return g
+}
+
+type gitlabRelease struct {
+	TagName     string `json:"tag_name,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description"`
+	Ref         string `json:"ref,omitempty"`
+}
+
+type gitlabLink struct {
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func (g gitlabPublisher) projectPath(format string, args ...interface{}) string {
+	return fmt.Sprintf("%s/projects/%s%s", g.apiURL, url.PathEscape(g.project), fmt.Sprintf(format, args...))
+}
+
+// do sends a request to the Gitlab API, decoding the response into v if it
+// isn't nil. The response status is returned along with any error.
+func (g gitlabPublisher) do(ctx context.Context, method, path, contentType string, body io.Reader, v interface{}) (int, error) {
+	req, err := http.NewRequest(method, path, body)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("PRIVATE-TOKEN", g.token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, errors.Errorf("%s %s: %d %s", method, path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if v == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, errors.WithStack(json.NewDecoder(resp.Body).Decode(v))
+}
+
+func (g gitlabPublisher) doJSON(ctx context.Context, method, path string, body, v interface{}) (int, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+	return g.do(ctx, method, path, "application/json", &buf, v)
+}
+
+// Publish creates a release for the tag, or updates it if it already exists.
+// Assets are uploaded to the project and linked from the release, replacing
+// any existing link with the same name.
+func (g gitlabPublisher) Publish(ctx context.Context, r Release) error {
+	if g.project == "" {
+		return errors.New("Releases can only be published to a Gitlab repository")
+	}
+
+	status, err := g.doJSON(ctx, "GET", g.projectPath("/releases/%s", url.PathEscape(r.Tag)), nil, nil)
+	switch {
+	case status == http.StatusNotFound:
+		release := gitlabRelease{TagName: r.Tag, Name: r.Name, Description: r.Body, Ref: g.ref}
+		_, err = g.doJSON(ctx, "POST", g.projectPath("/releases"), release, nil)
+	case err == nil:
+		release := gitlabRelease{Name: r.Name, Description: r.Body}
+		_, err = g.doJSON(ctx, "PUT", g.projectPath("/releases/%s", url.PathEscape(r.Tag)), release, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, asset := range r.Assets {
+		if err := g.linkAsset(ctx, r.Tag, asset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g gitlabPublisher) upload(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if err := form.Close(); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	uploaded := struct {
+		URL string `json:"url"`
+	}{}
+	if _, err := g.do(ctx, "POST", g.projectPath("/uploads"), form.FormDataContentType(), &body, &uploaded); err != nil {
+		return "", err
+	}
+	return g.webURL + uploaded.URL, nil
+}
+
+func (g gitlabPublisher) linkAsset(ctx context.Context, tag, path string) error {
+	assetURL, err := g.upload(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	linksPath := g.projectPath("/releases/%s/assets/links", url.PathEscape(tag))
+	links := []gitlabLink{}
+	if _, err := g.doJSON(ctx, "GET", linksPath, nil, &links); err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	for _, link := range links {
+		if link.Name != name {
+			continue
+		}
+		if _, err := g.doJSON(ctx, "DELETE", fmt.Sprintf("%s/%d", linksPath, link.ID), nil, nil); err != nil {
+			return err
+		}
+	}
+
+	_, err = g.doJSON(ctx, "POST", linksPath, gitlabLink{Name: name, URL: assetURL}, nil)
+	return err
+}
@@ -0,0 +1,101 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitlabPublish(t *testing.T) {
+	cases := []struct {
+		name     string
+		existing bool
+		want     []string
+	}{
+		{
+			"creates",
+			false,
+			[]string{
+				"GET /api/v4/projects/skuid%2Fchangelog/releases/v1.2.0",
+				`POST /api/v4/projects/skuid%2Fchangelog/releases {"tag_name":"v1.2.0","name":"1.2.0","description":"notes","ref":"master"}`,
+				"POST /api/v4/projects/skuid%2Fchangelog/uploads",
+				"GET /api/v4/projects/skuid%2Fchangelog/releases/v1.2.0/assets/links",
+				`POST /api/v4/projects/skuid%2Fchangelog/releases/v1.2.0/assets/links {"name":"asset.txt","url":"https://gitlab.example.com/skuid/changelog/uploads/abc/asset.txt"}`,
+			},
+		},
+		{
+			"updates",
+			true,
+			[]string{
+				"GET /api/v4/projects/skuid%2Fchangelog/releases/v1.2.0",
+				`PUT /api/v4/projects/skuid%2Fchangelog/releases/v1.2.0 {"name":"1.2.0","description":"notes"}`,
+				"POST /api/v4/projects/skuid%2Fchangelog/uploads",
+				"GET /api/v4/projects/skuid%2Fchangelog/releases/v1.2.0/assets/links",
+				"DELETE /api/v4/projects/skuid%2Fchangelog/releases/v1.2.0/assets/links/3",
+				`POST /api/v4/projects/skuid%2Fchangelog/releases/v1.2.0/assets/links {"name":"asset.txt","url":"https://gitlab.example.com/skuid/changelog/uploads/abc/asset.txt"}`,
+			},
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "changelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	assetPath := filepath.Join(dir, "asset.txt")
+	ioutil.WriteFile(assetPath, []byte("contents"), 0644)
+
+	for _, c := range cases {
+		requests := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("PRIVATE-TOKEN") != "token" {
+				t.Errorf("%s: expected a private token", c.name)
+			}
+			request := fmt.Sprintf("%s %s", r.Method, r.URL.EscapedPath())
+			if r.Header.Get("Content-Type") == "application/json" && r.Method != "GET" && r.Method != "DELETE" {
+				body, _ := ioutil.ReadAll(r.Body)
+				request = fmt.Sprintf("%s %s", request, bytes.TrimSpace(body))
+			}
+			requests = append(requests, request)
+
+			switch {
+			case r.Method == "GET" && r.URL.EscapedPath() == "/api/v4/projects/skuid%2Fchangelog/releases/v1.2.0" && !c.existing:
+				w.WriteHeader(http.StatusNotFound)
+			case r.URL.EscapedPath() == "/api/v4/projects/skuid%2Fchangelog/uploads":
+				fmt.Fprint(w, `{"url": "/uploads/abc/asset.txt"}`)
+			case r.Method == "GET" && r.URL.EscapedPath() == "/api/v4/projects/skuid%2Fchangelog/releases/v1.2.0/assets/links" && c.existing:
+				fmt.Fprint(w, `[{"id": 3, "name": "asset.txt"}, {"id": 4, "name": "other.txt"}]`)
+			case r.Method == "GET" && r.URL.EscapedPath() == "/api/v4/projects/skuid%2Fchangelog/releases/v1.2.0/assets/links":
+				fmt.Fprint(w, `[]`)
+			default:
+				fmt.Fprint(w, `{}`)
+			}
+		}))
+
+		g := NewGitlabPublisher("https://gitlab.example.com/skuid/changelog.git", "token", "master").(gitlabPublisher)
+		g.apiURL = server.URL + "/api/v4"
+
+		r := NewRelease("1.2.0", "v1.2.0", "notes")
+		r.Assets = []string{assetPath}
+		if err := g.Publish(context.Background(), r); err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+		}
+		server.Close()
+
+		if len(requests) != len(c.want) {
+			t.Errorf("%s: expected %d requests, got %d: %v", c.name, len(c.want), len(requests), requests)
+			continue
+		}
+		for i := range c.want {
+			if requests[i] != c.want[i] {
+				t.Errorf("%s: request %d not equal!\nExpected\n\t%s\nGot\n\t%s", c.name, i, c.want[i], requests[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package release
+
+import (
+	"context"
+	"strings"
+
+	"github.com/skuid/changelog/src/changelog"
+)
+
+// Release is a set of release notes to attach to a tag
+type Release struct {
+	Tag        string
+	Name       string
+	Body       string
+	Draft      bool
+	Prerelease bool
+	// Assets are paths to files to upload with the release
+	Assets []string
+}
+
+// Publisher creates or updates a release with a provider
+type Publisher interface {
+	Publish(ctx context.Context, r Release) error
+}
+
+// NewRelease returns a release for a version. The release is a prerelease if
+// the version has a semver pre-release identifier like `1.2.0-rc.1`, or a
+// draft instead if that identifier starts with "draft", like `1.2.0-draft`.
+func NewRelease(version, tag, body string) Release {
+	if tag == "" {
+		tag = version
+	}
+
+	r := Release{
+		Tag:  tag,
+		Name: version,
+		Body: body,
+	}
+	if v, err := changelog.ParseVersion(version); err == nil && v.IsPrerelease() {
+		// A draft marker only holds the release back, it doesn't make it a
+		// prerelease
+		r.Draft = strings.HasPrefix(v.Prerelease[0], "draft")
+		r.Prerelease = !r.Draft
+	}
+	return r
+}
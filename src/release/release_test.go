@@ -0,0 +1,35 @@
+package release_test
+
+import (
+	"testing"
+
+	"github.com/skuid/changelog/src/release"
+)
+
+func TestNewRelease(t *testing.T) {
+	cases := []struct {
+		version    string
+		tag        string
+		wantTag    string
+		draft      bool
+		prerelease bool
+	}{
+		{"1.2.0", "", "1.2.0", false, false},
+		{"v1.2.0", "", "v1.2.0", false, false},
+		{"1.2.0", "v1.2.0", "v1.2.0", false, false},
+		{"1.2.0-rc.1", "", "1.2.0-rc.1", false, true},
+		{"1.2.0+build-5", "", "1.2.0+build-5", false, false},
+		{"v1.2.0-draft", "", "v1.2.0-draft", true, false},
+		{"1.2.0-draft.2", "", "1.2.0-draft.2", true, false},
+	}
+
+	for _, c := range cases {
+		got := release.NewRelease(c.version, c.tag, "body")
+		if got.Tag != c.wantTag || got.Name != c.version || got.Body != "body" {
+			t.Errorf("Unexpected release for %s: %+v", c.version, got)
+		}
+		if got.Draft != c.draft || got.Prerelease != c.prerelease {
+			t.Errorf("Expected draft %t and prerelease %t for %s, got %t and %t", c.draft, c.prerelease, c.version, got.Draft, got.Prerelease)
+		}
+	}
+}
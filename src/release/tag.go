@@ -0,0 +1,36 @@
+package release
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/changelog"
+)
+
+type tagPublisher struct {
+	tagger changelog.Tagger
+	target string
+	push   bool
+}
+
+// NewTagPublisher publishes releases as annotated tag messages, for providers
+// without a release concept. New tags point at target, and are pushed to
+// origin if push is set.
+func NewTagPublisher(tagger changelog.Tagger, target string, push bool) Publisher {
+	return tagPublisher{tagger, target, push}
+}
+
+// Publish creates the annotated tag, replacing the message if it already
+// exists
+func (t tagPublisher) Publish(ctx context.Context, r Release) error {
+	if len(r.Assets) > 0 {
+		return errors.New("Assets can't be attached to a tag")
+	}
+	if err := t.tagger.Tag(ctx, r.Tag, t.target, r.Body); err != nil {
+		return errors.Wrapf(err, "Could not create tag %s", r.Tag)
+	}
+	if !t.push {
+		return nil
+	}
+	return errors.Wrapf(t.tagger.PushTag(ctx, r.Tag), "Could not push tag %s", r.Tag)
+}
@@ -0,0 +1,51 @@
+package release_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/skuid/changelog/src/release"
+)
+
+type fakeTagger struct {
+	tags   map[string]string
+	pushed []string
+}
+
+func (f *fakeTagger) Tag(ctx context.Context, name, target, message string) error {
+	f.tags[name] = target + ":" + message
+	return nil
+}
+
+func (f *fakeTagger) PushTag(ctx context.Context, name string) error {
+	if _, ok := f.tags[name]; !ok {
+		return errors.New("no such tag")
+	}
+	f.pushed = append(f.pushed, name)
+	return nil
+}
+
+func TestTagPublish(t *testing.T) {
+	tagger := &fakeTagger{tags: map[string]string{}}
+
+	if err := release.NewTagPublisher(tagger, "HEAD", false).Publish(context.Background(), release.NewRelease("1.2.0", "v1.2.0", "notes")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if tagger.tags["v1.2.0"] != "HEAD:notes" || len(tagger.pushed) != 0 {
+		t.Errorf("Tag not created properly, got %v and pushed %v", tagger.tags, tagger.pushed)
+	}
+
+	if err := release.NewTagPublisher(tagger, "master", true).Publish(context.Background(), release.NewRelease("1.3.0", "", "more notes")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if tagger.tags["1.3.0"] != "master:more notes" || len(tagger.pushed) != 1 || tagger.pushed[0] != "1.3.0" {
+		t.Errorf("Tag not pushed properly, got %v and pushed %v", tagger.tags, tagger.pushed)
+	}
+
+	r := release.NewRelease("1.4.0", "", "notes")
+	r.Assets = []string{"asset.txt"}
+	if err := release.NewTagPublisher(tagger, "HEAD", false).Publish(context.Background(), r); err == nil {
+		t.Error("Expected an error publishing assets to a tag")
+	}
+}
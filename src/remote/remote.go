@@ -0,0 +1,151 @@
+// Package remote parses the URLs of git remotes into the host, owner and
+// name of a repository, and the repository's web URL.
+package remote
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// scpRegex matches scp-like ssh remotes, like `git@github.com:owner/repo.git`
+var scpRegex = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// URL is a parsed remote URL
+type URL struct {
+	// Scheme of the web URL, https unless the remote used http
+	Scheme string
+	// Host of the web URL, with the port if the remote was a web URL with a
+	// custom port. Ports of ssh remotes aren't kept.
+	Host string
+	// Owner is everything between the host and the name, like `skuid`, a
+	// Gitlab group and subgroup `group/subgroup`, or an Azure DevOps
+	// organization and project `org/project`
+	Owner string
+	// Repo is the name of the repository, without a `.git` suffix
+	Repo string
+	// azure is set for Azure DevOps repositories, whose web URLs have a
+	// `_git` segment before the name
+	azure bool
+}
+
+// Parse parses an ssh, git or http remote URL
+func Parse(remote string) (URL, error) {
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		return URL{}, errors.New("Remote URL is empty")
+	}
+
+	var u URL
+	var path string
+	if strings.Contains(remote, "://") {
+		parsed, err := url.Parse(remote)
+		if err != nil {
+			return URL{}, errors.Wrapf(err, "Could not parse remote URL %s", remote)
+		}
+		u.Scheme = "https"
+		u.Host = parsed.Hostname()
+		switch parsed.Scheme {
+		case "http", "https":
+			// A custom port is part of the web URL too
+			u.Scheme = parsed.Scheme
+			u.Host = parsed.Host
+		case "ssh", "git", "git+ssh", "ssh+git":
+		default:
+			return URL{}, errors.Errorf("Unsupported scheme %s in remote URL %s", parsed.Scheme, remote)
+		}
+		path = parsed.Path
+	} else if capture := scpRegex.FindStringSubmatch(remote); len(capture) > 2 && !isWindowsDrive(capture[1]) {
+		u.Scheme = "https"
+		u.Host = capture[1]
+		path = capture[2]
+	} else {
+		return URL{}, errors.Errorf("Remote %s is not a URL", remote)
+	}
+	if u.Host == "" {
+		return URL{}, errors.Errorf("Remote URL %s has no host", remote)
+	}
+
+	segments := []string{}
+	for _, segment := range strings.Split(strings.TrimSuffix(strings.Trim(path, "/"), ".git"), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	// Azure DevOps ssh remotes look like
+	// `git@ssh.dev.azure.com:v3/org/project/repo`, and http remotes like
+	// `https://org@dev.azure.com/org/project/_git/repo`
+	if strings.HasPrefix(u.Host, "ssh.") && len(segments) == 4 && segments[0] == "v3" {
+		u.Host = strings.TrimPrefix(u.Host, "ssh.")
+		segments = append(segments[1:3], "_git", segments[3])
+	}
+	for i, segment := range segments {
+		if segment == "_git" && i == len(segments)-2 {
+			u.azure = true
+			segments = append(segments[:i], segments[i+1])
+			break
+		}
+	}
+
+	if len(segments) < 2 {
+		return URL{}, errors.Errorf("Remote URL %s has no owner and repository", remote)
+	}
+	u.Owner = strings.Join(segments[:len(segments)-1], "/")
+	u.Repo = segments[len(segments)-1]
+	return u, nil
+}
+
+// isWindowsDrive reports whether the host of an scp-like remote is a drive
+// letter of a local Windows path, like `C:\repo`
+func isWindowsDrive(host string) bool {
+	return len(host) == 1
+}
+
+// HostName returns the host without a port
+func (u URL) HostName() string {
+	if host, _, err := net.SplitHostPort(u.Host); err == nil {
+		return host
+	}
+	return u.Host
+}
+
+// FullName returns the owner and name, like `skuid/changelog`
+func (u URL) FullName() string {
+	return u.Owner + "/" + u.Repo
+}
+
+// WebURL returns the URL of the repository's web page, like
+// `https://github.com/skuid/changelog`
+func (u URL) WebURL() string {
+	if u.azure {
+		return fmt.Sprintf("%s://%s/%s/_git/%s", u.Scheme, u.Host, u.Owner, u.Repo)
+	}
+	return fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, u.FullName())
+}
+
+// WithFullName returns the URL of another repository on the same host, given
+// its `owner/name`
+func (u URL) WithFullName(fullName string) URL {
+	i := strings.LastIndex(fullName, "/")
+	if i < 0 {
+		u.Repo = fullName
+		return u
+	}
+	u.Owner, u.Repo = fullName[:i], fullName[i+1:]
+	return u
+}
+
+// WebURL returns the web URL of a remote, or the remote itself if it can't be
+// parsed
+func WebURL(remote string) string {
+	u, err := Parse(remote)
+	if err != nil {
+		return remote
+	}
+	return u.WebURL()
+}
@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+)
+
+// Cache stores GET responses on disk and revalidates them with conditional
+// requests, so unchanged lists are served from disk. Github doesn't count
+// `304 Not Modified` responses against the rate limit.
+type Cache struct {
+	// Base makes the requests. Defaults to http.DefaultTransport
+	Base http.RoundTripper
+	// Dir holds the cached responses
+	Dir string
+}
+
+// NewCachingClient returns an HTTP client using the default retry policy that
+// caches responses in dir
+func NewCachingClient(dir string) *http.Client {
+	return &http.Client{Transport: &Cache{Base: New(nil), Dir: dir}}
+}
+
+// RoundTrip serves the request from the cache if the server says the cached
+// response is still current
+func (c *Cache) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := c.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Method != "GET" || req.Header.Get("Range") != "" {
+		return base.RoundTrip(req)
+	}
+
+	path := c.path(req)
+	cached := c.load(path, req)
+
+	conditional := req
+	if cached != nil {
+		// Copy the request rather than changing the caller's headers
+		conditional = new(http.Request)
+		*conditional = *req
+		conditional.Header = http.Header{}
+		for key, values := range req.Header {
+			conditional.Header[key] = values
+		}
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			conditional.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			conditional.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := base.RoundTrip(conditional)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		return cached, nil
+	}
+	if resp.StatusCode != http.StatusOK || (resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "") {
+		return resp, nil
+	}
+	return c.store(path, resp)
+}
+
+// path returns the file for a request. Responses vary by the Accept and
+// Authorization headers, so those are part of the key.
+func (c *Cache) path(req *http.Request) string {
+	key := sha256.New()
+	for _, part := range []string{req.URL.String(), req.Header.Get("Accept"), req.Header.Get("Authorization")} {
+		key.Write([]byte(part))
+		key.Write([]byte{0})
+	}
+	return filepath.Join(c.Dir, "http", hex.EncodeToString(key.Sum(nil)))
+}
+
+// load reads a cached response, returning nil if there isn't a usable one
+func (c *Cache) load(path string, req *http.Request) *http.Response {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), req)
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+// store writes the response to the cache, returning a copy with the body
+// still readable
+func (c *Cache) store(path string, resp *http.Response) (*http.Response, error) {
+	raw, err := httputil.DumpResponse(resp, true)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// A cache that can't be written is only slower, so errors are ignored
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err == nil {
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, raw, 0600); err == nil {
+			os.Rename(tmp, path)
+		}
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), resp.Request)
+}
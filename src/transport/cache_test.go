@@ -0,0 +1,102 @@
+package transport
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestCacheRevalidates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changelog-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	etag := `"v1"`
+	body := "first"
+	var conditional []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &Cache{Dir: dir}}
+
+	get := func() string {
+		t.Helper()
+		resp, err := client.Get(server.URL + "/commits")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer resp.Body.Close()
+		got, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", resp.StatusCode)
+		}
+		return string(got)
+	}
+
+	if got := get(); got != "first" {
+		t.Errorf("Expected first, got %s", got)
+	}
+	if got := get(); got != "first" {
+		t.Errorf("Expected the cached body, got %s", got)
+	}
+
+	etag, body = `"v2"`, "second"
+	if got := get(); got != "second" {
+		t.Errorf("Expected the changed body, got %s", got)
+	}
+	if got := get(); got != "second" {
+		t.Errorf("Expected the new cached body, got %s", got)
+	}
+
+	expected := []string{"", `"v1"`, `"v1"`, `"v2"`}
+	if len(conditional) != len(expected) {
+		t.Fatalf("Expected %d requests, got %d", len(expected), len(conditional))
+	}
+	for i := range expected {
+		if conditional[i] != expected[i] {
+			t.Errorf("Expected request %d to send If-None-Match %s, got %s", i, expected[i], conditional[i])
+		}
+	}
+}
+
+func TestCacheSkipsUncacheableResponses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changelog-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server, bodies := serve(
+		status(200),
+		status(200),
+		status(404, "ETag", `"v1"`),
+		status(404, "ETag", `"v1"`),
+	)
+	defer server.Close()
+	client := &http.Client{Transport: &Cache{Dir: dir}}
+
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		resp.Body.Close()
+		if resp.Request.Header.Get("If-None-Match") != "" {
+			t.Errorf("Expected request %d to be unconditional", i)
+		}
+	}
+	if len(*bodies) != 4 {
+		t.Errorf("Expected 4 requests, got %d", len(*bodies))
+	}
+}
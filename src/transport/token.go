@@ -0,0 +1,25 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// NewTokenClient returns an HTTP client that sends the token as an OAuth2
+// bearer token, like the Github API expects. The token is added on top of the
+// default retry policy, so rate limits and transient failures of
+// authenticated requests are retried too. Responses are cached in cacheDir
+// unless it is empty.
+func NewTokenClient(token, cacheDir string) *http.Client {
+	base := NewClient()
+	if cacheDir != "" {
+		base = NewCachingClient(cacheDir)
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base)
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	)
+	return oauth2.NewClient(ctx, ts)
+}
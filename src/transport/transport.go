@@ -0,0 +1,259 @@
+// Package transport provides the HTTP transport shared by the Github and
+// Gitlab clients. It waits out rate limits, retries transient failures of
+// idempotent requests, and reports the remaining API quota to Prometheus.
+package transport
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var rateLimitRemaining = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "changelog_api_rate_limit_remaining",
+		Help: "Requests left in the current rate limit window of each API host.",
+	},
+	[]string{"host"},
+)
+
+func init() {
+	prometheus.MustRegister(rateLimitRemaining)
+}
+
+// RateLimitError is returned when the API's request budget is used up and
+// won't reset soon enough to wait for it
+type RateLimitError struct {
+	Host  string
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Reset.IsZero() {
+		return fmt.Sprintf("%s API rate limit exhausted", e.Host)
+	}
+	return fmt.Sprintf(
+		"%s API rate limit exhausted, resets at %s (in %s)",
+		e.Host,
+		e.Reset.Format(time.RFC3339),
+		time.Until(e.Reset).Truncate(time.Second),
+	)
+}
+
+// Transport retries rate limited requests once their limit resets, and
+// retries idempotent requests that fail with a 5xx or network error using
+// jittered exponential backoff
+type Transport struct {
+	// Base makes the requests. Defaults to http.DefaultTransport
+	Base http.RoundTripper
+	// MaxRetries is how many times a failed request is retried
+	MaxRetries int
+	// MaxWait is the longest to wait for a rate limit to reset. Longer waits
+	// fail with a RateLimitError
+	MaxWait time.Duration
+	// MinBackoff is the backoff before the first retry, doubling after that
+	MinBackoff time.Duration
+	// MaxBackoff caps the backoff between retries
+	MaxBackoff time.Duration
+
+	// sleep and now are replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+	now   func() time.Time
+}
+
+// New returns a transport with the default retry policy around base
+func New(base http.RoundTripper) *Transport {
+	return &Transport{
+		Base:       base,
+		MaxRetries: 3,
+		MaxWait:    time.Minute,
+		MinBackoff: time.Second,
+		MaxBackoff: 30 * time.Second,
+	}
+}
+
+// NewClient returns an HTTP client using a transport with the default retry
+// policy
+func NewClient() *http.Client {
+	return &http.Client{Transport: New(nil)}
+}
+
+// RoundTrip sends the request, retrying it as needed
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := base.RoundTrip(req)
+		if err == nil {
+			t.recordQuota(req, resp)
+		}
+
+		wait, retry, err := t.retryAfter(req, resp, err, attempt)
+		if !retry || !t.canRetry(req) {
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err := t.wait(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryAfter decides whether a response should be retried, and how long to
+// wait first. Exhausted rate limits that reset too far in the future are
+// returned as a RateLimitError.
+func (t *Transport) retryAfter(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool, error) {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return 0, false, err
+		}
+		return t.backoff(attempt), attempt < t.MaxRetries, err
+	}
+
+	if isRateLimited(resp) {
+		wait, reset := t.rateLimitWait(resp)
+		if wait > t.MaxWait || attempt >= t.MaxRetries || !fitsDeadline(req.Context(), t.clock(), wait) {
+			resp.Body.Close()
+			return 0, false, &RateLimitError{Host: req.URL.Host, Reset: reset}
+		}
+		return wait, true, nil
+	}
+
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return t.backoff(attempt), attempt < t.MaxRetries, nil
+	}
+	return 0, false, nil
+}
+
+// isRateLimited reports whether the response was refused for going over a
+// primary or secondary rate limit
+func isRateLimited(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("Retry-After") != "" || remainingHeader(resp.Header) == "0"
+	}
+	return false
+}
+
+// rateLimitWait returns how long until the request can be retried, from
+// Retry-After or the time the rate limit resets
+func (t *Transport) rateLimitWait(resp *http.Response) (time.Duration, time.Time) {
+	now := t.clock()
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second, now.Add(time.Duration(seconds) * time.Second)
+	}
+	for _, header := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		if epoch, err := strconv.ParseInt(resp.Header.Get(header), 10, 64); err == nil {
+			reset := time.Unix(epoch, 0)
+			wait := reset.Sub(now)
+			if wait < 0 {
+				wait = 0
+			}
+			return wait, reset
+		}
+	}
+	// No hint from the API, so back off as if the request failed
+	return t.MinBackoff, time.Time{}
+}
+
+// fitsDeadline reports whether waiting leaves time before the context's
+// deadline to make the request
+func fitsDeadline(ctx context.Context, now time.Time, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || now.Add(wait).Before(deadline)
+}
+
+// backoff returns a random wait of up to MinBackoff doubled for each attempt,
+// capped at MaxBackoff
+func (t *Transport) backoff(attempt int) time.Duration {
+	limit := t.MinBackoff << uint(attempt)
+	if limit > t.MaxBackoff || limit <= 0 {
+		limit = t.MaxBackoff
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// canRetry reports whether the request can safely be sent again
+func (t *Transport) canRetry(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewind returns a copy of the request with a fresh body to send again
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	retry := new(http.Request)
+	*retry = *req
+	retry.Body = body
+	return retry, nil
+}
+
+func (t *Transport) wait(ctx context.Context, d time.Duration) error {
+	if t.sleep != nil {
+		return t.sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *Transport) clock() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// remainingHeader returns the remaining quota from Github's or Gitlab's rate
+// limit headers
+func remainingHeader(header http.Header) string {
+	if remaining := header.Get("X-RateLimit-Remaining"); remaining != "" {
+		return remaining
+	}
+	return header.Get("RateLimit-Remaining")
+}
+
+func (t *Transport) recordQuota(req *http.Request, resp *http.Response) {
+	remaining, err := strconv.ParseFloat(remainingHeader(resp.Header), 64)
+	if err != nil {
+		return
+	}
+	rateLimitRemaining.WithLabelValues(req.URL.Host).Set(remaining)
+}
@@ -0,0 +1,180 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestClient returns a client whose transport records waits instead of
+// sleeping
+func newTestClient(now time.Time) (*http.Client, *[]time.Duration) {
+	waits := []time.Duration{}
+	t := New(nil)
+	t.now = func() time.Time { return now }
+	t.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return &http.Client{Transport: t}, &waits
+}
+
+// serve responds with each handler in turn, counting the requests and
+// recording their bodies
+func serve(handlers ...http.HandlerFunc) (*httptest.Server, *[]string) {
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		handlers[len(bodies)-1](w, r)
+	}))
+	return server, &bodies
+}
+
+func status(code int, headers ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.WriteHeader(code)
+	}
+}
+
+func TestRetriesServerErrors(t *testing.T) {
+	server, bodies := serve(status(502), status(503), status(200))
+	defer server.Close()
+	client, waits := newTestClient(time.Now())
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if resp.StatusCode != 200 || len(*bodies) != 3 {
+		t.Errorf("Expected success on the third request, got %d after %d", resp.StatusCode, len(*bodies))
+	}
+	if len(*waits) != 2 || (*waits)[1] > 2*time.Second {
+		t.Errorf("Expected two jittered backoffs under 2s, got %v", *waits)
+	}
+}
+
+func TestGivesUpAfterMaxRetries(t *testing.T) {
+	server, bodies := serve(status(500), status(500), status(500), status(500))
+	defer server.Close()
+	client, _ := newTestClient(time.Now())
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if resp.StatusCode != 500 || len(*bodies) != 4 {
+		t.Errorf("Expected the last 500 after 4 requests, got %d after %d", resp.StatusCode, len(*bodies))
+	}
+}
+
+func TestDoesNotRetryPosts(t *testing.T) {
+	server, bodies := serve(status(503), status(200))
+	defer server.Close()
+	client, _ := newTestClient(time.Now())
+
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if resp.StatusCode != 503 || len(*bodies) != 1 {
+		t.Errorf("Expected a single 503, got %d after %d", resp.StatusCode, len(*bodies))
+	}
+}
+
+func TestRetriesPutsWithBody(t *testing.T) {
+	server, bodies := serve(status(503), status(200))
+	defer server.Close()
+	client, _ := newTestClient(time.Now())
+
+	req, _ := http.NewRequest("PUT", server.URL, strings.NewReader("body"))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if resp.StatusCode != 200 || strings.Join(*bodies, ",") != "body,body" {
+		t.Errorf("Expected the body to be sent twice, got %d with %v", resp.StatusCode, *bodies)
+	}
+}
+
+func TestWaitsForRateLimitReset(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	reset := fmt.Sprint(now.Add(10 * time.Second).Unix())
+	server, _ := serve(
+		status(403, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", reset),
+		status(429, "Retry-After", "3"),
+		status(200, "X-RateLimit-Remaining", "4999"),
+	)
+	defer server.Close()
+	client, waits := newTestClient(now)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected success, got %d", resp.StatusCode)
+	}
+	if len(*waits) != 2 || (*waits)[0] != 10*time.Second || (*waits)[1] != 3*time.Second {
+		t.Errorf("Expected waits of 10s and 3s, got %v", *waits)
+	}
+
+	serverURL, _ := url.Parse(server.URL)
+	var metric dto.Metric
+	rateLimitRemaining.WithLabelValues(serverURL.Host).Write(&metric)
+	if metric.GetGauge().GetValue() != 4999 {
+		t.Errorf("Expected 4999 requests remaining, got %v", metric.GetGauge().GetValue())
+	}
+}
+
+func TestExhaustedRateLimit(t *testing.T) {
+	now := time.Now()
+	reset := fmt.Sprint(now.Add(2 * time.Hour).Unix())
+	server, bodies := serve(status(403, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", reset))
+	defer server.Close()
+	client, waits := newTestClient(now)
+
+	_, err := client.Get(server.URL)
+	if err == nil || !strings.Contains(err.Error(), "rate limit exhausted, resets at") {
+		t.Errorf("Expected a rate limit error, got %v", err)
+	}
+	if len(*bodies) != 1 || len(*waits) != 0 {
+		t.Errorf("Expected no retries, got %d requests and waits %v", len(*bodies), *waits)
+	}
+
+	// A wait that outlasts the deadline fails straight away too
+	server, _ = serve(status(429, "Retry-After", "30"))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if _, err := client.Do(req.WithContext(ctx)); err == nil || !strings.Contains(err.Error(), "rate limit exhausted") {
+		t.Errorf("Expected a rate limit error, got %v", err)
+	}
+}
+
+func TestForbiddenWithoutRateLimit(t *testing.T) {
+	server, _ := serve(status(403), status(200))
+	defer server.Close()
+	client, waits := newTestClient(time.Now())
+
+	// A 403 without rate limit headers is a real permission error
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if resp.StatusCode != 403 || len(*waits) != 0 {
+		t.Errorf("Expected the 403 to be returned, got %d with waits %v", resp.StatusCode, *waits)
+	}
+}
@@ -12,44 +12,57 @@ import (
 	"github.com/skuid/changelog/src/linkStyle"
 )
 
-func formatCommits(repo string, style linkStyle.Style, commits changelog.Commits) string {
+func formatCommits(repo string, links linkStyle.Templates, commits changelog.Commits) string {
 	if len(commits) == 1 {
-		return commits[0].Summary(repo, style)
+		return commits[0].Summary(repo, links)
 	}
 	var response []string
 	for _, commit := range commits {
-		response = append(response, fmt.Sprintf("  * %s", commit.Summary(repo, style)))
+		response = append(response, fmt.Sprintf("  * %s", commit.Summary(repo, links)))
 	}
 	return fmt.Sprintf("\n%s", strings.Join(response, "\n"))
 }
 
+func formatCommit(repo string, links linkStyle.Templates, commit changelog.Commit) string {
+	return commit.Summary(repo, links)
+}
+
 // MarkdownWriter writes a Markdown changelog
 type MarkdownWriter struct {
 	Writer io.Writer
 }
 
 const changeLog = `<a name="{{.version }}"></a>
-##{{if .patchVersion}}#{{end}} {{.version}} ({{.date}}){{$style := .style}}{{$repo := .repo }}{{ $sectionMap := .sectionMap}}
+##{{if .patchVersion}}#{{end}} {{if .link}}[{{.version}}]({{.link}}){{else}}{{.version}}{{end}} ({{.date}}){{$links := .links}}{{$repo := .repo }}{{ $sectionMap := .sectionMap}}
 
 {{- range $i, $section := .order}}
-{{ $items  := index $sectionMap $section }}{{ $itemLen := len $items}}
+{{- $items  := index $sectionMap $section }}{{ $itemLen := len $items}}
 {{- if gt $itemLen 0 }}
+
 ### {{ $section  }}
 {{ range $component, $commits  := $items }}
-* **{{ $component }}:** {{formatCommits $repo $style $commits}}{{end}}
+{{- if $component }}
+* **{{ $component }}:** {{formatCommits $repo $links $commits}}
+{{- else }}{{ range $commits }}
+* {{formatCommit $repo $links .}}{{end}}
+{{- end }}{{end}}
 {{- end}}
 {{- end}}
+{{- if .contributors }}
+
+### Contributors
+{{ range .contributors }}
+* {{ .Summary }}{{end}}
+{{- end}}
 `
 
-// Generate writes a changelog to its embedded io.Writer
-//
-// yes the arguments are gross, I'm going to break out the fields needed off of
-// changelog.changelog rather than pass around a huge object
-func (m MarkdownWriter) Generate(c changelog.ChangeLog, style linkStyle.Style, sectionMap changelog.SectionMap) error {
+// Write writes a release to its embedded io.Writer
+func (m MarkdownWriter) Write(r *changelog.Release) error {
 
 	t, err := template.New("changeLog").Funcs(
 		map[string]interface{}{
 			"formatCommits": formatCommits,
+			"formatCommit":  formatCommit,
 		},
 	).Parse(changeLog)
 
@@ -57,15 +70,42 @@ func (m MarkdownWriter) Generate(c changelog.ChangeLog, style linkStyle.Style, s
 		return errors.WithStack(err)
 	}
 
+	// The version links to the changes since the previous release, or to its
+	// tag if they can't be compared
+	link := ""
+	if r.From != "" && r.To != "" {
+		link = r.Links.CompareLink(r.From, r.To, r.Repo)
+	}
+	if link == "" && r.To != "" {
+		link = r.Links.TagLink(r.To, r.Repo)
+	}
+
 	data := map[string]interface{}{
-		"version":      c.Version,
-		"patchVersion": c.PatchVersion,
-		"style":        style,
-		"date":         time.Now().Format("2006-01-02"),
-		"sectionMap":   sectionMap.Sections,
-		"order":        sectionMap.Order(),
-		"repo":         c.Repo,
+		"version":      r.Version,
+		"patchVersion": r.PatchVersion,
+		"links":        r.Links,
+		"date":         r.Date.Format("2006-01-02"),
+		"sectionMap":   r.Sections.Sections,
+		"order":        r.Sections.Order(),
+		"repo":         r.Repo,
+		"contributors": r.Contributors,
+		"link":         link,
 	}
 
 	return errors.WithStack(t.Execute(m.Writer, data))
 }
+
+// Generate writes a changelog to its embedded io.Writer, dated today, with
+// the links of a built-in style
+//
+// Deprecated: use changelog.Generate and Write
+func (m MarkdownWriter) Generate(c changelog.ChangeLog, style linkStyle.Style, sectionMap changelog.SectionMap) error {
+	links, _ := linkStyle.Lookup(style)
+	return m.Write(&changelog.Release{
+		ChangeLog: c,
+		Style:     style,
+		Links:     links,
+		Date:      time.Now(),
+		Sections:  sectionMap,
+	})
+}
@@ -0,0 +1,245 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/transport"
+	"github.com/skuid/changelog/webhooks"
+)
+
+// Pull request status states
+const StatusFailure = "failed"
+const StatusPending = "pending"
+const StatusSuccess = "succeeded"
+const StatusError = "error"
+
+// states are the pull request status states of each validation status
+var states = map[webhooks.Status]string{
+	webhooks.StatusPending: StatusPending,
+	webhooks.StatusSuccess: StatusSuccess,
+	webhooks.StatusFailure: StatusFailure,
+	webhooks.StatusError:   StatusError,
+}
+
+// apiVersion is the Azure DevOps REST API version requested
+const apiVersion = "7.0"
+
+// pageSize is the number of pull request commits listed at once
+const pageSize = 100
+
+type azureRepository struct {
+	WebURL    string `json:"webUrl"`
+	RemoteURL string `json:"remoteUrl"`
+}
+
+// url returns the repository's web URL, falling back to its clone URL
+func (r azureRepository) url() string {
+	if r.WebURL != "" {
+		return r.WebURL
+	}
+	return r.RemoteURL
+}
+
+type azurePullRequestEvent struct {
+	EventType string `json:"eventType"`
+	Resource  struct {
+		PullRequestID         int             `json:"pullRequestId"`
+		Status                string          `json:"status"`
+		Repository            azureRepository `json:"repository"`
+		LastMergeSourceCommit struct {
+			CommitID string `json:"commitId"`
+		} `json:"lastMergeSourceCommit"`
+	} `json:"resource"`
+}
+
+type azureCommit struct {
+	CommitID         string `json:"commitId"`
+	Comment          string `json:"comment"`
+	CommentTruncated bool   `json:"commentTruncated"`
+}
+
+// azurePullRequest is the pull request of an event
+type azurePullRequest struct {
+	event    *azurePullRequestEvent
+	apiURL   string
+	apiToken string
+	client   *http.Client
+}
+
+type azureWebhook struct {
+	secret    string
+	apiToken  string
+	validator *webhooks.Validator
+}
+
+// New returns a handler validating the commits of Azure DevOps pull request
+// service hooks. The hook must send the secret as its basic authentication
+// password. The work for each event must finish within timeout, if it isn't
+// zero.
+func New(secret, apiToken string, timeout time.Duration) http.Handler {
+	h := azureWebhook{secret, apiToken, &webhooks.Validator{
+		NewQuerier: func(ref string) changelog.Querier {
+			return changelog.NewAzureQuerier(ref, apiToken, changelog.QueryFilter{})
+		},
+		Timeout: timeout,
+	}}
+	return webhooks.Handler(secret, h.webhook)
+}
+
+func newAzurePullRequest(event *azurePullRequestEvent, apiToken string) (*azurePullRequest, error) {
+	repo := event.Resource.Repository
+	apiURL := changelog.AzureAPIURL(repo.url())
+	if apiURL == "" {
+		return nil, errors.Errorf("%s is not an Azure DevOps repository URL", repo.url())
+	}
+	return &azurePullRequest{
+		event:    event,
+		apiURL:   apiURL,
+		apiToken: apiToken,
+		client:   transport.NewClient(),
+	}, nil
+}
+
+// do sends a request to the repository's API, decoding the response into v if
+// it isn't nil. The response headers are returned for continuation tokens.
+func (p *azurePullRequest) do(ctx context.Context, method, path string, params url.Values, body, v interface{}) (http.Header, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("api-version", apiVersion)
+	req, err := http.NewRequest(method, fmt.Sprintf("%s%s?%s", p.apiURL, path, params.Encode()), &buf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiToken != "" {
+		// Personal access tokens are sent as the password, with no user
+		req.SetBasicAuth("", p.apiToken)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("%s %s: %d %s", method, path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if v == nil {
+		return resp.Header, nil
+	}
+	return resp.Header, errors.WithStack(json.NewDecoder(resp.Body).Decode(v))
+}
+
+func (p *azurePullRequest) Number() int {
+	return p.event.Resource.PullRequestID
+}
+
+// Commits lists the commits of the pull request a page at a time, following
+// the continuation token of each page
+func (p *azurePullRequest) Commits(ctx context.Context) (changelog.Commits, int, error) {
+	commits := changelog.Commits{}
+	total := 0
+	path := fmt.Sprintf("/pullRequests/%d/commits", p.event.Resource.PullRequestID)
+	params := url.Values{}
+	params.Set("$top", strconv.Itoa(pageSize))
+	for {
+		var prCommits struct {
+			Value []azureCommit `json:"value"`
+		}
+		header, err := p.do(ctx, "GET", path, params, nil, &prCommits)
+		if err != nil {
+			return nil, 0, err
+		}
+		total += len(prCommits.Value)
+		for _, c := range prCommits.Value {
+			if c.CommentTruncated {
+				// Lists shorten long messages, which hides their footers
+				if _, err := p.do(ctx, "GET", "/commits/"+c.CommitID, nil, nil, &c); err != nil {
+					return nil, 0, err
+				}
+			}
+			commit := changelog.NewCommit(c.CommitID, c.Comment)
+			if commit == nil {
+				continue
+			}
+			commits = append(commits, *commit)
+		}
+		token := header.Get("X-Ms-Continuationtoken")
+		if token == "" {
+			return commits, total, nil
+		}
+		params.Set("continuationToken", token)
+	}
+}
+
+func (p *azurePullRequest) SetStatus(ctx context.Context, status webhooks.Status) error {
+	// Azure DevOps statuses are named by a genre and a name
+	genre, name := "", webhooks.WebhookContextPullRequest
+	if i := strings.Index(name, "/"); i >= 0 {
+		genre, name = name[:i], name[i+1:]
+	}
+	body := map[string]interface{}{
+		"state":       states[status],
+		"description": status.Description(),
+		"context": map[string]string{
+			"genre": genre,
+			"name":  name,
+		},
+	}
+	path := fmt.Sprintf("/pullRequests/%d/statuses", p.event.Resource.PullRequestID)
+	_, err := p.do(ctx, "POST", path, nil, body, nil)
+	return err
+}
+
+func (p *azurePullRequest) Querier() changelog.Querier {
+	return changelog.NewAzureQuerier(p.event.Resource.Repository.url(), p.apiToken, changelog.QueryFilter{})
+}
+
+func (h azureWebhook) webhook(r *http.Request) (int, string) {
+	if err := webhooks.CheckPassword(h.secret, r); err != nil {
+		return http.StatusUnauthorized, err.Error()
+	}
+
+	event := &azurePullRequestEvent{}
+	if err := json.NewDecoder(r.Body).Decode(event); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	switch event.EventType {
+	case "git.pullrequest.created", "git.pullrequest.updated":
+		// only handle open pull requests
+		if event.Resource.Status != "active" {
+			break
+		}
+		pr, err := newAzurePullRequest(event, h.apiToken)
+		if err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+		h.validator.Validate(pr)
+	default:
+		return http.StatusMethodNotAllowed, "event type is not allowed"
+	}
+
+	return http.StatusOK, "success"
+}
@@ -0,0 +1,156 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/skuid/changelog/webhooks"
+)
+
+const repoPath = "/org/project/_apis/git/repositories/repo"
+
+// azureStatus is a pull request status as the API takes it
+type azureStatus struct {
+	State       string            `json:"state"`
+	Description string            `json:"description"`
+	Context     map[string]string `json:"context"`
+}
+
+// newTestAPI returns a stand-in for the Azure DevOps API serving the commits
+// of pull request 7, one page per commit, and the statuses it's sent. The
+// list truncates the first commit's message.
+func newTestAPI(t *testing.T, messages ...string) (*httptest.Server, *[]azureStatus) {
+	t.Helper()
+	statuses := &[]azureStatus{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(repoPath+"/pullRequests/7/commits", func(w http.ResponseWriter, r *http.Request) {
+		if _, pass, _ := r.BasicAuth(); pass != "pat" {
+			t.Errorf("Expected the token as the password, got %q", pass)
+		}
+		// The continuation token is the index of the page's commit
+		i, _ := strconv.Atoi(r.URL.Query().Get("continuationToken"))
+		if i+1 < len(messages) {
+			w.Header().Set("x-ms-continuationtoken", strconv.Itoa(i+1))
+		}
+		commit := azureCommit{CommitID: fmt.Sprintf("%040d", i), Comment: messages[i]}
+		if i == 0 {
+			commit.Comment, commit.CommentTruncated = "fix: trunc", true
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": []azureCommit{commit}})
+	})
+	mux.HandleFunc(repoPath+"/commits/"+fmt.Sprintf("%040d", 0), func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(azureCommit{CommitID: fmt.Sprintf("%040d", 0), Comment: messages[0]})
+	})
+	mux.HandleFunc(repoPath+"/pullRequests/7/statuses", func(w http.ResponseWriter, r *http.Request) {
+		status := azureStatus{}
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			t.Errorf("Could not decode status: %s", err)
+		}
+		*statuses = append(*statuses, status)
+		w.WriteHeader(http.StatusCreated)
+	})
+	return httptest.NewServer(mux), statuses
+}
+
+func pullRequestPayload(webURL, eventType string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"eventType": %q,
+		"resource": {
+			"pullRequestId": 7,
+			"status": "active",
+			"repository": {"name": "repo", "webUrl": %q},
+			"lastMergeSourceCommit": {"commitId": "abc123"}
+		}
+	}`, eventType, webURL))
+}
+
+func sendEvent(handler http.Handler, payload []byte, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(payload))
+	if password != "" {
+		req.SetBasicAuth("changelog", password)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestPullRequest(t *testing.T) {
+	api, statuses := newTestAPI(t, "fix: a bug\n\nFixes AB#3", "feat(api): add a thing", "Merged PR 6: wip")
+	defer api.Close()
+
+	event := &azurePullRequestEvent{}
+	if err := json.Unmarshal(pullRequestPayload(api.URL+"/org/project/_git/repo", "git.pullrequest.created"), event); err != nil {
+		t.Fatalf("Could not decode the payload: %s", err)
+	}
+	pr, err := newAzurePullRequest(event, "pat")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if pr.Number() != 7 {
+		t.Errorf("Expected pull request 7, got %d", pr.Number())
+	}
+
+	commits, total, err := pr.Commits(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if total != 3 || len(commits) != 3 {
+		t.Fatalf("Expected 3 commits, got %d of %d", len(commits), total)
+	}
+	if len(commits[0].Closes) != 1 || commits[0].Closes[0] != "AB#3" {
+		t.Errorf("Expected the truncated message to be fetched, got closes %v", commits[0].Closes)
+	}
+
+	if err := pr.SetStatus(context.Background(), webhooks.StatusSuccess); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(*statuses) != 1 {
+		t.Fatalf("Expected 1 status, got %v", *statuses)
+	}
+	got := (*statuses)[0]
+	if got.State != StatusSuccess || got.Description != webhooks.StatusSuccess.Description() {
+		t.Errorf("Expected the succeeded state, got %+v", got)
+	}
+	if got.Context["genre"] != "changelog" || got.Context["name"] != "pull-request" {
+		t.Errorf("Expected the changelog/pull-request context, got %v", got.Context)
+	}
+}
+
+func TestWebhookRejects(t *testing.T) {
+	handler := New("secret", "pat", 0)
+	payload := pullRequestPayload("https://dev.azure.com/org/project/_git/repo", "git.pullrequest.created")
+
+	cases := []struct {
+		name     string
+		payload  []byte
+		password string
+		want     int
+	}{
+		{"no credentials", payload, "", http.StatusUnauthorized},
+		{"wrong secret", payload, "other", http.StatusUnauthorized},
+		{"malformed", []byte("{"), "secret", http.StatusBadRequest},
+		{"other event", pullRequestPayload("https://dev.azure.com/org/project/_git/repo", "git.push"), "secret", http.StatusMethodNotAllowed},
+		{"not azure", pullRequestPayload("not a url", "git.pullrequest.created"), "secret", http.StatusBadRequest},
+		// Nothing listens on the repository's host, so the validation started
+		// in the background fails quietly
+		{"accepted", pullRequestPayload("http://127.0.0.1:1/org/project/_git/repo", "git.pullrequest.updated"), "secret", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		if w := sendEvent(handler, c.payload, c.password); w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d %s", c.name, c.want, w.Code, w.Body.String())
+		}
+	}
+
+	// Without a secret nothing can be verified, even requests without
+	// credentials
+	if w := sendEvent(New("", "pat", 0), payload, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a webhook without a secret to refuse requests, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,48 @@
+package webhooks
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/config"
+	"github.com/skuid/changelog/src/remote"
+)
+
+// NewExtender returns the Extender of the configuration files that the
+// repository at repo extends. Only repositories of its own host and owner, or
+// organization, can be extended, and they are read with the querier
+// newQuerier returns for their URL. HTTP URLs and local files are refused,
+// since anyone who can edit a served repository's configuration could
+// otherwise make the server read them.
+func NewExtender(repo string, newQuerier func(ref string) changelog.Querier) *config.Extender {
+	return &config.Extender{
+		Repository: func(ref string) (changelog.Querier, error) {
+			if !sameOwner(repo, ref) {
+				return nil, errors.Errorf("%s is not a repository of the owner of %s", ref, repo)
+			}
+			return newQuerier(ref), nil
+		},
+		TTL: ConfigTTL,
+	}
+}
+
+// ownerKey returns the host and owner, or organization, of a repository URL,
+// telling apart the repositories one Extender may read. The key is empty if
+// repo isn't a repository URL.
+func ownerKey(repo string) string {
+	u, err := remote.Parse(repo)
+	if err != nil {
+		return ""
+	}
+	// Azure DevOps owners are an organization and a project
+	org := strings.SplitN(u.Owner, "/", 2)[0]
+	return strings.ToLower(u.HostName() + "/" + org)
+}
+
+// sameOwner reports whether the repository ref has the host and owner of the
+// repository at repo
+func sameOwner(repo, ref string) bool {
+	key := ownerKey(repo)
+	return key != "" && key == ownerKey(ref)
+}
@@ -0,0 +1,61 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/skuid/changelog/src/changelog"
+)
+
+// configQuerier is a repository holding only a configuration file
+type configQuerier struct {
+	changelog.Querier
+	contents string
+}
+
+func (q configQuerier) GetConfig(ctx context.Context) (io.Reader, error) {
+	return &changelog.ConfigFile{Reader: strings.NewReader(q.contents), Path: ".clog.toml"}, nil
+}
+
+func TestNewExtender(t *testing.T) {
+	queried := []string{}
+	e := NewExtender("https://github.com/acme/app", func(ref string) changelog.Querier {
+		queried = append(queried, ref)
+		return configQuerier{contents: "[sections]\ncleanup = [\"cleanup\"]\n"}
+	})
+
+	cases := []struct {
+		ref string
+		ok  bool
+	}{
+		{"https://github.com/acme/changelog-config", true},
+		{"https://GitHub.com/ACME/changelog-config.git", true},
+		{"https://github.com/other/private-config", false},
+		{"https://github.example.com/acme/changelog-config", false},
+		{"https://example.com/changelog/base.toml", false},
+		{"http://169.254.169.254/latest/meta-data/base.json", false},
+		{"base.toml", false},
+	}
+	for _, c := range cases {
+		queried = queried[:0]
+		_, err := e.Extend(context.Background(), strings.NewReader("extends = \""+c.ref+"\"\n"), "toml")
+		if c.ok && err != nil {
+			t.Errorf("Expected %s to be extended, got %s", c.ref, err)
+		}
+		if !c.ok && (err == nil || len(queried) > 0) {
+			t.Errorf("Expected %s to be refused without being queried, got %v", c.ref, err)
+		}
+	}
+}
+
+func TestValidatorExtenders(t *testing.T) {
+	v := &Validator{}
+	if v.extender("https://github.com/acme/app") != v.extender("https://github.com/acme/api") {
+		t.Errorf("Expected the repositories of an owner to share an Extender")
+	}
+	if v.extender("https://github.com/acme/app") == v.extender("https://github.com/other/app") {
+		t.Errorf("Expected the repositories of other owners to have their own Extender")
+	}
+}
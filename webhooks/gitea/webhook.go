@@ -0,0 +1,224 @@
+package gitea
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/remote"
+	"github.com/skuid/changelog/src/transport"
+	"github.com/skuid/changelog/webhooks"
+)
+
+const StatusFailure = "failure"
+const StatusPending = "pending"
+const StatusSuccess = "success"
+const StatusError = "error"
+
+// states are the commit status states of each validation status
+var states = map[webhooks.Status]string{
+	webhooks.StatusPending: StatusPending,
+	webhooks.StatusSuccess: StatusSuccess,
+	webhooks.StatusFailure: StatusFailure,
+	webhooks.StatusError:   StatusError,
+}
+
+// pageSize is the largest page Gitea and Forgejo return by default
+const pageSize = 50
+
+type giteaRepository struct {
+	HTMLURL string `json:"html_url"`
+}
+
+type giteaPullRequestEvent struct {
+	Action      string `json:"action"`
+	PullRequest struct {
+		Number int `json:"number"`
+		Head   struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Repository giteaRepository `json:"repository"`
+}
+
+// giteaPullRequest is the pull request of an event
+type giteaPullRequest struct {
+	event    *giteaPullRequestEvent
+	apiURL   string
+	repoPath string
+	apiToken string
+	client   *http.Client
+}
+
+type giteaWebhook struct {
+	secret    string
+	apiToken  string
+	validator *webhooks.Validator
+}
+
+// New returns a handler validating the commits of Gitea and Forgejo pull
+// request events. The work for each event must finish within timeout, if it
+// isn't zero.
+func New(secret, apiToken string, timeout time.Duration) http.Handler {
+	h := giteaWebhook{secret, apiToken, &webhooks.Validator{
+		NewQuerier: func(ref string) changelog.Querier {
+			return changelog.NewGiteaQuerier(ref, apiToken, changelog.QueryFilter{})
+		},
+		Timeout: timeout,
+	}}
+	return webhooks.Handler(secret, h.webhook)
+}
+
+func newGiteaPullRequest(event *giteaPullRequestEvent, apiToken string) (*giteaPullRequest, error) {
+	u, err := remote.Parse(event.Repository.HTMLURL)
+	if err != nil {
+		return nil, err
+	}
+	return &giteaPullRequest{
+		event:    event,
+		apiURL:   fmt.Sprintf("%s://%s/api/v1", u.Scheme, u.Host),
+		repoPath: fmt.Sprintf("/repos/%s/%s", url.PathEscape(u.Owner), url.PathEscape(u.Repo)),
+		apiToken: apiToken,
+		client:   transport.NewClient(),
+	}, nil
+}
+
+// do sends a request to the repository's API, decoding the response into v if
+// it isn't nil
+func (p *giteaPullRequest) do(ctx context.Context, method, path string, body, v interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	req, err := http.NewRequest(method, p.apiURL+p.repoPath+path, &buf)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiToken != "" {
+		req.Header.Set("Authorization", "token "+p.apiToken)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("%s %s: %d %s", method, path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if v == nil {
+		return nil
+	}
+	return errors.WithStack(json.NewDecoder(resp.Body).Decode(v))
+}
+
+func (p *giteaPullRequest) Number() int {
+	return p.event.PullRequest.Number
+}
+
+func (p *giteaPullRequest) Commits(ctx context.Context) (changelog.Commits, int, error) {
+	commits := changelog.Commits{}
+	total := 0
+	for page := 1; ; page++ {
+		var prCommits []struct {
+			SHA    string `json:"sha"`
+			Commit struct {
+				Message string `json:"message"`
+			} `json:"commit"`
+		}
+		path := fmt.Sprintf("/pulls/%d/commits?page=%d&limit=%d", p.event.PullRequest.Number, page, pageSize)
+		if err := p.do(ctx, "GET", path, nil, &prCommits); err != nil {
+			return nil, 0, err
+		}
+		total += len(prCommits)
+		for _, c := range prCommits {
+			commit := changelog.NewCommit(c.SHA, c.Commit.Message)
+			if commit == nil {
+				continue
+			}
+			commits = append(commits, *commit)
+		}
+		if len(prCommits) < pageSize {
+			return commits, total, nil
+		}
+	}
+}
+
+func (p *giteaPullRequest) SetStatus(ctx context.Context, status webhooks.Status) error {
+	body := map[string]string{
+		"state":       states[status],
+		"description": status.Description(),
+		"context":     webhooks.WebhookContextPullRequest,
+	}
+	return p.do(ctx, "POST", "/statuses/"+url.PathEscape(p.event.PullRequest.Head.SHA), body, nil)
+}
+
+func (p *giteaPullRequest) Querier() changelog.Querier {
+	return changelog.NewGiteaQuerier(p.event.Repository.HTMLURL, p.apiToken, changelog.QueryFilter{})
+}
+
+// validatePayload reads the request body and checks its signature. Forgejo
+// sends its own headers alongside Gitea's.
+func (h giteaWebhook) validatePayload(r *http.Request) ([]byte, error) {
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	signature := r.Header.Get("X-Gitea-Signature")
+	if signature == "" {
+		signature = r.Header.Get("X-Forgejo-Signature")
+	}
+	if err := webhooks.CheckSignature(h.secret, payload, signature); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func eventType(r *http.Request) string {
+	if event := r.Header.Get("X-Gitea-Event"); event != "" {
+		return event
+	}
+	return r.Header.Get("X-Forgejo-Event")
+}
+
+func (h giteaWebhook) webhook(r *http.Request) (int, string) {
+	payload, err := h.validatePayload(r)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	switch eventType(r) {
+	case "pull_request":
+		event := &giteaPullRequestEvent{}
+		if err := json.Unmarshal(payload, event); err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+		// only handle these specific actions
+		if event.Action != "opened" && event.Action != "reopened" && event.Action != "synchronized" {
+			break
+		}
+		pr, err := newGiteaPullRequest(event, h.apiToken)
+		if err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+		h.validator.Validate(pr)
+	default:
+		return http.StatusMethodNotAllowed, "event type is not allowed"
+	}
+
+	return http.StatusOK, "success"
+}
@@ -0,0 +1,164 @@
+package gitea
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/skuid/changelog/webhooks"
+)
+
+// newTestAPI returns a stand-in for the Gitea API serving the commits of pull
+// request 7, one page per commit, and the statuses it's sent
+func newTestAPI(t *testing.T, messages ...string) (*httptest.Server, *[]map[string]string) {
+	t.Helper()
+	statuses := &[]map[string]string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/tools/changelog/pulls/7/commits", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "token api-token" {
+			t.Errorf("Expected the API token, got %q", got)
+		}
+		if got := r.URL.Query().Get("limit"); got != strconv.Itoa(pageSize) {
+			t.Errorf("Expected pages of %d, got %q", pageSize, got)
+		}
+		// Every page but the last is full
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		commits := []map[string]interface{}{}
+		for i := (page - 1) * pageSize; i < page*pageSize && i < len(messages); i++ {
+			commits = append(commits, map[string]interface{}{
+				"sha":    fmt.Sprintf("%040d", i),
+				"commit": map[string]string{"message": messages[i]},
+			})
+		}
+		json.NewEncoder(w).Encode(commits)
+	})
+	mux.HandleFunc("/api/v1/repos/tools/changelog/statuses/abc123", func(w http.ResponseWriter, r *http.Request) {
+		status := map[string]string{}
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			t.Errorf("Could not decode status: %s", err)
+		}
+		*statuses = append(*statuses, status)
+		w.WriteHeader(http.StatusCreated)
+	})
+	return httptest.NewServer(mux), statuses
+}
+
+func pullRequestPayload(repoURL, action string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"action": %q,
+		"number": 7,
+		"pull_request": {"number": 7, "head": {"sha": "abc123"}},
+		"repository": {"html_url": %q, "full_name": "tools/changelog"}
+	}`, action, repoURL))
+}
+
+func sendEvent(handler http.Handler, event string, payload []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(payload))
+	req.Header.Set("X-Gitea-Event", event)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestPullRequest(t *testing.T) {
+	messages := []string{}
+	for i := 0; i < pageSize; i++ {
+		messages = append(messages, fmt.Sprintf("feat: thing %d", i))
+	}
+	messages = append(messages, "wip")
+	api, statuses := newTestAPI(t, messages...)
+	defer api.Close()
+
+	event := &giteaPullRequestEvent{}
+	if err := json.Unmarshal(pullRequestPayload(api.URL+"/tools/changelog", "opened"), event); err != nil {
+		t.Fatalf("Could not decode the payload: %s", err)
+	}
+	pr, err := newGiteaPullRequest(event, "api-token")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if pr.Number() != 7 {
+		t.Errorf("Expected pull request 7, got %d", pr.Number())
+	}
+
+	commits, total, err := pr.Commits(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if total != pageSize+1 || len(commits) != total {
+		t.Errorf("Expected %d commits over two pages, got %d of %d", pageSize+1, len(commits), total)
+	}
+
+	if err := pr.SetStatus(context.Background(), webhooks.StatusFailure); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	want := map[string]string{
+		"state":       StatusFailure,
+		"description": webhooks.StatusFailure.Description(),
+		"context":     "changelog/pull-request",
+	}
+	if len(*statuses) != 1 || !reflect.DeepEqual((*statuses)[0], want) {
+		t.Errorf("Expected status %v, got %v", want, *statuses)
+	}
+}
+
+func TestWebhookSignatures(t *testing.T) {
+	// Nothing listens on the repository's host, so the validation started in
+	// the background fails quietly
+	payload := pullRequestPayload("http://127.0.0.1:1/tools/changelog", "opened")
+	handler := New("secret", "api-token", 0)
+
+	if w := sendEvent(handler, "pull_request", payload, map[string]string{
+		"X-Gitea-Signature": webhooks.Signature("secret", payload),
+	}); w.Code != http.StatusOK {
+		t.Errorf("Expected a Gitea signature to be accepted, got %d %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(payload))
+	req.Header.Set("X-Forgejo-Event", "pull_request")
+	req.Header.Set("X-Forgejo-Signature", strings.ToUpper(webhooks.Signature("secret", payload)))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a Forgejo signature to be accepted, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWebhookRejects(t *testing.T) {
+	payload := pullRequestPayload("https://git.example.com/tools/changelog", "opened")
+	handler := New("secret", "api-token", 0)
+
+	cases := []struct {
+		name    string
+		event   string
+		headers map[string]string
+		want    int
+	}{
+		{"unsigned", "pull_request", nil, http.StatusBadRequest},
+		{"wrong secret", "pull_request", map[string]string{"X-Gitea-Signature": webhooks.Signature("other", payload)}, http.StatusBadRequest},
+		{"other event", "push", map[string]string{"X-Gitea-Signature": webhooks.Signature("secret", payload)}, http.StatusMethodNotAllowed},
+	}
+
+	for _, c := range cases {
+		if w := sendEvent(handler, c.event, payload, c.headers); w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d %s", c.name, c.want, w.Code, w.Body.String())
+		}
+	}
+
+	// Without a secret nothing can be verified, even signatures made with
+	// an empty secret
+	unsigned := map[string]string{"X-Gitea-Signature": webhooks.Signature("", payload)}
+	if w := sendEvent(New("", "api-token", 0), "pull_request", payload, unsigned); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a webhook without a secret to refuse requests, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -2,16 +2,13 @@ package github
 
 import (
 	"context"
-	"fmt"
-	"io"
 	"net/http"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/transport"
 	"github.com/skuid/changelog/webhooks"
-	"github.com/spf13/viper"
-	"go.uber.org/zap"
-	"golang.org/x/oauth2"
 )
 
 const StatusFailure = "failure"
@@ -19,50 +16,59 @@ const StatusPending = "pending"
 const StatusSuccess = "success"
 const StatusError = "error"
 
-type githubWebhookHelper struct {
-	*github.Client
+// states are the commit status states of each validation status
+var states = map[webhooks.Status]string{
+	webhooks.StatusPending: StatusPending,
+	webhooks.StatusSuccess: StatusSuccess,
+	webhooks.StatusFailure: StatusFailure,
+	webhooks.StatusError:   StatusError,
 }
 
 type githubWebhook struct {
-	secret   string
-	apiToken string
+	secret    string
+	apiToken  string
+	validator *webhooks.Validator
 }
 
-func New(secret, apiToken string) http.Handler {
-	h := githubWebhook{secret, apiToken}
-	mux := http.NewServeMux()
-	mux.HandleFunc("/webhook", sendResponse(h.webhook))
-	return mux
+// New returns a handler validating the commits of pull request events. The
+// work for each event must finish within timeout, if it isn't zero.
+func New(secret, apiToken string, timeout time.Duration) http.Handler {
+	h := githubWebhook{secret, apiToken, &webhooks.Validator{
+		NewQuerier: func(ref string) changelog.Querier {
+			return changelog.NewGithubQuerier(ref, apiToken, changelog.QueryFilter{})
+		},
+		Timeout: timeout,
+	}}
+	return webhooks.Handler(secret, h.webhook)
 }
 
-func sendResponse(handler func(http.ResponseWriter, *http.Request) (int, string)) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		code, message := handler(w, r)
-		w.WriteHeader(code)
-		io.WriteString(w, message)
-	}
+// githubPullRequest is the pull request of an event
+type githubPullRequest struct {
+	*github.Client
+	event    *github.PullRequestEvent
+	apiToken string
 }
 
-func newGithubWebhookHelper(apiToken string) *githubWebhookHelper {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: apiToken},
-	)
-	client := github.NewClient(oauth2.NewClient(ctx, ts))
-	return &githubWebhookHelper{client}
+func newGithubPullRequest(event *github.PullRequestEvent, apiToken string) githubPullRequest {
+	client := github.NewClient(transport.NewTokenClient(apiToken, ""))
+	return githubPullRequest{client, event, apiToken}
+}
+
+func (p githubPullRequest) Number() int {
+	return p.event.PullRequest.GetNumber()
 }
 
-func (client *githubWebhookHelper) getPrCommits(event *github.PullRequestEvent, apiToken string) (changelog.Commits, error) {
+func (p githubPullRequest) Commits(ctx context.Context) (changelog.Commits, int, error) {
 	// list the commits on the pull request
-	prCommits, _, err := client.PullRequests.ListCommits(
-		context.Background(),
-		event.Repo.Owner.GetLogin(),
-		event.Repo.GetName(),
-		event.PullRequest.GetNumber(),
+	prCommits, _, err := p.PullRequests.ListCommits(
+		ctx,
+		p.event.Repo.Owner.GetLogin(),
+		p.event.Repo.GetName(),
+		p.event.PullRequest.GetNumber(),
 		&github.ListOptions{},
 	)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	// format them properly
 	commits := changelog.Commits{}
@@ -73,109 +79,30 @@ func (client *githubWebhookHelper) getPrCommits(event *github.PullRequestEvent,
 		}
 		commits = append(commits, *commit)
 	}
-	return commits, nil
+	return commits, p.event.PullRequest.GetCommits(), nil
 }
 
-func (client *githubWebhookHelper) updateRepoStatus(repo *github.Repository, sha, state string) error {
-
-	var description string
-	switch state {
-	case StatusFailure:
-		description = "commit was improperly formatted"
-	case StatusSuccess:
-		description = "commit looks good"
-	case StatusPending:
-		description = "beginning commit format validation"
-	case StatusError:
-		description = "there was a problem validating commit format"
-	default:
-		return fmt.Errorf("repo status state %s is invalid", state)
-	}
+func (p githubPullRequest) SetStatus(ctx context.Context, status webhooks.Status) error {
 	creating := &github.RepoStatus{
-		State:       github.String(state),
-		Description: github.String(description),
+		State:       github.String(states[status]),
+		Description: github.String(status.Description()),
 		Context:     github.String(webhooks.WebhookContextPullRequest),
 	}
-	_, _, err := client.Repositories.CreateStatus(
-		context.Background(),
-		repo.Owner.GetLogin(),
-		repo.GetName(),
-		sha,
+	_, _, err := p.Repositories.CreateStatus(
+		ctx,
+		p.event.Repo.Owner.GetLogin(),
+		p.event.Repo.GetName(),
+		p.event.PullRequest.Head.GetSHA(),
 		creating,
 	)
-	if err != nil {
-		return err
-	}
-	return nil
+	return err
 }
 
-func (h githubWebhook) handlePullRequestEvent(event *github.PullRequestEvent) {
-
-	eventAction := event.GetAction()
-	// only handle these specific actions
-	if eventAction != "opened" && eventAction != "repoened" && eventAction != "synchronize" {
-		return
-	}
-	client := newGithubWebhookHelper(h.apiToken)
-	commits, err := client.getPrCommits(event, h.apiToken)
-
-	if err != nil {
-		zap.L().Error(err.Error())
-		return
-	}
-
-	pullRequstNumber := event.PullRequest.GetNumber()
-	buildStatusSha := event.PullRequest.Head.GetSHA()
-
-	zap.L().Info("validating commit format for pull request", zap.Int("pull_request", pullRequstNumber))
-	err = client.updateRepoStatus(event.Repo, buildStatusSha, StatusPending)
-	if err != nil {
-		zap.L().Error(err.Error())
-		return
-	}
-
-	iviper := viper.New()
-	iviper.SetConfigType("toml")
-	querier := changelog.NewGithubQuerier(event.Repo.GetHTMLURL(), h.apiToken)
-
-	if config, err := querier.GetConfig(); err == nil {
-		iviper.ReadConfig(config)
-	} else {
-		zap.L().Warn(err.Error())
-	}
-
-	sectionAliasMap := changelog.MergeSectionAliasMaps(
-		changelog.NewSectionAliasMap(),
-		iviper.GetStringMapStringSlice("sections"),
-	)
-
-	commits = changelog.FilterCommits(
-		commits,
-		sectionAliasMap.Grep(),
-		false,
-	)
-	commits = changelog.FormatCommits(commits, sectionAliasMap)
-
-	if len(commits) < event.PullRequest.GetCommits() {
-		zap.L().Info("failed to validate commit format for pull request", zap.Int("pull_request", pullRequstNumber))
-		err := client.updateRepoStatus(event.Repo, buildStatusSha, StatusFailure)
-		if err != nil {
-			zap.L().Error(err.Error())
-		}
-		return
-	}
-
-	// everything looks good
-	err = client.updateRepoStatus(event.Repo, buildStatusSha, StatusSuccess)
-	if err != nil {
-		zap.L().Error(err.Error())
-		return
-	}
-	zap.L().Info("validated commit for pull request", zap.Int("pull_request", pullRequstNumber))
-	return
+func (p githubPullRequest) Querier() changelog.Querier {
+	return changelog.NewGithubQuerier(p.event.Repo.GetHTMLURL(), p.apiToken, changelog.QueryFilter{})
 }
 
-func (h githubWebhook) webhook(w http.ResponseWriter, r *http.Request) (int, string) {
+func (h githubWebhook) webhook(r *http.Request) (int, string) {
 	payload, err := github.ValidatePayload(r, []byte(h.secret))
 
 	if err != nil {
@@ -190,7 +117,11 @@ func (h githubWebhook) webhook(w http.ResponseWriter, r *http.Request) (int, str
 
 	switch evt := event.(type) {
 	case *github.PullRequestEvent:
-		go h.handlePullRequestEvent(evt)
+		// only handle these specific actions
+		action := evt.GetAction()
+		if action == "opened" || action == "reopened" || action == "synchronize" {
+			h.validator.Validate(newGithubPullRequest(evt, h.apiToken))
+		}
 	case *github.PingEvent:
 		return http.StatusOK, "success"
 	default:
@@ -0,0 +1,148 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/skuid/changelog/webhooks"
+)
+
+// newTestAPI returns a stand-in for the GitHub API serving the commits of pull
+// request 7 of acme/app, and the statuses it's sent
+func newTestAPI(t *testing.T, messages ...string) (*httptest.Server, *[]github.RepoStatus) {
+	t.Helper()
+	statuses := &[]github.RepoStatus{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/acme/app/pulls/7/commits", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer api-token" {
+			t.Errorf("Expected the API token, got %q", got)
+		}
+		commits := []map[string]interface{}{}
+		for i, message := range messages {
+			commits = append(commits, map[string]interface{}{
+				"sha":    fmt.Sprintf("%040d", i),
+				"commit": map[string]string{"message": message},
+			})
+		}
+		json.NewEncoder(w).Encode(commits)
+	})
+	mux.HandleFunc("/repos/acme/app/statuses/abc123", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected the status to be created, got %s", r.Method)
+		}
+		status := github.RepoStatus{}
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			t.Errorf("Could not decode status: %s", err)
+		}
+		*statuses = append(*statuses, status)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "{}")
+	})
+	return httptest.NewServer(mux), statuses
+}
+
+func pullRequestPayload(action string) []byte {
+	return []byte(fmt.Sprintf(`{
+		"action": %q,
+		"number": 7,
+		"pull_request": {"number": 7, "commits": 2, "head": {"sha": "abc123"}},
+		"repository": {"name": "app", "owner": {"login": "acme"}, "html_url": "https://github.com/acme/app"}
+	}`, action))
+}
+
+// signature returns the X-Hub-Signature of a payload
+func signature(secret string, payload []byte) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(payload)
+	return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func sendEvent(handler http.Handler, event string, payload []byte, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set("X-Hub-Signature", signature)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestPullRequest(t *testing.T) {
+	api, statuses := newTestAPI(t, "feat(api): add a thing", "wip")
+	defer api.Close()
+
+	event := &github.PullRequestEvent{}
+	if err := json.Unmarshal(pullRequestPayload("opened"), event); err != nil {
+		t.Fatalf("Could not decode the payload: %s", err)
+	}
+	pr := newGithubPullRequest(event, "api-token")
+	pr.BaseURL, _ = url.Parse(api.URL + "/")
+	if pr.Number() != 7 {
+		t.Errorf("Expected pull request 7, got %d", pr.Number())
+	}
+
+	commits, total, err := pr.Commits(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if total != 2 || len(commits) != 2 {
+		t.Errorf("Expected 2 commits, got %d of %d", len(commits), total)
+	}
+
+	if err := pr.SetStatus(context.Background(), webhooks.StatusFailure); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(*statuses) != 1 {
+		t.Fatalf("Expected 1 status, got %v", *statuses)
+	}
+	got := (*statuses)[0]
+	if got.GetState() != StatusFailure || got.GetContext() != "changelog/pull-request" || got.GetDescription() != webhooks.StatusFailure.Description() {
+		t.Errorf("Expected a failure status in the pull request context, got %v", got)
+	}
+}
+
+func TestWebhookSignatures(t *testing.T) {
+	handler := New("secret", "api-token", 0)
+	// Closed pull requests aren't validated, so nothing is sent to GitHub
+	payload := pullRequestPayload("closed")
+	ping := []byte(`{"zen": "Keep it logically awesome."}`)
+
+	cases := []struct {
+		name      string
+		event     string
+		payload   []byte
+		signature string
+		want      int
+	}{
+		{"signed", "pull_request", payload, signature("secret", payload), http.StatusOK},
+		{"ping", "ping", ping, signature("secret", ping), http.StatusOK},
+		{"unsigned", "pull_request", payload, "", http.StatusBadRequest},
+		{"wrong secret", "pull_request", payload, signature("other", payload), http.StatusBadRequest},
+		{"tampered", "pull_request", pullRequestPayload("reopened"), signature("secret", payload), http.StatusBadRequest},
+		{"other event", "push", payload, signature("secret", payload), http.StatusMethodNotAllowed},
+	}
+
+	for _, c := range cases {
+		if w := sendEvent(handler, c.event, c.payload, c.signature); w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d %s", c.name, c.want, w.Code, w.Body.String())
+		}
+	}
+
+	// Without a secret nothing can be verified, even signatures made with
+	// an empty secret
+	if w := sendEvent(New("", "api-token", 0), "pull_request", payload, signature("", payload)); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a webhook without a secret to refuse requests, got %d %s", w.Code, w.Body.String())
+	}
+}
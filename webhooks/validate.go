@@ -0,0 +1,150 @@
+package webhooks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/skuid/changelog/src/changelog"
+	"github.com/skuid/changelog/src/config"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Status is the state of the validation of a pull request's commits
+type Status int
+
+const (
+	StatusPending Status = iota
+	StatusSuccess
+	StatusFailure
+	StatusError
+)
+
+// Description returns the description of the status shown on pull requests
+func (s Status) Description() string {
+	switch s {
+	case StatusPending:
+		return "beginning commit format validation"
+	case StatusSuccess:
+		return "commit looks good"
+	case StatusFailure:
+		return "commit was improperly formatted"
+	}
+	return "there was a problem validating commit format"
+}
+
+// PullRequest is a pull request of a provider whose commits are validated
+type PullRequest interface {
+	// Number returns the number of the pull request
+	Number() int
+	// Commits returns the parsed commits of the pull request, and how many
+	// commits it has in total
+	Commits(ctx context.Context) (changelog.Commits, int, error)
+	// SetStatus reports the status of the validation on the pull request
+	SetStatus(ctx context.Context, status Status) error
+	// Querier returns a querier of the pull request's repository
+	Querier() changelog.Querier
+}
+
+// Validator checks that the commits of pull requests match the sections
+// configured in their repositories
+type Validator struct {
+	// NewQuerier returns the querier of a repository that a repository's
+	// configuration extends
+	NewQuerier func(ref string) changelog.Querier
+	// Timeout bounds the API calls made for each pull request. Zero means no
+	// limit
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	extenders map[string]*config.Extender
+}
+
+// extender returns the Extender of the configuration files the repository at
+// repo extends. Each owner gets its own, so files cached for one owner are
+// never read for another.
+func (v *Validator) extender(repo string) *config.Extender {
+	key := ownerKey(repo)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if e, ok := v.extenders[key]; ok {
+		return e
+	}
+	if v.extenders == nil {
+		v.extenders = map[string]*config.Extender{}
+	}
+	e := NewExtender(repo, v.NewQuerier)
+	v.extenders[key] = e
+	return e
+}
+
+// Validate validates the commits of a pull request in the background, so a
+// webhook can respond right away. The validation gets its own deadline rather
+// than the request's context.
+func (v *Validator) Validate(pr PullRequest) {
+	go func() {
+		ctx, cancel := v.newContext()
+		defer cancel()
+		v.validate(ctx, pr)
+	}()
+}
+
+func (v *Validator) newContext() (context.Context, context.CancelFunc) {
+	if v.Timeout > 0 {
+		return context.WithTimeout(context.Background(), v.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (v *Validator) validate(ctx context.Context, pr PullRequest) {
+	commits, total, err := pr.Commits(ctx)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+
+	zap.L().Info("validating commit format for pull request", zap.Int("pull_request", pr.Number()))
+	if err := pr.SetStatus(ctx, StatusPending); err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+
+	iviper := viper.New()
+	querier := pr.Querier()
+	if file, err := querier.GetConfig(ctx); err == nil {
+		repo, _ := querier.GetOrigin(ctx)
+		if err := v.extender(repo).Read(ctx, iviper, file); err != nil {
+			zap.L().Warn(err.Error())
+		}
+	} else {
+		zap.L().Warn(err.Error())
+	}
+
+	sectionAliasMap := changelog.MergeSectionAliasMaps(
+		changelog.NewSectionAliasMap(),
+		iviper.GetStringMapStringSlice("sections"),
+	)
+
+	commits = changelog.FilterCommits(
+		commits,
+		sectionAliasMap.Grep(),
+		false,
+	)
+	commits = changelog.FormatCommits(commits, sectionAliasMap)
+
+	if len(commits) < total {
+		zap.L().Info("failed to validate commit format for pull request", zap.Int("pull_request", pr.Number()))
+		if err := pr.SetStatus(ctx, StatusFailure); err != nil {
+			zap.L().Error(err.Error())
+		}
+		return
+	}
+
+	// everything looks good
+	if err := pr.SetStatus(ctx, StatusSuccess); err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+	zap.L().Info("validated commit for pull request", zap.Int("pull_request", pr.Number()))
+}
@@ -0,0 +1,124 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/skuid/changelog/src/changelog"
+)
+
+// fakeQuerier is a repository holding only a configuration file, or failing
+// to read one if err is set
+type fakeQuerier struct {
+	changelog.Querier
+	config string
+	err    error
+}
+
+func (q fakeQuerier) GetOrigin(ctx context.Context) (string, error) {
+	return "https://github.com/acme/app", nil
+}
+
+func (q fakeQuerier) GetConfig(ctx context.Context) (io.Reader, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if q.config == "" {
+		return nil, &changelog.NoConfigError{Files: changelog.ConfigFiles}
+	}
+	return &changelog.ConfigFile{Reader: strings.NewReader(q.config), Path: ".clog.toml"}, nil
+}
+
+// fakePullRequest is a pull request with the commit messages, recording each
+// status it's set to
+type fakePullRequest struct {
+	messages []string
+	err      error
+	querier  fakeQuerier
+	statuses []Status
+}
+
+func (p *fakePullRequest) Number() int {
+	return 7
+}
+
+func (p *fakePullRequest) Commits(ctx context.Context) (changelog.Commits, int, error) {
+	if p.err != nil {
+		return nil, 0, p.err
+	}
+	commits := changelog.Commits{}
+	for i, message := range p.messages {
+		if commit := changelog.NewCommit(fmt.Sprintf("%040d", i), message); commit != nil {
+			commits = append(commits, *commit)
+		}
+	}
+	return commits, len(p.messages), nil
+}
+
+func (p *fakePullRequest) SetStatus(ctx context.Context, status Status) error {
+	p.statuses = append(p.statuses, status)
+	return nil
+}
+
+func (p *fakePullRequest) Querier() changelog.Querier {
+	return p.querier
+}
+
+func TestValidatorStatuses(t *testing.T) {
+	cases := []struct {
+		name     string
+		messages []string
+		want     Status
+	}{
+		{"formatted", []string{"feat(api): add a thing", "fix: a bug\n\nFixes #3"}, StatusSuccess},
+		{"unformatted", []string{"wip", "Merged PR 6: wip"}, StatusFailure},
+		{"partly formatted", []string{"feat(api): add a thing", "wip"}, StatusFailure},
+	}
+
+	for _, c := range cases {
+		pr := &fakePullRequest{messages: c.messages}
+		(&Validator{}).validate(context.Background(), pr)
+		if want := []Status{StatusPending, c.want}; !reflect.DeepEqual(pr.statuses, want) {
+			t.Errorf("%s: expected statuses %v, got %v", c.name, want, pr.statuses)
+		}
+	}
+}
+
+func TestValidatorConfig(t *testing.T) {
+	config := "[sections]\ncleanup = [\"cleanup\"]\n"
+	cases := []struct {
+		name    string
+		querier fakeQuerier
+		message string
+		want    Status
+	}{
+		{"configured section", fakeQuerier{config: config}, "cleanup: tidy up", StatusSuccess},
+		{"no config", fakeQuerier{}, "feat: add a thing", StatusSuccess},
+		// A configuration that can't be read falls back to the default
+		// sections rather than failing every pull request
+		{"unreadable config", fakeQuerier{err: errors.New("GET /raw/.clog.toml: 500")}, "feat: add a thing", StatusSuccess},
+		{"unreadable config section", fakeQuerier{err: errors.New("GET /raw/.clog.toml: 500")}, "cleanup: tidy up", StatusFailure},
+		{"unparsable config", fakeQuerier{config: "[sections"}, "feat: add a thing", StatusSuccess},
+	}
+
+	for _, c := range cases {
+		pr := &fakePullRequest{messages: []string{c.message}, querier: c.querier}
+		(&Validator{}).validate(context.Background(), pr)
+		if want := []Status{StatusPending, c.want}; !reflect.DeepEqual(pr.statuses, want) {
+			t.Errorf("%s: expected statuses %v, got %v", c.name, want, pr.statuses)
+		}
+	}
+}
+
+func TestValidatorCommitsError(t *testing.T) {
+	pr := &fakePullRequest{err: errors.New("GET /pulls/7/commits: 502")}
+	(&Validator{}).validate(context.Background(), pr)
+	if len(pr.statuses) != 0 {
+		t.Errorf("Expected no status when the commits can't be listed, got %v", pr.statuses)
+	}
+}
@@ -1,7 +1,16 @@
 package webhooks
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 const WebhookContextPullRequest = "changelog/pull-request"
@@ -10,3 +19,63 @@ const WebhookContextPush = "changelog/push"
 type VCSWebhook interface {
 	New(secret string, apiToken string) http.Handler
 }
+
+// ConfigTTL is how long the configuration files that repositories extend are
+// reused before they are fetched again
+const ConfigTTL = 5 * time.Minute
+
+// ErrNoSecret is returned for every request to a webhook without a secret,
+// since there is no way to tell who sent them
+var ErrNoSecret = errors.New("no webhook secret is configured, requests can't be verified")
+
+// Handler serves a provider's webhook at `/webhook`, writing the status code
+// and message handle returns. Requests are refused without calling handle if
+// secret is empty.
+func Handler(secret string, handle func(*http.Request) (int, string)) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {
+		code, message := http.StatusUnauthorized, ErrNoSecret.Error()
+		if secret != "" {
+			code, message = handle(r)
+		}
+		w.WriteHeader(code)
+		io.WriteString(w, message)
+	})
+	return mux
+}
+
+// Signature returns the hex HMAC-SHA256 of a payload, as Gitea and Forgejo
+// sign their webhooks
+func Signature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckSignature returns an error unless signature is the payload's signature
+// with the secret. The signature's case doesn't matter.
+func CheckSignature(secret string, payload []byte, signature string) error {
+	if secret == "" {
+		return ErrNoSecret
+	}
+	if signature == "" {
+		return errors.New("missing signature")
+	}
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(Signature(secret, payload))) {
+		return errors.New("payload signature check failed")
+	}
+	return nil
+}
+
+// CheckPassword returns an error unless the request carries the secret as its
+// basic authentication password, as Azure DevOps service hooks send it
+func CheckPassword(secret string, r *http.Request) error {
+	if secret == "" {
+		return ErrNoSecret
+	}
+	_, password, ok := r.BasicAuth()
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(secret)) != 1 {
+		return errors.New("service hook credentials are invalid")
+	}
+	return nil
+}